@@ -52,6 +52,7 @@ var (
 	cpuprofile   string
 	memprofile   string
 	outputFile   string
+	optLevel     int
 
 	infoCmd bool
 
@@ -82,6 +83,7 @@ func init() {
 	flag.StringVar(&cpuprofile, "cpuprofile", "", "File to write CPU profile data")
 	flag.StringVar(&memprofile, "memprofile", "", "File to write memory profile data")
 	flag.StringVar(&outputFile, "o", "", "Output file of compiled bytecode")
+	flag.IntVar(&optLevel, "O", compiler.OptimizationLevel, "Optimization level of compiled code, 0 disables optimizations")
 
 	flag.Var(&modulePaths, "M", "Module search paths")
 	flag.Var(&autoloadModules, "al", "Autoload modules")
@@ -91,6 +93,7 @@ func init() {
 
 func main() {
 	flag.Parse()
+	compiler.OptimizationLevel = optLevel
 
 	if builtinModPaths != "" {
 		modulePaths = append(modulePaths, strings.Split(builtinModPaths, ":")...)
@@ -195,7 +198,7 @@ func main() {
 
 	if result != nil && result != object.NullConst {
 		if e, ok := result.(*object.Exception); ok {
-			os.Stdout.WriteString(e.Message)
+			os.Stdout.WriteString(e.StackTrace())
 			os.Stdout.Write([]byte{'\n'})
 			os.Exit(1)
 		}
@@ -233,6 +236,7 @@ func runCompiledCode(code *compiler.CodeBlock, env *object.Environment) object.O
 		if ex, ok := err.(vm.ErrExitCode); ok {
 			os.Exit(ex.Code)
 		}
+		os.Exit(1)
 	}
 	return ret
 }
@@ -199,7 +199,7 @@ func (w *worker) run(conn net.Conn) {
 
 	if result != nil && result != object.NullConst {
 		if e, ok := result.(*object.Exception); ok {
-			os.Stderr.WriteString(e.Message)
+			os.Stderr.WriteString(e.StackTrace())
 			os.Stderr.Write([]byte{'\n'})
 		}
 	}
@@ -41,6 +41,24 @@ func (p *PrefixExpression) String() string {
 	return out.String()
 }
 
+// AwaitExpression suspends an async function until Value, a task, is finished.
+type AwaitExpression struct {
+	Token token.Token // the 'await' token
+	Value Expression
+}
+
+func (a *AwaitExpression) expressionNode()      {}
+func (a *AwaitExpression) TokenLiteral() string { return a.Token.Literal }
+func (a *AwaitExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(await ")
+	out.WriteString(a.Value.String())
+	out.WriteByte(')')
+
+	return out.String()
+}
+
 type InfixExpression struct {
 	Token    token.Token // the infix token, e.g. +, <
 	Left     Expression
@@ -110,10 +128,61 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// MatchExpression evaluates to the body of the first arm whose pattern matches Value.
+type MatchExpression struct {
+	Token token.Token // The 'match' token
+	Value Expression
+	Arms  []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("match ")
+	out.WriteString(me.Value.String())
+	out.WriteString(" {")
+	for _, arm := range me.Arms {
+		out.WriteString(arm.String())
+		out.WriteByte(';')
+	}
+	out.WriteByte('}')
+	return out.String()
+}
+
+// MatchArm is a single arm of a match expression. Pattern is a literal, a type
+// name, a class or interface, or a destructuring pattern. A nil Pattern is the
+// `_` wildcard.
+type MatchArm struct {
+	Token   token.Token // The first token of the pattern
+	Pattern Expression
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	if ma.Pattern == nil {
+		out.WriteByte('_')
+	} else {
+		out.WriteString(ma.Pattern.String())
+	}
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => {")
+	out.WriteString(ma.Body.String())
+	out.WriteByte('}')
+	return out.String()
+}
+
 type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Keywords  []*KeywordArgument
+	Optional  bool // Called with ?.(), evaluates to nil if Function is nil
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -124,17 +193,95 @@ func (ce *CallExpression) String() string {
 	for _, a := range ce.Arguments {
 		args = append(args, a.String())
 	}
+	for _, k := range ce.Keywords {
+		args = append(args, k.String())
+	}
 	out.WriteString(ce.Function.String())
+	if ce.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(")")
 	return out.String()
 }
 
+// SpreadExpression expands an array into a call's arguments or an array
+// literal, or a map into a map literal.
+type SpreadExpression struct {
+	Token token.Token // The '...' token
+	Value Expression
+}
+
+func (s *SpreadExpression) expressionNode()      {}
+func (s *SpreadExpression) TokenLiteral() string { return s.Token.Literal }
+func (s *SpreadExpression) String() string       { return "..." + s.Value.String() }
+
+// KeywordArgument is a `name: value` argument in a call expression.
+type KeywordArgument struct {
+	Token token.Token // The name token
+	Name  string
+	Value Expression
+}
+
+func (k *KeywordArgument) String() string { return k.Name + ": " + k.Value.String() }
+
+// ArrayPattern destructures an array by position. Elements are identifiers
+// or nested patterns, Rest binds any elements left over.
+type ArrayPattern struct {
+	Token    token.Token // The '[' token
+	Elements []Expression
+	Rest     *Identifier
+}
+
+func (a *ArrayPattern) expressionNode()      {}
+func (a *ArrayPattern) TokenLiteral() string { return a.Token.Literal }
+func (a *ArrayPattern) String() string {
+	elements := make([]string, len(a.Elements), len(a.Elements)+1)
+	for i, el := range a.Elements {
+		elements[i] = el.String()
+	}
+	if a.Rest != nil {
+		elements = append(elements, "..."+a.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// MapPattern destructures a map by key.
+type MapPattern struct {
+	Token   token.Token // The '{' token
+	Entries []*MapPatternEntry
+}
+
+func (m *MapPattern) expressionNode()      {}
+func (m *MapPattern) TokenLiteral() string { return m.Token.Literal }
+func (m *MapPattern) String() string {
+	entries := make([]string, len(m.Entries))
+	for i, entry := range m.Entries {
+		entries[i] = entry.String()
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// MapPatternEntry binds the value at Key to Value, an identifier or a nested pattern.
+type MapPatternEntry struct {
+	Token token.Token // The key token
+	Key   string
+	Value Expression
+}
+
+func (m *MapPatternEntry) String() string {
+	if ident, ok := m.Value.(*Identifier); ok && ident.Value == m.Key {
+		return m.Key
+	}
+	return m.Key + ": " + m.Value.String()
+}
+
 type IndexExpression struct {
-	Token token.Token // The '[' token
-	Left  Expression
-	Index Expression
+	Token    token.Token // The '[' token
+	Left     Expression
+	Index    Expression
+	Optional bool // Indexed with ?.[], evaluates to nil if Left is nil
 }
 
 func (i *IndexExpression) expressionNode()      {}
@@ -144,6 +291,9 @@ func (i *IndexExpression) String() string {
 
 	out.WriteByte('(')
 	out.WriteString(i.Left.String())
+	if i.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteByte('[')
 	out.WriteString(i.Index.String())
 	out.WriteString("])")
@@ -151,10 +301,68 @@ func (i *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression is the index of a slice such as a[1:3] or a[::2]. Omitted
+// parts are nil.
+type SliceExpression struct {
+	Token token.Token // The ':' token
+	Start Expression
+	End   Expression
+	Step  Expression
+}
+
+func (s *SliceExpression) expressionNode()      {}
+func (s *SliceExpression) TokenLiteral() string { return s.Token.Literal }
+func (s *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	if s.Start != nil {
+		out.WriteString(s.Start.String())
+	}
+	out.WriteByte(':')
+	if s.End != nil {
+		out.WriteString(s.End.String())
+	}
+	if s.Step != nil {
+		out.WriteByte(':')
+		out.WriteString(s.Step.String())
+	}
+
+	return out.String()
+}
+
+// RangeExpression creates a range of integers such as 0..10 or 0..=10 by 2.
+// Step is nil if it's omitted.
+type RangeExpression struct {
+	Token     token.Token // The '..' or '..=' token
+	Start     Expression
+	End       Expression
+	Step      Expression
+	Inclusive bool
+}
+
+func (r *RangeExpression) expressionNode()      {}
+func (r *RangeExpression) TokenLiteral() string { return r.Token.Literal }
+func (r *RangeExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteByte('(')
+	out.WriteString(r.Start.String())
+	out.WriteString(r.Token.Literal)
+	out.WriteString(r.End.String())
+	if r.Step != nil {
+		out.WriteString(" by ")
+		out.WriteString(r.Step.String())
+	}
+	out.WriteByte(')')
+
+	return out.String()
+}
+
 type AttributeExpression struct {
-	Token token.Token
-	Left  Expression
-	Index *StringLiteral
+	Token    token.Token
+	Left     Expression
+	Index    *StringLiteral
+	Optional bool // Accessed with ?., evaluates to nil if Left is nil
 }
 
 func (i *AttributeExpression) expressionNode()      {}
@@ -164,17 +372,47 @@ func (i *AttributeExpression) String() string {
 
 	out.WriteByte('(')
 	out.WriteString(i.Left.String())
-	out.WriteByte('.')
+	if i.Optional {
+		out.WriteString("?.")
+	} else {
+		out.WriteByte('.')
+	}
 	out.WriteString(i.Index.String())
 	out.WriteByte(')')
 
 	return out.String()
 }
 
+// IsOptionalChain checks if exp is an attribute access, index, or call chain
+// containing a ?. link. Such chains evaluate to nil when a ?. link's left side is nil.
+func IsOptionalChain(exp Expression) bool {
+	for {
+		switch node := exp.(type) {
+		case *AttributeExpression:
+			if node.Optional {
+				return true
+			}
+			exp = node.Left
+		case *IndexExpression:
+			if node.Optional {
+				return true
+			}
+			exp = node.Left
+		case *CallExpression:
+			if node.Optional {
+				return true
+			}
+			exp = node.Function
+		default:
+			return false
+		}
+	}
+}
+
 type TryCatchExpression struct {
-	Try    *BlockStatement
-	Catch  *BlockStatement
-	Symbol *Identifier
+	Try     *BlockStatement
+	Catches []*CatchClause
+	Finally *BlockStatement
 }
 
 func (t *TryCatchExpression) expressionNode()      {}
@@ -183,13 +421,43 @@ func (t *TryCatchExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("try {")
 	out.WriteString(t.Try.String())
-	out.WriteString("} catch ")
-	if t.Symbol != nil {
-		out.WriteString(t.Symbol.String())
+	out.WriteByte('}')
+	for _, c := range t.Catches {
+		out.WriteByte(' ')
+		out.WriteString(c.String())
+	}
+	if t.Finally != nil {
+		out.WriteString(" finally {")
+		out.WriteString(t.Finally.String())
+		out.WriteByte('}')
+	}
+	return out.String()
+}
+
+// CatchClause is a single catch block of a try expression. Symbol and Class
+// are optional, a clause without a Class catches any exception.
+type CatchClause struct {
+	Token  token.Token
+	Symbol *Identifier
+	Class  Expression
+	Body   *BlockStatement
+}
+
+func (c *CatchClause) TokenLiteral() string { return c.Token.Literal }
+func (c *CatchClause) String() string {
+	var out bytes.Buffer
+	out.WriteString("catch ")
+	if c.Symbol != nil {
+		out.WriteString(c.Symbol.String())
+		out.WriteByte(' ')
+	}
+	if c.Class != nil {
+		out.WriteString("^ ")
+		out.WriteString(c.Class.String())
 		out.WriteByte(' ')
 	}
 	out.WriteByte('{')
-	out.WriteString(t.Catch.String())
+	out.WriteString(c.Body.String())
 	out.WriteByte('}')
 	return out.String()
 }
@@ -198,6 +466,7 @@ type NewInstance struct {
 	Token     token.Token
 	Class     Expression
 	Arguments []Expression
+	Keywords  []*KeywordArgument
 }
 
 func (m *NewInstance) expressionNode()      {}
@@ -207,6 +476,9 @@ func (m *NewInstance) String() string {
 	for i, a := range m.Arguments {
 		args[i] = a.String()
 	}
+	for _, k := range m.Keywords {
+		args = append(args, k.String())
+	}
 	return fmt.Sprintf("new %s(%s)", m.Class, strings.Join(args, ", "))
 }
 
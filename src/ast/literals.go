@@ -43,6 +43,29 @@ func (s *StringLiteral) expressionNode()      {}
 func (s *StringLiteral) TokenLiteral() string { return s.Token.Literal }
 func (s *StringLiteral) String() string       { return string(s.Value) }
 
+// InterpolatedString is a string literal with embedded expressions. Parts
+// alternates between StringLiterals and the embedded expressions.
+type InterpolatedString struct {
+	Token token.Token // The string start token
+	Parts []Expression
+}
+
+func (s *InterpolatedString) expressionNode()      {}
+func (s *InterpolatedString) TokenLiteral() string { return s.Token.Literal }
+func (s *InterpolatedString) String() string {
+	var out bytes.Buffer
+	for _, part := range s.Parts {
+		if str, ok := part.(*StringLiteral); ok {
+			out.WriteString(str.String())
+			continue
+		}
+		out.WriteByte('{')
+		out.WriteString(part.String())
+		out.WriteByte('}')
+	}
+	return out.String()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -57,7 +80,11 @@ type FunctionLiteral struct {
 	Name       string
 	FQName     string
 	Native     bool
+	Async      bool
 	Parameters []*Identifier
+	Defaults   []Expression // Default value of each parameter, nil if it's required
+	Patterns   []Expression // Destructuring pattern of each parameter, nil for a plain name
+	Rest       *Identifier  // Collects any extra arguments, nil if not declared
 	Body       *BlockStatement
 }
 
@@ -66,10 +93,20 @@ func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range fl.Parameters {
+	for i, p := range fl.Parameters {
+		if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+fl.Defaults[i].String())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
 
+	if fl.Async {
+		out.WriteString("async ")
+	}
 	out.WriteString(fl.TokenLiteral())
 	out.WriteByte(' ')
 	out.WriteString(fl.Name)
@@ -104,8 +141,9 @@ func (a *Array) String() string {
 }
 
 type HashLiteral struct {
-	Token token.Token // the '{' token
-	Pairs map[Expression]Expression
+	Token   token.Token // the '{' token
+	Pairs   map[Expression]Expression
+	Spreads []*SpreadExpression // Maps merged in before Pairs are set
 }
 
 func (h *HashLiteral) expressionNode()      {}
@@ -114,6 +152,9 @@ func (h *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
+	for _, spread := range h.Spreads {
+		pairs = append(pairs, spread.String())
+	}
 	for key, value := range h.Pairs {
 		pairs = append(pairs, key.String()+": "+value.String())
 	}
@@ -130,6 +171,11 @@ type ClassLiteral struct {
 	Parent  string
 	Fields  []*DefStatement
 	Methods map[string]*FunctionLiteral
+	Statics []*DefStatement             // Static fields and methods, defined once on the class
+	Getters map[string]*FunctionLiteral // Property accessors
+	Setters map[string]*FunctionLiteral
+	Private map[string]bool // Members declared with the private keyword
+	Traits  []*TraitUse
 }
 
 func (c *ClassLiteral) expressionNode()      {}
@@ -138,6 +184,46 @@ func (c *ClassLiteral) String() string {
 	return fmt.Sprintf("class %s ^ %s {...}", c.Name, c.Parent)
 }
 
+// TraitUse is a trait composed into a class. Aliases renames methods of the
+// trait, the keys are the names defined by the trait.
+type TraitUse struct {
+	Name    string
+	Aliases map[string]string
+}
+
+type TraitLiteral struct {
+	Token   token.Token
+	Name    string
+	Fields  []*DefStatement
+	Methods map[string]*FunctionLiteral
+}
+
+func (t *TraitLiteral) expressionNode()      {}
+func (t *TraitLiteral) TokenLiteral() string { return "trait" }
+func (t *TraitLiteral) String() string {
+	return fmt.Sprintf("trait %s {...}", t.Name)
+}
+
+// EnumLiteral declares an enum type, Members are in declaration order.
+type EnumLiteral struct {
+	Token   token.Token
+	Name    string
+	Members []*EnumMemberDef
+}
+
+// EnumMemberDef is a member of an enum. Fields names the values carried by
+// the member, it's nil if the member doesn't carry any.
+type EnumMemberDef struct {
+	Name   string
+	Fields []string
+}
+
+func (e *EnumLiteral) expressionNode()      {}
+func (e *EnumLiteral) TokenLiteral() string { return "enum" }
+func (e *EnumLiteral) String() string {
+	return fmt.Sprintf("enum %s {...}", e.Name)
+}
+
 type IfaceMethodDef struct {
 	Name   string
 	Params []string
@@ -36,10 +36,11 @@ func (p *Program) String() string {
 }
 
 type DefStatement struct {
-	Token token.Token // the token.DEF token
-	Const bool
-	Name  *Identifier
-	Value Expression
+	Token   token.Token // the token.DEF token
+	Const   bool
+	Name    *Identifier
+	Pattern Expression // Set instead of Name when the value is destructured
+	Value   Expression
 }
 
 func (d *DefStatement) statementNode()       {}
@@ -56,7 +57,11 @@ func (d *DefStatement) String() string {
 	} else {
 		out.WriteString("let ")
 	}
-	out.WriteString(d.Name.String())
+	if d.Pattern != nil {
+		out.WriteString(d.Pattern.String())
+	} else {
+		out.WriteString(d.Name.String())
+	}
 	out.WriteString(" = ")
 	if d.Value != nil {
 		out.WriteString(d.Value.String())
@@ -129,6 +134,26 @@ func (r *ReturnStatement) String() string {
 	return out.String()
 }
 
+// YieldStatement suspends a generator function and gives Value to the caller.
+type YieldStatement struct {
+	Token token.Token // the 'yield' token
+	Value Expression
+}
+
+func (y *YieldStatement) statementNode()       {}
+func (y *YieldStatement) TokenLiteral() string { return y.Token.Literal }
+func (y *YieldStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("yield ")
+	if y.Value != nil {
+		out.WriteString(y.Value.String())
+	}
+	out.WriteByte(';')
+
+	return out.String()
+}
+
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression
 	Expression Expression
@@ -169,10 +194,12 @@ func (bs *BlockStatement) String() string {
 
 type LoopStatement struct {
 	Token     token.Token
+	Label     *Identifier
 	Init      *DefStatement
 	Condition Expression
 	Iter      Node
 	Body      *BlockStatement
+	Else      *BlockStatement // Ran when the loop ends without a break
 }
 
 func (fl *LoopStatement) statementNode() {}
@@ -184,6 +211,7 @@ func (fl *LoopStatement) TokenLiteral() string {
 }
 func (fl *LoopStatement) String() string {
 	var out bytes.Buffer
+	writeLoopLabel(&out, fl.Label)
 	out.WriteString(fl.TokenLiteral())
 	out.WriteByte(' ')
 	if fl.Init != nil {
@@ -198,15 +226,19 @@ func (fl *LoopStatement) String() string {
 	out.WriteString(" { ")
 	out.WriteString(fl.Body.String())
 	out.WriteString(" }")
+	writeLoopElse(&out, fl.Else)
 	return out.String()
 }
 
 type IterLoopStatement struct {
-	Token token.Token
-	Key   *Identifier
-	Value *Identifier
-	Iter  Expression
-	Body  *BlockStatement
+	Token   token.Token
+	Label   *Identifier
+	Key     *Identifier
+	Value   *Identifier
+	Pattern Expression // Set instead of Value when the value is destructured
+	Iter    Expression
+	Body    *BlockStatement
+	Else    *BlockStatement // Ran when the loop ends without a break
 }
 
 func (fl *IterLoopStatement) statementNode()       {}
@@ -214,6 +246,7 @@ func (fl *IterLoopStatement) TokenLiteral() string { return "for" }
 func (fl *IterLoopStatement) String() string {
 	var out bytes.Buffer
 
+	writeLoopLabel(&out, fl.Label)
 	out.WriteString("for ")
 
 	if fl.Key != nil {
@@ -221,31 +254,66 @@ func (fl *IterLoopStatement) String() string {
 		out.WriteString(", ")
 	}
 
-	out.WriteString(fl.Value.String())
+	if fl.Pattern != nil {
+		out.WriteString(fl.Pattern.String())
+	} else {
+		out.WriteString(fl.Value.String())
+	}
 	out.WriteString(" in ")
 	out.WriteString(fl.Iter.String())
 
 	out.WriteString(" { ")
 	out.WriteString(fl.Body.String())
 	out.WriteString(" }")
+	writeLoopElse(&out, fl.Else)
 	return out.String()
 }
 
+func writeLoopLabel(out *bytes.Buffer, label *Identifier) {
+	if label != nil {
+		out.WriteString(label.Value)
+		out.WriteString(": ")
+	}
+}
+
+func writeLoopElse(out *bytes.Buffer, block *BlockStatement) {
+	if block != nil {
+		out.WriteString(" else { ")
+		out.WriteString(block.String())
+		out.WriteString(" }")
+	}
+}
+
+// ContinueStatement starts the next iteration of the innermost loop, or of
+// the loop named by Label.
 type ContinueStatement struct {
 	Token token.Token
+	Label *Identifier
 }
 
 func (c *ContinueStatement) statementNode()       {}
 func (c *ContinueStatement) TokenLiteral() string { return "continue" }
-func (c *ContinueStatement) String() string       { return "continue" }
+func (c *ContinueStatement) String() string {
+	if c.Label != nil {
+		return "continue " + c.Label.Value
+	}
+	return "continue"
+}
 
+// BreakStatement ends the innermost loop, or the loop named by Label.
 type BreakStatement struct {
 	Token token.Token
+	Label *Identifier
 }
 
 func (b *BreakStatement) statementNode()       {}
 func (b *BreakStatement) TokenLiteral() string { return "break" }
-func (b *BreakStatement) String() string       { return "break" }
+func (b *BreakStatement) String() string {
+	if b.Label != nil {
+		return "break " + b.Label.Value
+	}
+	return "break"
+}
 
 type ThrowStatement struct {
 	Token      token.Token
@@ -256,6 +324,42 @@ func (t *ThrowStatement) statementNode()       {}
 func (t *ThrowStatement) TokenLiteral() string { return "throw" }
 func (t *ThrowStatement) String() string       { return "throw" }
 
+// DeferStatement delays evaluating Expression until the function it's in
+// returns or is left by an exception.
+type DeferStatement struct {
+	Token      token.Token
+	Expression Expression
+}
+
+func (d *DeferStatement) statementNode()       {}
+func (d *DeferStatement) TokenLiteral() string { return "defer" }
+func (d *DeferStatement) String() string       { return "defer " + d.Expression.String() }
+
+// WithStatement runs Body between calls to the _enter and _exit methods of
+// Value. Name is bound to the result of _enter if it's given.
+type WithStatement struct {
+	Token token.Token
+	Value Expression
+	Name  *Identifier
+	Body  *BlockStatement
+}
+
+func (w *WithStatement) statementNode()       {}
+func (w *WithStatement) TokenLiteral() string { return "with" }
+func (w *WithStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("with ")
+	out.WriteString(w.Value.String())
+	if w.Name != nil {
+		out.WriteString(" as ")
+		out.WriteString(w.Name.String())
+	}
+	out.WriteString(" { ")
+	out.WriteString(w.Body.String())
+	out.WriteString(" }")
+	return out.String()
+}
+
 type PassStatement struct {
 	Token token.Token
 }
@@ -23,7 +23,7 @@ func init() {
 	vm.RegisterBuiltin("hashMerge", hashMergeBuiltin)
 	vm.RegisterBuiltin("hashKeys", hashKeysBuiltin)
 	vm.RegisterBuiltin("hasKey", hasKeyBuiltin)
-	vm.RegisterBuiltin("range", rangeIterBuiltin)
+	vm.RegisterBuiltin("range", rangeBuiltin)
 }
 
 func lenBuiltin(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
@@ -40,6 +40,20 @@ func lenBuiltin(interpreter object.Interpreter, env *object.Environment, args ..
 		return object.MakeIntObj(int64(len(arg.Pairs)))
 	case *object.Null:
 		return object.MakeIntObj(0)
+	case *object.Enum:
+		return object.MakeIntObj(int64(len(arg.Members)))
+	case *object.Range:
+		length, err := arg.Len()
+		if err != nil {
+			return object.NewException("len(): %s", err)
+		}
+		return object.MakeIntObj(length)
+	case *vm.VMInstance:
+		if method := arg.GetBoundMethod("_len"); method != nil {
+			machine := interpreter.(*vm.VirtualMachine)
+			machine.CallFunction(0, method, true, nil, false)
+			return machine.PopStack()
+		}
 	}
 
 	return object.NewException("len(): Unsupported type %s", args[0].Type())
@@ -319,79 +333,16 @@ func hasKeyBuiltin(interpreter object.Interpreter, env *object.Environment, args
 		return object.NewException("hasKey arg 1 expects a hash map")
 	}
 
-	key, ok := args[1].(object.Hashable)
+	key, ok := interpreter.(*vm.VirtualMachine).HashKey(args[1])
 	if !ok {
 		return object.NewException("hasKey arg 2 expects a valid hash key")
 	}
 
-	_, has := hash.Pairs[key.HashKey()]
+	_, has := hash.Pairs[key]
 	return object.NativeBoolToBooleanObj(has)
 }
 
-var rangeIterator = &vm.BuiltinClass{
-	Fields: map[string]object.Object{
-		"start": object.NullConst,
-		"end":   object.NullConst,
-		"step":  object.NullConst,
-		"i":     object.NullConst,
-	},
-	VMClass: &vm.VMClass{
-		Name:   "rangeIterator",
-		Parent: nil,
-		Methods: map[string]object.ClassMethod{
-			"_next": vm.MakeBuiltinMethod(rangeIteratorNext, 0),
-			"_iter": vm.MakeBuiltinMethod(rangeIteratorIter, 0),
-		},
-	},
-}
-
-func rangeIteratorNext(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
-	selfEndObj, _ := self.Fields.Get("end")
-	selfStepObj, _ := self.Fields.Get("step")
-	selfNextObj, _ := self.Fields.Get("next")
-	selfIndexObj, _ := self.Fields.Get("i")
-
-	selfEnd := selfEndObj.(*object.Integer)
-	selfStep := selfStepObj.(*object.Integer)
-	selfNext := selfNextObj.(*object.Integer)
-	selfIndex := selfIndexObj.(*object.Integer)
-
-	if selfNext.Value >= selfEnd.Value {
-		return object.NullConst
-	}
-
-	idx := selfIndex.Value
-	next := selfNext.Value
-
-	self.Fields.Set("i", object.MakeIntObj(selfIndex.Value+1))
-	self.Fields.Set("next", object.MakeIntObj(selfNext.Value+selfStep.Value))
-
-	return &object.Array{
-		Elements: []object.Object{
-			object.MakeIntObj(idx),
-			object.MakeIntObj(next),
-		},
-	}
-}
-
-func rangeIteratorIter(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
-	return self
-}
-
-func makeRangeIter(start, end, step int64) *vm.VMInstance {
-	env := object.NewEnvironment()
-	env.SetForce("next", object.MakeIntObj(start), false)
-	env.SetForce("end", object.MakeIntObj(end), false)
-	env.SetForce("step", object.MakeIntObj(step), false)
-	env.SetForce("i", object.MakeIntObj(0), false)
-
-	return &vm.VMInstance{
-		Class:  rangeIterator.VMClass,
-		Fields: env,
-	}
-}
-
-func rangeIterBuiltin(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
+func rangeBuiltin(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
 	var start int64
 	var end int64
 	var step int64 = 1
@@ -436,5 +387,8 @@ func rangeIterBuiltin(interpreter object.Interpreter, env *object.Environment, a
 		return object.NewException("ranged expects between 1 - 3 arguments, got %d", len(args))
 	}
 
-	return makeRangeIter(start, end, step)
+	if step == 0 {
+		return object.NewException("range step cannot be zero")
+	}
+	return &object.Range{Start: start, End: end, Step: step}
 }
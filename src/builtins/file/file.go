@@ -19,12 +19,13 @@ func init() {
 	vm.RegisterModule(moduleName, &object.Module{
 		Name: moduleName,
 		Methods: map[string]object.BuiltinFunction{
-			"readFile": readFullFile,
-			"remove":   deleteFile,
-			"exists":   fileExists,
-			"rename":   renameFile,
-			"dirlist":  directoryList,
-			"isdir":    isDirectory,
+			"readFile":      readFullFile,
+			"readFileAsync": readFullFileAsync,
+			"remove":        deleteFile,
+			"exists":        fileExists,
+			"rename":        renameFile,
+			"dirlist":       directoryList,
+			"isdir":         isDirectory,
 		},
 		Vars: map[string]object.Object{
 			"name": object.MakeStringObj(moduleName),
@@ -42,6 +43,8 @@ func init() {
 						"readChar": vm.MakeBuiltinMethod(vmFileReadChar, 0),
 						"remove":   vm.MakeBuiltinMethod(vmFileDeleteFile, 0),
 						"rename":   vm.MakeBuiltinMethod(vmFileRenameFile, 1),
+						"_enter":   vm.MakeBuiltinMethod(vmFileEnter, 0),
+						"_exit":    vm.MakeBuiltinMethod(vmFileExit, 1),
 					},
 				},
 			},
@@ -87,6 +90,27 @@ func readFullFile(interpreter object.Interpreter, env *object.Environment, args
 	return object.MakeStringObj(string(file))
 }
 
+// readFullFileAsync returns a task that finishes with the file's contents.
+func readFullFileAsync(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
+	if ac := moduleutils.CheckArgs("readFileAsync", 1, args...); ac != nil {
+		return ac
+	}
+
+	filepath, ok := args[0].(*object.String)
+	if !ok {
+		return object.NewException("readFileAsync expected a string, got %s", args[0].Type().String())
+	}
+
+	path := filepath.String()
+	return interpreter.(*vm.VirtualMachine).StartTask(func() object.Object {
+		file, err := ioutil.ReadFile(path)
+		if err != nil {
+			return object.NewException("Error reading file %s", err.Error())
+		}
+		return object.MakeStringObj(string(file))
+	})
+}
+
 func deleteFile(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
 	if ac := moduleutils.CheckArgs("deleteFile", 1, args...); ac != nil {
 		return ac
@@ -166,7 +190,7 @@ func directoryList(interpreter object.Interpreter, env *object.Environment, args
 
 	dirlist, err := file.Readdirnames(0)
 	if err != nil {
-		return object.NewException("Error reading directory list %s %s", filepath.Value, err.Error())
+		return object.NewException("Error reading directory list %s %s", filepath.String(), err.Error())
 	}
 	return object.MakeStringArray(dirlist)
 }
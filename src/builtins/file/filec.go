@@ -68,6 +68,21 @@ func vmFileCloseFile(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *o
 	return object.NullConst
 }
 
+func vmFileEnter(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	return self
+}
+
+// vmFileExit closes the file when a with block using it is left. Unlike close
+// it doesn't complain if the file was already closed in the block.
+func vmFileExit(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	res, _ := self.Fields.Get("res")
+	if file, ok := res.(*fileResource); ok {
+		file.file.Close()
+		self.Fields.SetForce("res", object.NullConst, true)
+	}
+	return nil
+}
+
 func vmFileWriteFile(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
 	if ac := moduleutils.CheckArgs("writeFile", 1, args...); ac != nil {
 		return ac
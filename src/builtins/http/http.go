@@ -13,6 +13,7 @@ import (
 
 func init() {
 	vm.RegisterNative("std.http.doReq", doReq)
+	vm.RegisterNative("std.http.doReqAsync", doReqAsync)
 	vm.RegisterNative("std.http.canonicalHeaderKey", canonicalHeaderKey)
 }
 
@@ -21,10 +22,34 @@ func doReq(interpreter object.Interpreter, env *object.Environment, args ...obje
 		return ac
 	}
 
+	client, req, exc := makeRequest(args)
+	if exc != nil {
+		return exc
+	}
+	return sendRequest(client, req)
+}
+
+// doReqAsync sends the request on another goroutine and returns a task that
+// finishes with the response.
+func doReqAsync(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
+	if ac := moduleutils.CheckMinArgs("http.doReqAsync", 2, args...); ac != nil {
+		return ac
+	}
+
+	client, req, exc := makeRequest(args)
+	if exc != nil {
+		return exc
+	}
+	return interpreter.(*vm.VirtualMachine).StartTask(func() object.Object {
+		return sendRequest(client, req)
+	})
+}
+
+func makeRequest(args []object.Object) (*http.Client, *http.Request, object.Object) {
 	// Argument 1 - HTTP method
 	methodObj, ok := args[0].(*object.String)
 	if !ok {
-		return object.NewException("http.doReq expected first argument to be a string, got %s", args[0].Type().String())
+		return nil, nil, object.NewException("http.doReq expected first argument to be a string, got %s", args[0].Type().String())
 	}
 	method := strings.ToUpper(methodObj.String())
 	if method == "" {
@@ -34,12 +59,12 @@ func doReq(interpreter object.Interpreter, env *object.Environment, args ...obje
 	// Argument 2 - URL
 	urlObj, ok := args[1].(*object.String)
 	if !ok {
-		return object.NewException("http.doReq expected second argument to be a string, got %s", args[1].Type().String())
+		return nil, nil, object.NewException("http.doReq expected second argument to be a string, got %s", args[1].Type().String())
 	}
 
 	url := strings.TrimSpace(urlObj.String())
 	if url == "" {
-		return object.NewException("http.doReq expected a non-empty string")
+		return nil, nil, object.NewException("http.doReq expected a non-empty string")
 	}
 
 	// Argument 3 - Data payload
@@ -47,7 +72,7 @@ func doReq(interpreter object.Interpreter, env *object.Environment, args ...obje
 	if len(args) >= 3 && args[2] != object.NullConst {
 		dataObj, ok := args[2].(*object.String)
 		if !ok {
-			return object.NewException("http.doReq expected third argument to be a string, got %s", args[2].Type().String())
+			return nil, nil, object.NewException("http.doReq expected third argument to be a string, got %s", args[2].Type().String())
 		}
 		data = dataObj.String()
 	}
@@ -57,7 +82,7 @@ func doReq(interpreter object.Interpreter, env *object.Environment, args ...obje
 	if len(args) >= 4 && args[3] != object.NullConst {
 		dataObj, ok := args[3].(*object.Hash)
 		if !ok {
-			return object.NewException("http.post expected fourth argument to be a map, got %s", args[3].Type().String())
+			return nil, nil, object.NewException("http.post expected fourth argument to be a map, got %s", args[3].Type().String())
 		}
 		optionsObj = dataObj
 	}
@@ -66,7 +91,7 @@ func doReq(interpreter object.Interpreter, env *object.Environment, args ...obje
 
 	req, err := http.NewRequest(method, url, strings.NewReader(data))
 	if err != nil {
-		return object.NewException("error making HTTP request: %s", err.Error())
+		return nil, nil, object.NewException("error making HTTP request: %s", err.Error())
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
@@ -75,7 +100,7 @@ func doReq(interpreter object.Interpreter, env *object.Environment, args ...obje
 		if headers != nil {
 			headersMap, ok := headers.(*object.Hash)
 			if !ok {
-				return object.NewException("headers option must be a map")
+				return nil, nil, object.NewException("headers option must be a map")
 			}
 
 			for _, pair := range headersMap.Pairs {
@@ -93,7 +118,7 @@ func doReq(interpreter object.Interpreter, env *object.Environment, args ...obje
 		if tlsVerify != nil {
 			verifyBool, ok := tlsVerify.(*object.Boolean)
 			if !ok {
-				return object.NewException("tls_verify option must be a boolean")
+				return nil, nil, object.NewException("tls_verify option must be a boolean")
 			}
 
 			if !verifyBool.Value {
@@ -106,6 +131,10 @@ func doReq(interpreter object.Interpreter, env *object.Environment, args ...obje
 		}
 	}
 
+	return client, req, nil
+}
+
+func sendRequest(client *http.Client, req *http.Request) object.Object {
 	resp, err := client.Do(req)
 
 	if err != nil {
@@ -49,18 +49,9 @@ func exitScript(interpreter object.Interpreter, env *object.Environment, args ..
 
 func printBuiltin(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
 	out := interpreter.GetStdout()
+	machine := interpreter.(*vm.VirtualMachine)
 	for _, arg := range args {
-		if instance, ok := arg.(*vm.VMInstance); ok {
-			machine := interpreter.(*vm.VirtualMachine)
-			toString := instance.GetBoundMethod("toString")
-			if toString != nil {
-				machine.CallFunction(0, toString, true, nil, false)
-				printBuiltin(interpreter, env, machine.PopStack())
-				continue
-			}
-		}
-
-		fmt.Fprint(out, arg.Inspect())
+		fmt.Fprint(out, machine.ObjectToString(arg))
 	}
 	return object.NullConst
 }
@@ -72,18 +63,9 @@ func printlnBuiltin(interpreter object.Interpreter, env *object.Environment, arg
 }
 
 func printerrBuiltin(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
+	machine := interpreter.(*vm.VirtualMachine)
 	for _, arg := range args {
-		if instance, ok := arg.(*vm.VMInstance); ok {
-			machine := interpreter.(*vm.VirtualMachine)
-			toString := instance.GetBoundMethod("toString")
-			if toString != nil {
-				machine.CallFunction(0, toString, true, nil, false)
-				printBuiltin(interpreter, env, machine.PopStack())
-				continue
-			}
-		}
-
-		fmt.Fprint(interpreter.GetStderr(), arg.Inspect())
+		fmt.Fprint(interpreter.GetStderr(), machine.ObjectToString(arg))
 	}
 	return object.NullConst
 }
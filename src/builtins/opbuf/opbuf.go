@@ -25,7 +25,22 @@ func init() {
 			"stop":       stop,
 			"isStarted":  isStarted,
 		},
-		Vars: map[string]object.Object{},
+		Vars: map[string]object.Object{
+			"Buffer": &vm.BuiltinClass{
+				Fields: map[string]object.Object{
+					"output": object.NullConst,
+				},
+				VMClass: &vm.VMClass{
+					Name:   "Buffer",
+					Parent: nil,
+					Methods: map[string]object.ClassMethod{
+						"get":    vm.MakeBuiltinMethod(vmBufferGet, 0),
+						"_enter": vm.MakeBuiltinMethod(vmBufferEnter, 0),
+						"_exit":  vm.MakeBuiltinMethod(vmBufferExit, 1),
+					},
+				},
+			},
+		},
 	})
 }
 
@@ -115,3 +130,29 @@ func isStarted(interpreter object.Interpreter, env *object.Environment, args ...
 	theVM := interpreter.(*vm.VirtualMachine)
 	return object.NativeBoolToBooleanObj(theVM.HasInstanceVar(instanceVarName))
 }
+
+// vmBufferEnter starts output buffering for a with block.
+func vmBufferEnter(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	if exc := start(interpreter, env); exc != nil {
+		return exc
+	}
+	return self
+}
+
+// vmBufferExit stops output buffering and keeps what was captured.
+func vmBufferExit(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	out := stopAndGet(interpreter, env)
+	if object.ObjectIs(out, object.ExceptionObj) {
+		return out
+	}
+
+	self.Fields.SetForce("output", out, false)
+	return nil
+}
+
+func vmBufferGet(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	if out, ok := self.Fields.Get("output"); ok && out != object.NullConst {
+		return out
+	}
+	return get(interpreter, env)
+}
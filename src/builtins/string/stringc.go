@@ -156,25 +156,13 @@ func vmStrFormat(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *objec
 			break
 		}
 
-		s := objectToString(arg, interpreter)
+		s := interpreter.ObjectToString(arg)
 		t = strings.Replace(t, "{}", s, 1)
 	}
 
 	return object.MakeStringObj(t)
 }
 
-func objectToString(obj object.Object, machine *vm.VirtualMachine) string {
-	if instance, ok := obj.(*vm.VMInstance); ok {
-		toString := instance.GetBoundMethod("toString")
-		if toString != nil {
-			machine.CallFunction(0, toString, true, nil, false)
-			return objectToString(machine.PopStack(), machine)
-		}
-	}
-
-	return obj.Inspect()
-}
-
 func vmStrContains(interpreter *vm.VirtualMachine, self *vm.VMInstance, env *object.Environment, args ...object.Object) object.Object {
 	if ac := moduleutils.CheckArgs("contains", 1, args...); ac != nil {
 		return ac
@@ -83,7 +83,7 @@ func strFormat(interpreter object.Interpreter, env *object.Environment, args ...
 			break
 		}
 
-		s := objectToString(arg, interpreter.(*vm.VirtualMachine))
+		s := interpreter.(*vm.VirtualMachine).ObjectToString(arg)
 		t = strings.Replace(t, "{}", s, 1)
 	}
 
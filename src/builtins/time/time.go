@@ -14,9 +14,11 @@ func init() {
 	vm.RegisterModule(moduleName, &object.Module{
 		Name: moduleName,
 		Methods: map[string]object.BuiltinFunction{
-			"now":    timeNowS,
-			"now_ms": timeNowMs,
-			"now_ns": timeNowNs,
+			"now":        timeNowS,
+			"now_ms":     timeNowMs,
+			"now_ns":     timeNowNs,
+			"sleep":      timeSleep,
+			"sleepAsync": timeSleepAsync,
 		},
 	})
 }
@@ -44,3 +46,39 @@ func timeNowNs(interpreter object.Interpreter, env *object.Environment, args ...
 
 	return object.MakeIntObj(time.Now().UnixNano())
 }
+
+// timeSleep blocks for the given number of milliseconds.
+func timeSleep(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
+	duration, exc := sleepDuration("sleep", args)
+	if exc != nil {
+		return exc
+	}
+
+	time.Sleep(duration)
+	return object.NullConst
+}
+
+// timeSleepAsync returns a task that finishes after the given number of milliseconds.
+func timeSleepAsync(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
+	duration, exc := sleepDuration("sleepAsync", args)
+	if exc != nil {
+		return exc
+	}
+
+	return interpreter.(*vm.VirtualMachine).StartTask(func() object.Object {
+		time.Sleep(duration)
+		return object.NullConst
+	})
+}
+
+func sleepDuration(name string, args []object.Object) (time.Duration, object.Object) {
+	if ac := moduleutils.CheckArgs(name, 1, args...); ac != nil {
+		return 0, ac
+	}
+
+	ms, ok := args[0].(*object.Integer)
+	if !ok {
+		return 0, object.NewException("%s expected an int, got %s", name, args[0].Type().String())
+	}
+	return time.Duration(ms.Value) * time.Millisecond, nil
+}
@@ -1,6 +1,8 @@
 package typing
 
 import (
+	"math"
+	"math/big"
 	"strconv"
 
 	"github.com/nitrogen-lang/nitrogen/src/moduleutils"
@@ -20,7 +22,7 @@ func init() {
 	vm.RegisterBuiltin("varType", varTypeBuiltin)
 	vm.RegisterBuiltin("isDefined", isDefinedBuiltin)
 	vm.RegisterBuiltin("isFloat", makeIsTypeBuiltin(object.FloatObj))
-	vm.RegisterBuiltin("isInt", makeIsTypeBuiltin(object.IntergerObj))
+	vm.RegisterBuiltin("isInt", makeIsTypeBuiltin(object.IntergerObj, object.BigIntObj))
 	vm.RegisterBuiltin("isBool", makeIsTypeBuiltin(object.BooleanObj))
 	vm.RegisterBuiltin("isNull", makeIsTypeBuiltin(object.NullObj))
 	vm.RegisterBuiltin("isNil", makeIsTypeBuiltin(object.NullObj))
@@ -43,10 +45,17 @@ func toIntBuiltin(interpreter object.Interpreter, env *object.Environment, args
 	}
 
 	switch arg := args[0].(type) {
-	case *object.Integer:
+	case *object.Integer, *object.BigInt:
 		return arg
 	case *object.Float:
-		return object.MakeIntObj(int64(arg.Value))
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return object.NewException("Cannot convert %s to an integer", arg.Inspect())
+		}
+		if arg.Value >= math.MinInt64 && arg.Value < math.MaxInt64 {
+			return object.MakeIntObj(int64(arg.Value))
+		}
+		i, _ := big.NewFloat(arg.Value).Int(nil)
+		return object.MakeBigIntObj(i)
 	}
 
 	return object.NewException("Argument to `toInt` must be FLOAT or INT, got %s", args[0].Type())
@@ -60,6 +69,9 @@ func toFloatBuiltin(interpreter object.Interpreter, env *object.Environment, arg
 	switch arg := args[0].(type) {
 	case *object.Integer:
 		return &object.Float{Value: float64(arg.Value)}
+	case *object.BigInt:
+		f, _ := new(big.Float).SetInt(arg.Value).Float64()
+		return &object.Float{Value: f}
 	case *object.Float:
 		return arg
 	}
@@ -67,13 +79,18 @@ func toFloatBuiltin(interpreter object.Interpreter, env *object.Environment, arg
 	return object.NewException("Argument to `toFloat` must be FLOAT or INT, got %s", args[0].Type())
 }
 
-func makeIsTypeBuiltin(t object.ObjectType) object.BuiltinFunction {
+func makeIsTypeBuiltin(types ...object.ObjectType) object.BuiltinFunction {
 	return func(interpreter object.Interpreter, env *object.Environment, args ...object.Object) object.Object {
 		if len(args) != 1 {
 			return object.NewException("Type check requires one argument. Got %d", len(args))
 		}
 
-		return object.NativeBoolToBooleanObj(args[0].Type() == t)
+		for _, t := range types {
+			if args[0].Type() == t {
+				return object.TrueConst
+			}
+		}
+		return object.FalseConst
 	}
 }
 
@@ -135,6 +152,8 @@ func toStringBuiltin(interpreter object.Interpreter, env *object.Environment, ar
 		converted = strconv.FormatBool(arg.Value)
 	case *object.Null:
 		converted = "nil"
+	case *vm.VMInstance:
+		converted = interpreter.(*vm.VirtualMachine).ObjectToString(arg)
 	default:
 		converted = arg.Inspect()
 	}
@@ -154,6 +173,10 @@ func parseIntBuiltin(interpreter object.Interpreter, env *object.Environment, ar
 
 	i, err := strconv.ParseInt(str.String(), 10, 64)
 	if err != nil {
+		// Numbers too large for an int64 become big integers
+		if bi, ok := new(big.Int).SetString(str.String(), 10); ok {
+			return object.MakeBigIntObj(bi)
+		}
 		return object.NullConst
 	}
 
@@ -188,6 +211,5 @@ func isDefinedBuiltin(interpreter object.Interpreter, env *object.Environment, a
 		return object.NewException("isDefined expects a string, got %s", args[0].Type().String())
 	}
 
-	_, ok = env.Get(ident.String())
-	return object.NativeBoolToBooleanObj(ok)
+	return object.NativeBoolToBooleanObj(interpreter.(*vm.VirtualMachine).IsDefined(env, ident.String()))
 }
@@ -2,6 +2,8 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
+	"sync/atomic"
 
 	"github.com/nitrogen-lang/nitrogen/src/ast"
 	"github.com/nitrogen-lang/nitrogen/src/object"
@@ -10,13 +12,90 @@ import (
 )
 
 func compileClassLiteral(ccb *codeBlockCompiler, class *ast.ClassLiteral) {
-	ccb.linenum = class.Token.Pos.Line
+	ccb.pos = class.Token.Pos
 
 	for _, f := range class.Methods {
 		f.FQName = fmt.Sprintf("%s.%s", class.Name, f.Name)
 		compileFunction(ccb, f, true, class.Parent != "")
 	}
 
+	compileAccessors(ccb, class, class.Getters)
+	compileAccessors(ccb, class, class.Setters)
+
+	if len(class.Statics) == 0 {
+		compileLoadNull(ccb)
+	} else {
+		for _, def := range class.Statics {
+			if fn, ok := def.Value.(*ast.FunctionLiteral); ok {
+				fn.FQName = fmt.Sprintf("%s.%s", class.Name, fn.Name)
+			}
+		}
+		statics := compileClassBlock(ccb, fmt.Sprintf("%s.__static", class.Name), class.Statics)
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(statics))
+	}
+
+	private := privateMembers(class)
+	for _, name := range private {
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(name)))
+	}
+	ccb.code.addInst(opcode.MakeArray, ccb.pos, uint32(len(private)))
+
+	props := compileClassBlock(ccb, fmt.Sprintf("%s.__init", class.Name), class.Fields)
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(props))
+
+	if class.Parent == "" {
+		compileLoadNull(ccb)
+	} else {
+		compile(ccb, &ast.Identifier{Value: class.Parent})
+	}
+
+	compileTraitUses(ccb, class)
+
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(class.Name)))
+	ccb.code.addInst(opcode.BuildClass, ccb.pos, uint32(len(class.Methods)))
+}
+
+// compileTraitUses compiles the traits used by a class into an array of
+// pairs of the trait and a map of its method aliases.
+func compileTraitUses(ccb *codeBlockCompiler, class *ast.ClassLiteral) {
+	for _, use := range class.Traits {
+		compile(ccb, &ast.Identifier{
+			Token: token.Token{Type: token.Identifier, Literal: use.Name, Pos: class.Token.Pos},
+			Value: use.Name,
+		})
+
+		methods := make([]string, 0, len(use.Aliases))
+		for method := range use.Aliases {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(use.Aliases[method])))
+			ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(method)))
+		}
+		ccb.code.addInst(opcode.MakeMap, ccb.pos, uint32(len(methods)))
+	}
+	ccb.code.addInst(opcode.MakeArray, ccb.pos, uint32(len(class.Traits)*2))
+}
+
+func compileTraitLiteral(ccb *codeBlockCompiler, trait *ast.TraitLiteral) {
+	ccb.pos = trait.Token.Pos
+
+	for _, f := range trait.Methods {
+		f.FQName = fmt.Sprintf("%s.%s", trait.Name, f.Name)
+		compileFunction(ccb, f, true, false)
+	}
+
+	fields := compileClassBlock(ccb, fmt.Sprintf("%s.__init", trait.Name), trait.Fields)
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(fields))
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(trait.Name)))
+	ccb.code.addInst(opcode.BuildTrait, ccb.pos, uint32(len(trait.Methods)))
+}
+
+// compileClassBlock compiles the field definitions of a class into a code
+// block that defines them in the environment it's run in.
+func compileClassBlock(ccb *codeBlockCompiler, name string, defs []*ast.DefStatement) *CodeBlock {
 	ccb2 := &codeBlockCompiler{
 		constants: newConstantTable(),
 		locals:    newStringTable(),
@@ -25,102 +104,272 @@ func compileClassLiteral(ccb *codeBlockCompiler, class *ast.ClassLiteral) {
 		filename:  ccb.filename,
 		name:      ccb.name,
 		inLoop:    ccb.inLoop,
-		linenum:   ccb.linenum,
+		pos:       ccb.pos,
+		envOuter:  ccb,
+		inClass:   true,
 	}
 
-	for _, f := range class.Fields {
+	for _, f := range defs {
 		compile(ccb2, f)
 	}
 	compileLoadNull(ccb2)
-	ccb2.code.addInst(opcode.Return, ccb2.linenum)
+	ccb2.code.addInst(opcode.Return, ccb2.pos)
 
 	code := ccb2.code
 	assembledCode, lineOffsets := code.Assemble(ccb2)
-	props := &CodeBlock{
-		Name:         fmt.Sprintf("%s.__init", class.Name),
+	ccb.pos = ccb2.pos
+	return &CodeBlock{
+		Name:         name,
 		Filename:     ccb.filename,
 		LocalCount:   len(ccb2.locals.table),
+		Caches:       make([]atomic.Value, ccb2.caches),
 		Code:         assembledCode,
 		Constants:    ccb2.constants.table,
 		Names:        ccb2.names.table,
 		Locals:       ccb2.locals.table,
+		EnvLocals:    ccb2.envLocals(),
 		MaxStackSize: calculateStackSize(code),
 		MaxBlockSize: calculateBlockSize(code),
 		LineOffsets:  lineOffsets,
 	}
+}
 
-	ccb.linenum = ccb2.linenum
-	ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(props))
+// compileAccessors compiles property getters or setters into a map of the
+// property name to its accessor method.
+func compileAccessors(ccb *codeBlockCompiler, class *ast.ClassLiteral, accessors map[string]*ast.FunctionLiteral) {
+	names := make([]string, 0, len(accessors))
+	for name := range accessors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	if class.Parent == "" {
-		compileLoadNull(ccb)
+	for _, name := range names {
+		fn := accessors[name]
+		fn.FQName = fmt.Sprintf("%s.%s", class.Name, fn.Name)
+		compileFunction(ccb, fn, true, class.Parent != "")
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(name)))
+	}
+	ccb.code.addInst(opcode.MakeMap, ccb.pos, uint32(len(names)))
+}
+
+func compileTryCatch(ccb *codeBlockCompiler, try *ast.TryCatchExpression) {
+	finallyLbl := randomLabel("finally_")
+	endTryLbl := randomLabel("endTry_")
+
+	ccb.pos = try.Try.Token.Pos
+	if try.Finally != nil {
+		ccb.code.addLabeledArgs(opcode.StartFinally, ccb.pos, finallyLbl)
+	}
+
+	if len(try.Catches) == 0 {
+		compileBlockValue(ccb, try.Try)
 	} else {
-		compile(ccb, &ast.Identifier{Value: class.Parent})
+		catchBlkLbl := randomLabel("catch_")
+
+		ccb.code.addLabeledArgs(opcode.StartTry, ccb.pos, catchBlkLbl)
+		compileBlockValue(ccb, try.Try)
+		ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.pos, endTryLbl)
+
+		ccb.code.addLabel(catchBlkLbl, ccb.pos)
+		catchAll := false
+		for _, clause := range try.Catches {
+			compileCatchClause(ccb, clause, endTryLbl)
+			if clause.Class == nil {
+				catchAll = true
+				break
+			}
+		}
+
+		// No clause matched, pass the exception along
+		if !catchAll {
+			ccb.code.addInst(opcode.Throw, ccb.pos)
+		}
+
+		ccb.code.addLabel(endTryLbl, ccb.pos)
+		ccb.code.addInst(opcode.EndBlock, ccb.pos)
+	}
+
+	if try.Finally == nil {
+		return
 	}
 
-	ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(object.MakeStringObj(class.Name)))
-	ccb.code.addInst(opcode.BuildClass, ccb.linenum, uint16(len(class.Methods)))
+	// The finally block is entered with a null on the normal path, or with the
+	// exception or pending return/break/continue when the block is unwound.
+	ccb.code.addInst(opcode.EndBlock, ccb.pos)
+	compileLoadNull(ccb)
+	ccb.code.addLabel(finallyLbl, ccb.pos)
+
+	finallyCCB := &codeBlockCompiler{
+		constants: ccb.constants,
+		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
+		names:     ccb.names,
+		code:      NewInstSet(),
+		filename:  ccb.filename,
+		name:      ccb.name,
+		inLoop:    ccb.inLoop,
+		pos:       try.Finally.Token.Pos,
+	}
+	finallyCCB.code.addInst(opcode.OpenScope, finallyCCB.pos)
+	compileBlockValue(finallyCCB, try.Finally)
+	finallyCCB.code.addInst(opcode.Pop, finallyCCB.pos)
+	finallyCCB.code.addInst(opcode.CloseScope, finallyCCB.pos)
+	ccb.pos = finallyCCB.pos
+
+	ccb.locals.extend(finallyCCB.locals)
+	ccb.code.merge(finallyCCB.code)
+	ccb.code.addInst(opcode.EndFinally, ccb.pos)
 }
 
-func compileTryCatch(ccb *codeBlockCompiler, try *ast.TryCatchExpression) {
-	_, tryNoNil := try.Try.Statements[len(try.Try.Statements)-1].(*ast.ExpressionStatement)
-	_, catchNoNil := try.Catch.Statements[len(try.Catch.Statements)-1].(*ast.ExpressionStatement)
+// compileCatchClause compiles a catch block. The exception is on the top of the
+// stack, if the clause has a class it's checked first and the clause is skipped
+// when it doesn't match.
+func compileCatchClause(ccb *codeBlockCompiler, clause *ast.CatchClause, endTryLbl string) {
+	ccb.pos = clause.Token.Pos
+	nextLbl := randomLabel("nextCatch_")
+
+	if clause.Class != nil {
+		ccb.code.addInst(opcode.Dup, ccb.pos)
+		compile(ccb, clause.Class)
+		ccb.code.addInst(opcode.MatchException, ccb.pos)
+		ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.pos, nextLbl)
+	}
 
-	catchBlkLbl := randomLabel("catch_")
-	endTryLbl := randomLabel("endTry_")
+	// Each catch block gets its own scope so the exception symbol doesn't leak
+	ccb.code.addInst(opcode.OpenScope, ccb.pos)
 
-	ccb.linenum = try.Try.Token.Pos.Line
-	ccb.code.addLabeledArgs(opcode.StartTry, ccb.linenum, catchBlkLbl)
-	compile(ccb, try.Try)
-	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.linenum, endTryLbl)
+	bodyCCB := &codeBlockCompiler{
+		constants: ccb.constants,
+		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
+		names:     ccb.names,
+		code:      NewInstSet(),
+		filename:  ccb.filename,
+		name:      ccb.name,
+		inLoop:    ccb.inLoop,
+		pos:       ccb.pos,
+	}
 
-	ccb.code.addLabel(catchBlkLbl, ccb.linenum)
-	if try.Symbol == nil {
-		ccb.code.addInst(opcode.Pop, ccb.linenum)
+	if clause.Symbol == nil {
+		bodyCCB.code.addInst(opcode.Pop, bodyCCB.pos)
 	} else {
-		ccb.code.addInst(opcode.Define, ccb.linenum, ccb.locals.indexOf(try.Symbol.Value))
+		bodyCCB.code.addInst(opcode.Define, bodyCCB.pos, bodyCCB.define(clause.Symbol.Value))
 	}
+	compileBlockValue(bodyCCB, clause.Body)
+	ccb.pos = bodyCCB.pos
 
-	ccb.linenum = try.Catch.Token.Pos.Line
-	compile(ccb, try.Catch)
-	if try.Symbol != nil {
-		ccb.code.addInst(opcode.DeleteFast, ccb.linenum, ccb.locals.indexOf(try.Symbol.Value))
+	ccb.locals.extend(bodyCCB.locals)
+	ccb.code.merge(bodyCCB.code)
+
+	ccb.code.addInst(opcode.CloseScope, ccb.pos)
+	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.pos, endTryLbl)
+	ccb.code.addLabel(nextLbl, ccb.pos)
+}
+
+// compileDefer compiles the deferred expression into a function that's called
+// when the current function returns.
+func compileDefer(ccb *codeBlockCompiler, node *ast.DeferStatement) {
+	ccb.pos = node.Token.Pos
+	fn := &ast.FunctionLiteral{
+		Token:  node.Token,
+		FQName: "(deferred)",
+		Body: &ast.BlockStatement{
+			Token: node.Token,
+			Statements: []ast.Statement{
+				&ast.ExpressionStatement{Token: node.Token, Expression: node.Expression},
+			},
+		},
 	}
+	compileFunction(ccb, fn, false, false)
+	ccb.code.addInst(opcode.Defer, ccb.pos)
+}
 
-	if catchNoNil && !tryNoNil {
-		ccb.code.addInst(opcode.JumpForward, ccb.linenum, 3)
+// compileWith compiles a with statement. The value stays on the stack under a
+// finally block which calls its _exit method however the body is left.
+func compileWith(ccb *codeBlockCompiler, node *ast.WithStatement) {
+	ccb.pos = node.Token.Pos
+	exitLbl := randomLabel("exit_")
+
+	compile(ccb, node.Value)
+	ccb.code.addInst(opcode.OpenScope, ccb.pos)
+
+	bodyCCB := &codeBlockCompiler{
+		constants: ccb.constants,
+		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
+		names:     ccb.names,
+		code:      NewInstSet(),
+		filename:  ccb.filename,
+		name:      ccb.name,
+		inLoop:    ccb.inLoop,
+		pos:       ccb.pos,
 	}
 
-	if !tryNoNil || !catchNoNil {
-		compileLoadNull(ccb)
+	// ENTER_WITH pushes the result of _enter
+	bodyCCB.code.addLabeledArgs(opcode.EnterWith, bodyCCB.pos, exitLbl)
+	if node.Name != nil {
+		bodyCCB.code.addInst(opcode.Define, bodyCCB.pos, bodyCCB.define(node.Name.Value))
+	} else {
+		bodyCCB.code.addInst(opcode.Pop, bodyCCB.pos)
 	}
 
-	ccb.code.addLabel(endTryLbl, ccb.linenum)
-	ccb.code.addInst(opcode.EndBlock, ccb.linenum)
+	compile(bodyCCB, node.Body)
+	ccb.pos = bodyCCB.pos
+
+	// If the body ends in an expression, we need to pop it so the stack is correct
+	if l := len(node.Body.Statements); l > 0 {
+		if _, ok := node.Body.Statements[l-1].(*ast.ExpressionStatement); ok {
+			bodyCCB.code.addInst(opcode.Pop, ccb.pos)
+		}
+	}
+
+	// This copies the local variables into the outer compile block for table indexing
+	ccb.locals.extend(bodyCCB.locals)
+	ccb.code.merge(bodyCCB.code)
+
+	ccb.code.addInst(opcode.EndBlock, ccb.pos)
+	compileLoadNull(ccb)
+	ccb.code.addLabel(exitLbl, ccb.pos)
+	ccb.code.addInst(opcode.ExitWith, ccb.pos)
+	ccb.code.addInst(opcode.EndFinally, ccb.pos)
+	ccb.code.addInst(opcode.CloseScope, ccb.pos)
+}
+
+// compileBlockValue compiles a block that's used as an expression. Exactly one
+// value is left on the stack, null if the block doesn't end in an expression.
+func compileBlockValue(ccb *codeBlockCompiler, block *ast.BlockStatement) {
+	compile(ccb, block)
+	if len(block.Statements) == 0 {
+		compileLoadNull(ccb)
+		return
+	}
+	if _, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement); !ok {
+		compileLoadNull(ccb)
+	}
 }
 
 func compileBlock(ccb *codeBlockCompiler, block *ast.BlockStatement) {
-	ccb.linenum = block.Token.Pos.Line
+	ccb.pos = block.Token.Pos
 	l := len(block.Statements) - 1
 	for i, s := range block.Statements {
 		compile(ccb, s)
 		if i < l {
 			if _, ok := s.(*ast.ExpressionStatement); ok {
-				ccb.code.addInst(opcode.Pop, ccb.linenum)
+				ccb.code.addInst(opcode.Pop, ccb.pos)
 			}
 		}
 	}
 }
 
 func compileFunction(ccb *codeBlockCompiler, fn *ast.FunctionLiteral, inClass, hasParent bool) {
-	ccb.linenum = fn.Token.Pos.Line
+	ccb.pos = fn.Token.Pos
 	var body *CodeBlock
 	if fn.Native {
 		body = &CodeBlock{
 			Name:        ccb.name + "." + fn.FQName,
 			Filename:    ccb.filename,
 			Native:      true,
-			LineOffsets: []uint16{0, uint16(ccb.linenum)},
+			LineOffsets: []LineOffset{{Line: uint32(ccb.pos.Line), Col: uint32(ccb.pos.Col)}},
 		}
 	} else {
 		ccb2 := &codeBlockCompiler{
@@ -131,20 +380,40 @@ func compileFunction(ccb *codeBlockCompiler, fn *ast.FunctionLiteral, inClass, h
 			filename:  ccb.filename,
 			name:      ccb.name,
 			inLoop:    ccb.inLoop,
-			linenum:   ccb.linenum,
+			pos:       ccb.pos,
+			enclosing: ccb,
+			inClass:   inClass,
 		}
 
+		// The VM expects the parameters first, then the rest parameter or
+		// `arguments`, then `this` and `parent`
 		for _, p := range fn.Parameters {
-			ccb2.locals.indexOf(p.Value)
+			ccb2.defineParam(p.Value, false)
+		}
+		var argumentsIdx uint32
+		if fn.Rest != nil {
+			ccb2.defineParam(fn.Rest.Value, false)
+		} else {
+			argumentsIdx = ccb2.defineParam("arguments", false) // `arguments` holds any remaining arguments from a function call
 		}
-		ccb2.locals.indexOf("arguments") // `arguments` holds any remaining arguments from a function call
 		if inClass {
-			ccb2.locals.indexOf("this")
+			// The VM looks up `this` by name to find the instance of a method
+			ccb2.declareInEnv(ccb2.defineParam("this", true))
 			if hasParent {
-				ccb2.locals.indexOf("parent")
+				ccb2.declareInEnv(ccb2.defineParam("parent", true))
 			}
 		}
 
+		for i, pattern := range fn.Patterns {
+			if pattern == nil {
+				continue
+			}
+			ccb2.code.addInst(opcode.LoadFast, ccb2.pos, uint32(i))
+			compileDestructure(ccb2, pattern, func(name string) {
+				ccb2.code.addInst(opcode.Define, ccb2.pos, ccb2.define(name))
+			})
+		}
+
 		compile(ccb2, fn.Body)
 
 		if len(fn.Body.Statements) > 0 {
@@ -158,46 +427,216 @@ func compileFunction(ccb *codeBlockCompiler, fn *ast.FunctionLiteral, inClass, h
 			}
 
 			if !ccb2.code.last().Is(opcode.Return) {
-				ccb2.code.addInst(opcode.Return, ccb2.linenum)
+				ccb2.code.addInst(opcode.Return, ccb2.pos)
 			}
 		} else {
 			compileLoadNull(ccb2)
-			ccb2.code.addInst(opcode.Return, ccb2.linenum)
+			ccb2.code.addInst(opcode.Return, ccb2.pos)
 		}
 
+		defaults := compileDefaults(ccb2, fn)
+
 		code := ccb2.code
+		if code.contains(opcode.Await) && !fn.Async {
+			panic("await used outside of an async function")
+		}
+		if code.contains(opcode.Yield) && fn.Async {
+			panic("yield used in an async function")
+		}
+
+		// `arguments` is used directly, from a nested scope which looks it up by name,
+		// or captured by a nested function
+		usesArguments := fn.Rest == nil &&
+			(code.usesLocal(argumentsIdx) || ccb2.names.contains("arguments") || capturesLocal(ccb2.constants, "arguments"))
+
+		generator := code.contains(opcode.Yield) // Checked before dead yields are removed
 		assembledCode, lineOffsets := code.Assemble(ccb2)
 		body = &CodeBlock{
-			Name:         ccb.name + "." + fn.FQName,
+			Name:          ccb.name + "." + fn.FQName,
+			Filename:      ccb.filename,
+			LocalCount:    len(ccb2.locals.table),
+			Caches:        make([]atomic.Value, ccb2.caches),
+			Code:          assembledCode,
+			Constants:     ccb2.constants.table,
+			Names:         ccb2.names.table,
+			Locals:        ccb2.locals.table,
+			MaxStackSize:  calculateStackSize(code),
+			MaxBlockSize:  calculateBlockSize(code),
+			LineOffsets:   lineOffsets,
+			Generator:     generator,
+			Async:         fn.Async,
+			Defaults:      defaults,
+			UsesArguments: usesArguments,
+			Upvalues:      ccb2.upvalues,
+			EnvLocals:     ccb2.envLocals(),
+		}
+		ccb.pos = ccb2.pos
+	}
+
+	body.ClassMethod = inClass
+
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(body))
+
+	for _, p := range fn.Parameters {
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(p.Value)))
+	}
+	paramCount := len(fn.Parameters)
+	if fn.Rest != nil {
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj("..."+fn.Rest.Value)))
+		paramCount++
+	}
+	ccb.code.addInst(opcode.MakeArray, ccb.pos, uint32(paramCount))
+
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(fn.Name)))
+
+	ccb.code.addInst(opcode.MakeFunction, ccb.pos)
+}
+
+// compileDefaults compiles each default parameter value into its own code block.
+// They're run in the function's environment when the argument isn't given, ccb
+// is the function's body.
+func compileDefaults(ccb *codeBlockCompiler, fn *ast.FunctionLiteral) []*CodeBlock {
+	var defaults []*CodeBlock
+
+	for i, def := range fn.Defaults {
+		if def == nil {
+			continue
+		}
+		if defaults == nil {
+			defaults = make([]*CodeBlock, len(fn.Parameters))
+		}
+
+		ccb2 := &codeBlockCompiler{
+			constants: newConstantTable(),
+			locals:    newStringTable(),
+			names:     newStringTable(),
+			code:      NewInstSet(),
+			filename:  ccb.filename,
+			name:      ccb.name,
+			pos:       fn.Parameters[i].Token.Pos,
+			envOuter:  ccb,
+		}
+
+		compile(ccb2, def)
+		ccb2.code.addInst(opcode.Return, ccb2.pos)
+
+		code := ccb2.code
+		assembledCode, lineOffsets := code.Assemble(ccb2)
+		defaults[i] = &CodeBlock{
+			Name:         fmt.Sprintf("%s.%s.%s", ccb.name, fn.FQName, fn.Parameters[i].Value),
 			Filename:     ccb.filename,
 			LocalCount:   len(ccb2.locals.table),
+			Caches:       make([]atomic.Value, ccb2.caches),
 			Code:         assembledCode,
 			Constants:    ccb2.constants.table,
 			Names:        ccb2.names.table,
 			Locals:       ccb2.locals.table,
+			EnvLocals:    ccb2.envLocals(),
 			MaxStackSize: calculateStackSize(code),
 			MaxBlockSize: calculateBlockSize(code),
 			LineOffsets:  lineOffsets,
 		}
-		ccb.linenum = ccb2.linenum
 	}
 
-	body.ClassMethod = inClass
+	return defaults
+}
 
-	ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(body))
+func hasSpread(list []ast.Expression) bool {
+	for _, e := range list {
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
 
-	for _, p := range fn.Parameters {
-		ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(object.MakeStringObj(p.Value)))
+// compileSpreadList builds an array from a list of expressions where spread
+// expressions are expanded in place.
+func compileSpreadList(ccb *codeBlockCompiler, list []ast.Expression) {
+	start := 0
+	for start < len(list) {
+		if _, ok := list[start].(*ast.SpreadExpression); ok {
+			break
+		}
+		compile(ccb, list[start])
+		start++
 	}
-	ccb.code.addInst(opcode.MakeArray, ccb.linenum, uint16(len(fn.Parameters)))
+	ccb.code.addInst(opcode.MakeArray, ccb.pos, uint32(start))
+
+	for i := start; i < len(list); {
+		if spread, ok := list[i].(*ast.SpreadExpression); ok {
+			compile(ccb, spread.Value)
+			ccb.code.addInst(opcode.Extend, ccb.pos)
+			i++
+			continue
+		}
 
-	ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(object.MakeStringObj(fn.Name)))
+		n := 0
+		for ; i < len(list); i++ {
+			if _, ok := list[i].(*ast.SpreadExpression); ok {
+				break
+			}
+			compile(ccb, list[i])
+			n++
+		}
+		ccb.code.addInst(opcode.MakeArray, ccb.pos, uint32(n))
+		ccb.code.addInst(opcode.Extend, ccb.pos)
+	}
+}
 
-	ccb.code.addInst(opcode.MakeFunction, ccb.linenum)
+// compileKeywordArgs builds a map of the keyword arguments of a call.
+func compileKeywordArgs(ccb *codeBlockCompiler, keywords []*ast.KeywordArgument) {
+	for _, kw := range keywords {
+		compile(ccb, kw.Value)
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(kw.Name)))
+	}
+	ccb.code.addInst(opcode.MakeMap, ccb.pos, uint32(len(keywords)))
+}
+
+// compileDestructure binds the parts of the value on top of the stack to the
+// names in pattern. The value is consumed, bind is called to store each name.
+func compileDestructure(ccb *codeBlockCompiler, pattern ast.Expression, bind func(name string)) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		bind(pattern.Value)
+
+	case *ast.ArrayPattern:
+		if pattern.Rest != nil {
+			ccb.code.addInst(opcode.LoadRest, ccb.pos, uint32(len(pattern.Elements)))
+			bind(pattern.Rest.Value)
+		} else {
+			ccb.code.addInst(opcode.CheckLength, ccb.pos, uint32(len(pattern.Elements)))
+		}
+
+		for i, el := range pattern.Elements {
+			ccb.code.addInst(opcode.Dup, ccb.pos)
+			ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeIntObj(int64(i))))
+			ccb.code.addInst(opcode.LoadIndex, ccb.pos)
+			compileDestructure(ccb, el, bind)
+		}
+		ccb.code.addInst(opcode.Pop, ccb.pos)
+
+	case *ast.MapPattern:
+		for _, entry := range pattern.Entries {
+			ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(entry.Key)))
+		}
+		ccb.code.addInst(opcode.CheckKeys, ccb.pos, uint32(len(pattern.Entries)))
+
+		for _, entry := range pattern.Entries {
+			ccb.code.addInst(opcode.Dup, ccb.pos)
+			ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(entry.Key)))
+			ccb.code.addInst(opcode.LoadIndex, ccb.pos)
+			compileDestructure(ccb, entry.Value, bind)
+		}
+		ccb.code.addInst(opcode.Pop, ccb.pos)
+
+	default:
+		panic(fmt.Sprintf("invalid destructuring target %s", pattern.String()))
+	}
 }
 
 func compileIfStatement(ccb *codeBlockCompiler, ifs *ast.IfExpression) {
-	ccb.linenum = ifs.Token.Pos.Line
+	ccb.pos = ifs.Token.Pos
 	if ifs.Alternative == nil {
 		compileIfStatementNoElse(ccb, ifs)
 		return
@@ -205,22 +644,22 @@ func compileIfStatement(ccb *codeBlockCompiler, ifs *ast.IfExpression) {
 
 	compile(ccb, ifs.Condition)
 
-	ccb.linenum = ifs.Consequence.Token.Pos.Line
+	ccb.pos = ifs.Consequence.Token.Pos
 	_, trueNoNil := ifs.Consequence.Statements[len(ifs.Consequence.Statements)-1].(*ast.ExpressionStatement)
 	falseBrnLbl := randomLabel("false_")
-	ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.linenum, falseBrnLbl)
+	ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.pos, falseBrnLbl)
 	compile(ccb, ifs.Consequence)
 	if !trueNoNil {
 		compileLoadNull(ccb)
 	}
 
-	ccb.linenum = ifs.Alternative.Token.Pos.Line
+	ccb.pos = ifs.Alternative.Token.Pos
 	_, falseNoNil := ifs.Alternative.Statements[len(ifs.Alternative.Statements)-1].(*ast.ExpressionStatement)
 	afterIfStmt := randomLabel("afterIf_")
-	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.linenum, afterIfStmt)
-	ccb.code.addLabel(falseBrnLbl, ccb.linenum)
+	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.pos, afterIfStmt)
+	ccb.code.addLabel(falseBrnLbl, ccb.pos)
 	compile(ccb, ifs.Alternative)
-	ccb.code.addLabel(afterIfStmt, ccb.linenum)
+	ccb.code.addLabel(afterIfStmt, ccb.pos)
 	if !falseNoNil {
 		compileLoadNull(ccb)
 	}
@@ -229,45 +668,236 @@ func compileIfStatement(ccb *codeBlockCompiler, ifs *ast.IfExpression) {
 func compileIfStatementNoElse(ccb *codeBlockCompiler, ifs *ast.IfExpression) {
 	compile(ccb, ifs.Condition)
 
-	ccb.linenum = ifs.Consequence.Token.Pos.Line
+	ccb.pos = ifs.Consequence.Token.Pos
 	_, noNil := ifs.Consequence.Statements[len(ifs.Consequence.Statements)-1].(*ast.ExpressionStatement)
 	falseBrnLbl := randomLabel("false_")
 	afterIfStmt := randomLabel("afterIf_")
 
-	ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.linenum, falseBrnLbl)
+	ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.pos, falseBrnLbl)
 	compile(ccb, ifs.Consequence)
 	if !noNil {
 		compileLoadNull(ccb)
 	}
 
-	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.linenum, afterIfStmt)
-	ccb.code.addLabel(falseBrnLbl, ccb.linenum)
+	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.pos, afterIfStmt)
+	ccb.code.addLabel(falseBrnLbl, ccb.pos)
 	compileLoadNull(ccb)
-	ccb.code.addLabel(afterIfStmt, ccb.linenum)
+	ccb.code.addLabel(afterIfStmt, ccb.pos)
+}
+
+// matchTypes are the builtin type names that can be used as a match pattern.
+var matchTypes = map[string]object.ObjectType{
+	"int":    object.IntergerObj,
+	"float":  object.FloatObj,
+	"bool":   object.BooleanObj,
+	"string": object.StringObj,
+	"array":  object.ArrayObj,
+	"map":    object.HashObj,
+	"func":   object.FunctionObj,
+}
+
+func compileMatchExpression(ccb *codeBlockCompiler, match *ast.MatchExpression) {
+	ccb.pos = match.Token.Pos
+	endMatchLbl := randomLabel("end_match_")
+
+	compile(ccb, match.Value)
+
+	for _, arm := range match.Arms {
+		ccb.pos = arm.Token.Pos
+		nextArmLbl := randomLabel("next_arm_")
+
+		if arm.Pattern != nil {
+			ccb.code.addInst(opcode.Dup, ccb.pos)
+			compileMatchTest(ccb, arm.Pattern)
+			ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.pos, nextArmLbl)
+		}
+
+		// Each arm gets its own scope for the names bound by its pattern
+		ccb.code.addInst(opcode.OpenScope, ccb.pos)
+		bodyCCB := &codeBlockCompiler{
+			constants: ccb.constants,
+			locals:    newStringTableOffset(len(ccb.locals.table)),
+			outer:     ccb,
+			names:     ccb.names,
+			code:      NewInstSet(),
+			filename:  ccb.filename,
+			name:      ccb.name,
+			inLoop:    ccb.inLoop,
+			pos:       ccb.pos,
+		}
+
+		switch pattern := arm.Pattern.(type) {
+		case *ast.ArrayPattern, *ast.MapPattern:
+			bodyCCB.code.addInst(opcode.Dup, bodyCCB.pos)
+			compileDestructure(bodyCCB, arm.Pattern, func(name string) {
+				bodyCCB.code.addInst(opcode.Define, bodyCCB.pos, bodyCCB.define(name))
+			})
+		case *ast.CallExpression:
+			// Bind the associated values of an enum member
+			for i, arg := range pattern.Arguments {
+				name := arg.(*ast.Identifier).Value
+				if name == "_" {
+					continue
+				}
+				bodyCCB.code.addInst(opcode.Dup, bodyCCB.pos)
+				bodyCCB.code.addInst(opcode.LoadConst, bodyCCB.pos, bodyCCB.constants.indexOf(object.MakeIntObj(int64(i))))
+				bodyCCB.code.addInst(opcode.LoadIndex, bodyCCB.pos)
+				bodyCCB.code.addInst(opcode.Define, bodyCCB.pos, bodyCCB.define(name))
+			}
+		}
+
+		guardFailedLbl := randomLabel("guard_failed_")
+		if arm.Guard != nil {
+			compile(bodyCCB, arm.Guard)
+			bodyCCB.code.addLabeledArgs(opcode.PopJumpIfFalse, bodyCCB.pos, guardFailedLbl)
+		}
+
+		bodyCCB.code.addInst(opcode.Pop, bodyCCB.pos) // Matched value
+		compileBlockValue(bodyCCB, arm.Body)
+		ccb.pos = bodyCCB.pos
+
+		ccb.locals.extend(bodyCCB.locals)
+		ccb.code.merge(bodyCCB.code)
+		ccb.code.addInst(opcode.CloseScope, ccb.pos)
+		ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.pos, endMatchLbl)
+
+		if arm.Guard != nil {
+			ccb.code.addLabel(guardFailedLbl, ccb.pos)
+			ccb.code.addInst(opcode.CloseScope, ccb.pos)
+		}
+		ccb.code.addLabel(nextArmLbl, ccb.pos)
+	}
+
+	ccb.code.addInst(opcode.NoMatch, ccb.pos)
+	ccb.code.addLabel(endMatchLbl, ccb.pos)
+}
+
+// compileMatchTest replaces the value on top of the stack with a boolean of
+// whether it matches pattern.
+func compileMatchTest(ccb *codeBlockCompiler, pattern ast.Expression) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if t, ok := matchTypes[pattern.Value]; ok {
+			ccb.code.addInst(opcode.IsType, ccb.pos, uint32(t))
+			return
+		}
+		compile(ccb, pattern)
+		ccb.code.addInst(opcode.IsInstance, ccb.pos)
+
+	case *ast.AttributeExpression:
+		compile(ccb, pattern)
+		ccb.code.addInst(opcode.IsInstance, ccb.pos)
+
+	case *ast.CallExpression:
+		compile(ccb, pattern.Function)
+		ccb.code.addInst(opcode.IsInstance, ccb.pos)
+
+	case *ast.ArrayPattern:
+		exact := uint32(1)
+		if pattern.Rest != nil {
+			exact = 0
+		}
+
+		var nested []nestedPattern
+		for i, el := range pattern.Elements {
+			nested = append(nested, nestedPattern{index: object.MakeIntObj(int64(i)), pattern: el})
+		}
+
+		compileShapeTest(ccb, nested, func() {
+			ccb.code.addInst(opcode.MatchLength, ccb.pos, uint32(len(pattern.Elements)), exact)
+		})
+
+	case *ast.MapPattern:
+		var nested []nestedPattern
+		for _, entry := range pattern.Entries {
+			nested = append(nested, nestedPattern{index: object.MakeStringObj(entry.Key), pattern: entry.Value})
+		}
+
+		compileShapeTest(ccb, nested, func() {
+			for _, entry := range pattern.Entries {
+				ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.MakeStringObj(entry.Key)))
+			}
+			ccb.code.addInst(opcode.MatchKeys, ccb.pos, uint32(len(pattern.Entries)))
+		})
+
+	default:
+		compile(ccb, pattern)
+		ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpEq))
+	}
+}
+
+// nestedPattern is an element of a destructuring pattern and its index or key.
+type nestedPattern struct {
+	index   object.Object
+	pattern ast.Expression
+}
+
+// compileShapeTest tests a destructuring pattern in a match arm. shape replaces
+// the value on the stack with whether it's the right type and size. If it is,
+// the elements are tested against any nested patterns, plain names always match.
+func compileShapeTest(ccb *codeBlockCompiler, elements []nestedPattern, shape func()) {
+	var nested []nestedPattern
+	for _, el := range elements {
+		if _, ok := el.pattern.(*ast.Identifier); !ok {
+			nested = append(nested, el)
+		}
+	}
+
+	if len(nested) == 0 {
+		shape()
+		return
+	}
+
+	failedLbl := randomLabel("shape_failed_")
+	endLbl := randomLabel("shape_end_")
+
+	ccb.code.addInst(opcode.Dup, ccb.pos)
+	shape()
+	ccb.code.addLabeledArgs(opcode.JumpIfFalseOrPop, ccb.pos, failedLbl)
+	for _, el := range nested {
+		ccb.code.addInst(opcode.Dup, ccb.pos)
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(el.index))
+		ccb.code.addInst(opcode.LoadIndex, ccb.pos)
+		compileMatchTest(ccb, el.pattern)
+		ccb.code.addLabeledArgs(opcode.JumpIfFalseOrPop, ccb.pos, failedLbl)
+	}
+	ccb.code.addInst(opcode.Pop, ccb.pos)
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.TrueConst))
+	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.pos, endLbl)
+
+	// A failed test leaves the value and false on the stack
+	ccb.code.addLabel(failedLbl, ccb.pos)
+	ccb.code.addInst(opcode.Pop, ccb.pos)
+	ccb.code.addInst(opcode.Pop, ccb.pos)
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.FalseConst))
+	ccb.code.addLabel(endLbl, ccb.pos)
 }
 
 func compileLoadNull(ccb *codeBlockCompiler) {
-	ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(object.NullConst))
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.NullConst))
 }
 
 func compileCompareExpression(ccb *codeBlockCompiler, cmp *ast.CompareExpression) {
-	ccb.linenum = cmp.Token.Pos.Line
+	ccb.pos = cmp.Token.Pos
 	compile(ccb, cmp.Left)
 
 	afterCompareLabel := randomLabel("cmp_")
 
-	if cmp.Token.Type == token.LAnd {
-		ccb.code.addLabeledArgs(opcode.JumpIfFalseOrPop, ccb.linenum, afterCompareLabel)
-	} else {
-		ccb.code.addLabeledArgs(opcode.JumpIfTrueOrPop, ccb.linenum, afterCompareLabel)
+	switch cmp.Token.Type {
+	case token.LAnd:
+		ccb.code.addLabeledArgs(opcode.JumpIfFalseOrPop, ccb.pos, afterCompareLabel)
+	case token.NullCoalesce:
+		ccb.code.addLabeledArgs(opcode.JumpIfNotNilOrPop, ccb.pos, afterCompareLabel)
+	default:
+		ccb.code.addLabeledArgs(opcode.JumpIfTrueOrPop, ccb.pos, afterCompareLabel)
 	}
 
 	compile(ccb, cmp.Right)
-	ccb.code.addLabel(afterCompareLabel, ccb.linenum)
+	ccb.code.addLabel(afterCompareLabel, ccb.pos)
 }
 
 func compileLoop(ccb *codeBlockCompiler, loop *ast.LoopStatement) {
-	ccb.linenum = loop.Token.Pos.Line
+	ccb.pos = loop.Token.Pos
 	if loop.Init == nil {
 		if loop.Condition == nil {
 			compileInfiniteLoop(ccb, loop)
@@ -281,120 +911,141 @@ func compileLoop(ccb *codeBlockCompiler, loop *ast.LoopStatement) {
 	iterBlockLbl := randomLabel("iter_")
 
 	// A loop begins with a PREPARE_BLOCK opcode this creates the first layer environment
-	ccb.code.addInst(opcode.OpenScope, ccb.linenum)
-	// Initialization is done in this first layer
-	compile(ccb, loop.Init)
+	ccb.code.addInst(opcode.OpenScope, ccb.pos)
+	// Initialization is done in this first layer, the rest of the loop is nested in it
+	initCCB := &codeBlockCompiler{
+		constants: ccb.constants,
+		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
+		names:     ccb.names,
+		code:      NewInstSet(),
+		filename:  ccb.filename,
+		name:      ccb.name,
+		inLoop:    ccb.inLoop,
+		pos:       ccb.pos,
+	}
+	compile(initCCB, loop.Init)
+	ccb.pos = initCCB.pos
+	ccb.code.merge(initCCB.code)
 
 	condCCB := &codeBlockCompiler{
 		constants: ccb.constants,
-		locals:    newStringTableOffset(len(ccb.locals.table)),
+		locals:    newStringTableOffset(len(initCCB.locals.table)),
+		outer:     initCCB,
 		names:     ccb.names,
 		code:      NewInstSet(),
 		filename:  ccb.filename,
 		name:      ccb.name,
-		linenum:   ccb.linenum,
+		pos:       ccb.pos,
 	}
 
 	// Compile the loop's condition check code
 	compile(condCCB, loop.Condition)
-	ccb.linenum = condCCB.linenum
+	ccb.pos = condCCB.pos
 
 	// Prepare for main body
 	bodyCCB := &codeBlockCompiler{
 		constants: ccb.constants,
-		locals:    newStringTableOffset(len(ccb.locals.table)),
+		locals:    newStringTableOffset(len(initCCB.locals.table)),
+		outer:     initCCB,
 		names:     ccb.names,
 		code:      NewInstSet(),
 		filename:  ccb.filename,
 		name:      ccb.name,
 		inLoop:    true,
-		linenum:   ccb.linenum,
+		loopBody:  true,
+		loopLabel: loopLabel(loop.Label),
+		pos:       ccb.pos,
 	}
 
 	// Compile main body of loop
 	compile(bodyCCB, loop.Body)
-	ccb.linenum = bodyCCB.linenum
+	ccb.pos = bodyCCB.pos
 
 	// If the body ends in an expression, we need to pop it so the stack is correct
 	if _, ok := loop.Body.Statements[len(loop.Body.Statements)-1].(*ast.ExpressionStatement); ok {
-		bodyCCB.code.addInst(opcode.Pop, ccb.linenum)
+		bodyCCB.code.addInst(opcode.Pop, ccb.pos)
 	}
 
 	// This copies the local variables into the outer compile block for table indexing
-	for _, n := range bodyCCB.locals.table[len(ccb.locals.table):] {
-		ccb.locals.indexOf(n)
-	}
+	initCCB.locals.extend(bodyCCB.locals)
 
 	// Prepare for iteration code
 	iterCCB := &codeBlockCompiler{
 		constants: ccb.constants,
-		locals:    newStringTableOffset(len(ccb.locals.table)),
+		locals:    newStringTableOffset(len(initCCB.locals.table)),
+		outer:     initCCB,
 		names:     ccb.names,
 		code:      NewInstSet(),
 		filename:  ccb.filename,
 		name:      ccb.name,
-		linenum:   ccb.linenum,
+		pos:       ccb.pos,
 	}
 
 	// Compile iteration
 	compile(iterCCB, loop.Iter)
-	ccb.linenum = iterCCB.linenum
+	ccb.pos = iterCCB.pos
 
 	// Again, copy over the locals for indexing
-	for _, n := range iterCCB.locals.table[len(ccb.locals.table):] {
-		ccb.locals.indexOf(n)
-	}
+	initCCB.locals.extend(iterCCB.locals)
+	ccb.locals.extend(initCCB.locals)
 
-	ccb.code.addLabeledArgs(opcode.StartLoop, ccb.linenum, endBlockLbl, iterBlockLbl)
+	exitLbl := loopExitLabel(loop.Else, endBlockLbl)
+	ccb.code.addLabeledArgs(opcode.StartLoop, ccb.pos, endBlockLbl, iterBlockLbl)
 
 	ccb.code.merge(condCCB.code)
-	ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.linenum, endBlockLbl)
+	ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.pos, exitLbl)
 	ccb.code.merge(bodyCCB.code)
 
-	ccb.code.addLabel(iterBlockLbl, ccb.linenum)
+	// Each iteration gets its own copy of the variables from the initialization
+	// so closures made in the body keep the values of their iteration
+	ccb.code.addLabel(iterBlockLbl, ccb.pos)
+	ccb.code.addInst(opcode.CopyScope, ccb.pos)
 	ccb.code.merge(iterCCB.code)
-	ccb.code.addInst(opcode.NextIter, ccb.linenum)
-	ccb.code.addLabel(endBlockLbl, ccb.linenum)
-	ccb.code.addInst(opcode.EndBlock, ccb.linenum)
-	ccb.code.addInst(opcode.CloseScope, ccb.linenum)
-	ccb.code.addInst(opcode.CloseScope, ccb.linenum)
+	ccb.code.addInst(opcode.NextIter, ccb.pos)
+	compileLoopEnd(ccb, loop.Else, exitLbl, endBlockLbl, func() {
+		ccb.code.addInst(opcode.EndBlock, ccb.pos)
+		ccb.code.addInst(opcode.CloseScope, ccb.pos)
+		ccb.code.addInst(opcode.CloseScope, ccb.pos)
+	})
 }
 
 func compileInfiniteLoop(ccb *codeBlockCompiler, loop *ast.LoopStatement) {
 	endBlockLbl := randomLabel("end_")
 	iterBlockLbl := randomLabel("iter_")
 
-	ccb.code.addLabeledArgs(opcode.StartLoop, ccb.linenum, endBlockLbl, iterBlockLbl)
+	ccb.code.addLabeledArgs(opcode.StartLoop, ccb.pos, endBlockLbl, iterBlockLbl)
 
 	bodyCCB := &codeBlockCompiler{
 		constants: ccb.constants,
 		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
 		names:     ccb.names,
 		code:      NewInstSet(),
 		filename:  ccb.filename,
 		name:      ccb.name,
 		inLoop:    true,
-		linenum:   ccb.linenum,
+		loopBody:  true,
+		loopLabel: loopLabel(loop.Label),
+		pos:       ccb.pos,
 	}
 	compile(bodyCCB, loop.Body)
-	ccb.linenum = bodyCCB.linenum
+	ccb.pos = bodyCCB.pos
 
 	// If the body ends in an expression, we need to pop it so the stack is correct
 	if _, ok := loop.Body.Statements[len(loop.Body.Statements)-1].(*ast.ExpressionStatement); ok {
-		bodyCCB.code.addInst(opcode.Pop, ccb.linenum)
+		bodyCCB.code.addInst(opcode.Pop, ccb.pos)
 	}
 
 	// This copies the local variables into the outer compile block for table indexing
-	for _, n := range bodyCCB.locals.table[len(ccb.locals.table):] {
-		ccb.locals.indexOf(n)
-	}
+	ccb.locals.extend(bodyCCB.locals)
 	ccb.code.merge(bodyCCB.code)
 
-	ccb.code.addLabel(iterBlockLbl, ccb.linenum)
-	ccb.code.addInst(opcode.NextIter, ccb.linenum)
-	ccb.code.addLabel(endBlockLbl, ccb.linenum)
-	ccb.code.addInst(opcode.EndBlock, ccb.linenum)
-	ccb.code.addInst(opcode.CloseScope, ccb.linenum)
+	ccb.code.addLabel(iterBlockLbl, ccb.pos)
+	ccb.code.addInst(opcode.NextIter, ccb.pos)
+	ccb.code.addLabel(endBlockLbl, ccb.pos)
+	ccb.code.addInst(opcode.EndBlock, ccb.pos)
+	ccb.code.addInst(opcode.CloseScope, ccb.pos)
 }
 
 func compileWhileLoop(ccb *codeBlockCompiler, loop *ast.LoopStatement) {
@@ -404,149 +1055,243 @@ func compileWhileLoop(ccb *codeBlockCompiler, loop *ast.LoopStatement) {
 	condCCB := &codeBlockCompiler{
 		constants: ccb.constants,
 		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
 		names:     ccb.names,
 		code:      NewInstSet(),
 		filename:  ccb.filename,
 		name:      ccb.name,
-		linenum:   ccb.linenum,
+		pos:       ccb.pos,
 	}
 
 	// Compile the loop's condition check code
 	compile(condCCB, loop.Condition)
-	ccb.linenum = condCCB.linenum
+	ccb.pos = condCCB.pos
 
 	// Prepare for main body
 	bodyCCB := &codeBlockCompiler{
 		constants: ccb.constants,
 		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
 		names:     ccb.names,
 		code:      NewInstSet(),
 		filename:  ccb.filename,
 		name:      ccb.name,
 		inLoop:    true,
-		linenum:   ccb.linenum,
+		loopBody:  true,
+		loopLabel: loopLabel(loop.Label),
+		pos:       ccb.pos,
 	}
 
 	// Compile main body of loop
 	compile(bodyCCB, loop.Body)
-	ccb.linenum = bodyCCB.linenum
+	ccb.pos = bodyCCB.pos
 
 	// If the body ends in an expression, we need to pop it so the stack is correct
 	if _, ok := loop.Body.Statements[len(loop.Body.Statements)-1].(*ast.ExpressionStatement); ok {
-		bodyCCB.code.addInst(opcode.Pop, ccb.linenum)
+		bodyCCB.code.addInst(opcode.Pop, ccb.pos)
 	}
 
 	// This copies the local variables into the outer compile block for table indexing
-	for _, n := range bodyCCB.locals.table[len(ccb.locals.table):] {
-		ccb.locals.indexOf(n)
-	}
+	ccb.locals.extend(bodyCCB.locals)
 
-	ccb.code.addLabeledArgs(opcode.StartLoop, ccb.linenum, endBlockLbl, iterBlockLbl)
+	exitLbl := loopExitLabel(loop.Else, endBlockLbl)
+	ccb.code.addLabeledArgs(opcode.StartLoop, ccb.pos, endBlockLbl, iterBlockLbl)
 
 	ccb.code.merge(condCCB.code)
-	ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.linenum, endBlockLbl)
+	ccb.code.addLabeledArgs(opcode.PopJumpIfFalse, ccb.pos, exitLbl)
 	ccb.code.merge(bodyCCB.code)
 
-	ccb.code.addLabel(iterBlockLbl, ccb.linenum)
-	ccb.code.addInst(opcode.NextIter, ccb.linenum)
-	ccb.code.addLabel(endBlockLbl, ccb.linenum)
-	ccb.code.addInst(opcode.EndBlock, ccb.linenum)
-	ccb.code.addInst(opcode.CloseScope, ccb.linenum)
+	ccb.code.addLabel(iterBlockLbl, ccb.pos)
+	ccb.code.addInst(opcode.NextIter, ccb.pos)
+	compileLoopEnd(ccb, loop.Else, exitLbl, endBlockLbl, func() {
+		ccb.code.addInst(opcode.EndBlock, ccb.pos)
+		ccb.code.addInst(opcode.CloseScope, ccb.pos)
+	})
 }
 
 func compileIterLoop(ccb *codeBlockCompiler, loop *ast.IterLoopStatement) {
-	ccb.linenum = loop.Token.Pos.Line
+	ccb.pos = loop.Token.Pos
 	endBlockLbl := randomLabel("end_")
 	iterBlockLbl := randomLabel("iter_")
-	endIterLbl := randomLabel("end_iter_")
 
-	compile(ccb, loop.Iter)
-	ccb.code.addInst(opcode.GetIter, ccb.linenum)
-
-	ccb.code.addLabeledArgs(opcode.StartLoop, ccb.linenum, endBlockLbl, iterBlockLbl)
-	ccb.code.addInst(opcode.Dup, ccb.linenum)
-	ccb.code.addInst(opcode.LoadAttribute, ccb.linenum, ccb.names.indexOf("_next"))
-	ccb.code.addInst(opcode.Call, ccb.linenum, 0)
+	closeLbl := randomLabel("close_")
+	exitLbl := loopExitLabel(loop.Else, endBlockLbl)
 
-	ccb.code.addInst(opcode.Dup, ccb.linenum)
-	ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(object.NullConst))
-	ccb.code.addInst(opcode.Compare, ccb.linenum, uint16(opcode.CmpEq))
-	ccb.code.addLabeledArgs(opcode.PopJumpIfTrue, ccb.linenum, endIterLbl)
-	ccb.code.addInst(opcode.JumpForward, ccb.linenum, 4)
+	compile(ccb, loop.Iter)
+	ccb.code.addInst(opcode.GetIter, ccb.pos)
 
-	ccb.code.addLabel(endIterLbl, ccb.linenum)
-	ccb.code.addInst(opcode.Pop, ccb.linenum) // Duplicated return from _next()
-	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.linenum, endBlockLbl)
+	// The iterator is closed by a finally block so a break, return, or
+	// exception leaving the loop early lets it clean up
+	ccb.code.addLabeledArgs(opcode.StartFinally, ccb.pos, closeLbl)
 
-	bodyStrTable := newStringTableOffset(len(ccb.locals.table))
-
-	if loop.Key != nil {
-		ccb.code.addInst(opcode.Dup, ccb.linenum)
-		ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(object.MakeIntObj(0)))
-		ccb.code.addInst(opcode.LoadIndex, ccb.linenum)
-		ccb.code.addInst(opcode.Define, ccb.linenum, ccb.locals.indexOf(loop.Key.Value))
-		bodyStrTable.indexOf(loop.Key.Value)
-	}
-
-	ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(object.MakeIntObj(1)))
-	ccb.code.addInst(opcode.LoadIndex, ccb.linenum)
-	ccb.code.addInst(opcode.Define, ccb.linenum, ccb.locals.indexOf(loop.Value.Value))
-	bodyStrTable.indexOf(loop.Value.Value)
+	// ITER_NEXT pushes the next key and value or jumps to the end when the
+	// iterator is done. The value is on top.
+	ccb.code.addLabeledArgs(opcode.StartLoop, ccb.pos, endBlockLbl, iterBlockLbl)
+	ccb.code.addLabeledArgs(opcode.IterNext, ccb.pos, exitLbl)
 
 	bodyCCB := &codeBlockCompiler{
 		constants: ccb.constants,
-		locals:    bodyStrTable,
+		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
 		names:     ccb.names,
 		code:      NewInstSet(),
 		filename:  ccb.filename,
 		name:      ccb.name,
 		inLoop:    true,
-		linenum:   ccb.linenum,
+		loopBody:  true,
+		loopLabel: loopLabel(loop.Label),
+		pos:       ccb.pos,
+	}
+
+	if loop.Pattern != nil {
+		compileDestructure(bodyCCB, loop.Pattern, func(name string) {
+			bodyCCB.code.addInst(opcode.Define, bodyCCB.pos, bodyCCB.define(name))
+		})
+	} else {
+		bodyCCB.code.addInst(opcode.Define, bodyCCB.pos, bodyCCB.define(loop.Value.Value))
 	}
+
+	if loop.Key != nil {
+		bodyCCB.code.addInst(opcode.Define, bodyCCB.pos, bodyCCB.define(loop.Key.Value))
+	} else {
+		bodyCCB.code.addInst(opcode.Pop, bodyCCB.pos)
+	}
+
 	compile(bodyCCB, loop.Body)
-	ccb.linenum = bodyCCB.linenum
+	ccb.pos = bodyCCB.pos
 
 	// If the body ends in an expression, we need to pop it so the stack is correct
 	if _, ok := loop.Body.Statements[len(loop.Body.Statements)-1].(*ast.ExpressionStatement); ok {
-		bodyCCB.code.addInst(opcode.Pop, ccb.linenum)
+		bodyCCB.code.addInst(opcode.Pop, ccb.pos)
 	}
 
 	// This copies the local variables into the outer compile block for table indexing
-	for _, n := range bodyCCB.locals.table[len(ccb.locals.table):] {
-		ccb.locals.indexOf(n)
-	}
+	ccb.locals.extend(bodyCCB.locals)
 	ccb.code.merge(bodyCCB.code)
 
-	ccb.code.addLabel(iterBlockLbl, ccb.linenum)
-	ccb.code.addInst(opcode.NextIter, ccb.linenum)
-	ccb.code.addLabel(endBlockLbl, ccb.linenum)
-	ccb.code.addInst(opcode.EndBlock, ccb.linenum)
-	ccb.code.addInst(opcode.CloseScope, ccb.linenum)
-	ccb.code.addInst(opcode.Pop, ccb.linenum) // Iterator object
+	ccb.code.addLabel(iterBlockLbl, ccb.pos)
+	ccb.code.addInst(opcode.NextIter, ccb.pos)
+	compileLoopEnd(ccb, loop.Else, exitLbl, endBlockLbl, func() {
+		ccb.code.addInst(opcode.EndBlock, ccb.pos)
+		ccb.code.addInst(opcode.CloseScope, ccb.pos)
+	})
+
+	ccb.code.addInst(opcode.EndBlock, ccb.pos)
+	compileLoadNull(ccb)
+	ccb.code.addLabel(closeLbl, ccb.pos)
+	ccb.code.addInst(opcode.CloseIter, ccb.pos)
+	ccb.code.addInst(opcode.EndFinally, ccb.pos)
+}
+
+func loopLabel(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.Value
+}
+
+// loopExitLabel returns the label a loop jumps to when it ends without a
+// break. Loops with an else block run it there, a break skips it.
+func loopExitLabel(elseBlock *ast.BlockStatement, endBlockLbl string) string {
+	if elseBlock == nil {
+		return endBlockLbl
+	}
+	return randomLabel("else_")
+}
+
+// compileLoopEnd compiles the end of a loop. closeLoop leaves the loop's block
+// and scopes. An else block runs before it, a break jumps past it.
+func compileLoopEnd(ccb *codeBlockCompiler, elseBlock *ast.BlockStatement, exitLbl, endBlockLbl string, closeLoop func()) {
+	if elseBlock != nil {
+		ccb.code.addLabel(exitLbl, ccb.pos)
+		compileLoopElse(ccb, elseBlock)
+	}
+
+	ccb.code.addLabel(endBlockLbl, ccb.pos)
+	closeLoop()
+}
+
+func compileLoopElse(ccb *codeBlockCompiler, block *ast.BlockStatement) {
+	ccb.code.addInst(opcode.OpenScope, ccb.pos)
+
+	elseCCB := &codeBlockCompiler{
+		constants: ccb.constants,
+		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
+		names:     ccb.names,
+		code:      NewInstSet(),
+		filename:  ccb.filename,
+		name:      ccb.name,
+		inLoop:    ccb.inLoop,
+		loopElse:  true,
+		pos:       block.Token.Pos,
+	}
+	compile(elseCCB, block)
+	ccb.pos = elseCCB.pos
+
+	// If the block ends in an expression, we need to pop it so the stack is correct
+	if l := len(block.Statements); l > 0 {
+		if _, ok := block.Statements[l-1].(*ast.ExpressionStatement); ok {
+			elseCCB.code.addInst(opcode.Pop, ccb.pos)
+		}
+	}
+
+	// This copies the local variables into the outer compile block for table indexing
+	ccb.locals.extend(elseCCB.locals)
+	ccb.code.merge(elseCCB.code)
+	ccb.code.addInst(opcode.CloseScope, ccb.pos)
+}
+
+// compileLoopJump compiles a break or continue. A labeled jump to an outer
+// loop leaves the loops nested inside it first. The loop an else block belongs
+// to is still open while it runs, so jumps in it leave that loop too.
+func compileLoopJump(ccb *codeBlockCompiler, code, outerCode opcode.Opcode, label *ast.Identifier) {
+	depth := 0
+	for c := ccb; c != nil; c = c.outer {
+		if c.loopElse {
+			depth++
+			continue
+		}
+		if !c.loopBody {
+			continue
+		}
+		if label == nil || c.loopLabel == label.Value {
+			if depth == 0 {
+				ccb.code.addInst(code, ccb.pos)
+			} else {
+				ccb.code.addInst(outerCode, ccb.pos, uint32(depth))
+			}
+			return
+		}
+		depth++
+	}
+	if label == nil {
+		panic("break or continue used in non-loop block")
+	}
+	panic(fmt.Sprintf("unknown loop label %s", label.Value))
 }
 
 func compileDoBlock(ccb *codeBlockCompiler, node *ast.DoExpression) {
-	ccb.linenum = node.Token.Pos.Line
-	ccb.code.addInst(opcode.OpenScope, ccb.linenum)
+	ccb.pos = node.Token.Pos
+	ccb.code.addInst(opcode.OpenScope, ccb.pos)
 
 	bodyCCB := &codeBlockCompiler{
 		constants: ccb.constants,
 		locals:    newStringTableOffset(len(ccb.locals.table)),
+		outer:     ccb,
 		names:     ccb.names,
 		code:      NewInstSet(),
 		filename:  ccb.filename,
 		name:      ccb.name,
 		inLoop:    ccb.inLoop,
-		linenum:   ccb.linenum,
+		pos:       ccb.pos,
 	}
 	compile(bodyCCB, node.Statements)
-	ccb.linenum = bodyCCB.linenum
+	ccb.pos = bodyCCB.pos
 
 	// This copies the local variables into the outer compile block for table indexing
-	for _, n := range bodyCCB.locals.table[len(ccb.locals.table):] {
-		ccb.locals.indexOf(n)
-	}
+	ccb.locals.extend(bodyCCB.locals)
 	ccb.code.merge(bodyCCB.code)
 
-	ccb.code.addInst(opcode.CloseScope, ccb.linenum)
+	ccb.code.addInst(opcode.CloseScope, ccb.pos)
 }
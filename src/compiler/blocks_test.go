@@ -0,0 +1,23 @@
+package compiler
+
+import "testing"
+
+func TestLoopElseBlockSize(t *testing.T) {
+	src := `for x in [1] { x } else { 1 }
+while false { 1 } else { 1 }
+for i = 0; i < 1; i += 1 { i } else { 1 }
+for x in [1] {
+	for y in [1] {
+		for z in [1] { z }
+	}
+}`
+
+	// Each for in loop has a loop block and the finally block closing its iterator
+	ccb := compileTestCode(t, src)
+	if size := calculateBlockSize(ccb.code); size != 6 {
+		t.Errorf("Wrong block size. Expected 6, got %d", size)
+	}
+	if after := sizesAfter(ccb.code)[ccb.code.Tail]; after.blocks != 0 || after.stack != 0 {
+		t.Errorf("Loops didn't leave their blocks and stack. Got %v", after)
+	}
+}
@@ -6,12 +6,7 @@ type maxsizer struct {
 	max, current int
 }
 
-func (s *maxsizer) sub(delta int) {
-	s.current -= delta
-	if s.current > s.max { // Delta can be negative which would add to the size
-		s.max = s.current
-	}
-}
+// add changes the current size by delta, which is negative when the size shrinks.
 func (s *maxsizer) add(delta int) {
 	s.current += delta
 	if s.current > s.max {
@@ -21,49 +16,63 @@ func (s *maxsizer) add(delta int) {
 
 func calculateStackSize(c *InstSet) int {
 	stackSize := &maxsizer{}
-
-	i := c.Head
-	for i != nil {
-		switch i.Instr {
-		case opcode.LoadConst, opcode.LoadFast, opcode.LoadGlobal, opcode.StartTry, opcode.Import, opcode.Dup:
-			stackSize.add(1)
-		case opcode.StoreIndex:
-			stackSize.sub(3)
-		case opcode.BinaryAdd, opcode.BinarySub, opcode.BinaryMul, opcode.BinaryDivide, opcode.BinaryMod, opcode.BinaryShiftL,
-			opcode.BinaryShiftR, opcode.BinaryAnd, opcode.BinaryOr, opcode.BinaryNot, opcode.BinaryAndNot,
-			opcode.StoreConst, opcode.StoreFast, opcode.Define, opcode.StoreGlobal, opcode.LoadIndex, opcode.Compare,
-			opcode.Return, opcode.Pop, opcode.PopJumpIfTrue, opcode.PopJumpIfFalse, opcode.Throw, opcode.Implements:
-			stackSize.sub(1)
-		case opcode.Call:
-			stackSize.sub(int(i.Args[0]))
-		case opcode.MakeArray:
-			stackSize.sub(int(i.Args[0]) - 1)
-		case opcode.BuildClass:
-			stackSize.sub(int(i.Args[0]) + 2)
-		case opcode.MakeMap:
-			stackSize.sub(int(i.Args[0])*2 - 1)
-		case opcode.MakeFunction, opcode.StoreAttribute:
-			stackSize.sub(2)
-		}
-		i = i.Next
+	for i := c.Head; i != nil; i = i.Next {
+		stackSize.add(stackEffect(i))
 	}
-
 	return stackSize.max
 }
 
+// stackEffect is the change of the stack's size after running i.
+func stackEffect(i *Instruction) int {
+	switch i.Instr {
+	case opcode.LoadConst, opcode.LoadFast, opcode.LoadGlobal, opcode.StartTry, opcode.Import, opcode.Dup, opcode.LoadRest, opcode.LoadUpvalue:
+		return 1
+	case opcode.StoreIndex:
+		return -3
+	case opcode.BinaryAdd, opcode.BinarySub, opcode.BinaryMul, opcode.BinaryDivide, opcode.BinaryMod, opcode.BinaryPow, opcode.BinaryShiftL,
+		opcode.BinaryShiftR, opcode.BinaryAnd, opcode.BinaryOr, opcode.BinaryNot, opcode.BinaryAndNot,
+		opcode.StoreConst, opcode.StoreFast, opcode.Define, opcode.StoreGlobal, opcode.LoadIndex, opcode.Compare,
+		opcode.Return, opcode.Pop, opcode.PopJumpIfTrue, opcode.PopJumpIfFalse, opcode.Throw, opcode.Implements,
+		opcode.EndFinally, opcode.MatchException, opcode.Yield, opcode.Extend, opcode.IsInstance, opcode.NoMatch,
+		opcode.StoreUpvalue, opcode.Defer, opcode.ExitWith, opcode.CloseIter:
+		return -1
+	case opcode.Call, opcode.CheckKeys, opcode.MatchKeys:
+		return -int(i.Args[0])
+	case opcode.CallKw, opcode.MakeInstanceKw, opcode.CallMethod, opcode.BuildTrait:
+		return -int(i.Args[0]) - 1
+	case opcode.MakeArray, opcode.BuildString:
+		return 1 - int(i.Args[0])
+	case opcode.BuildClass:
+		return -int(i.Args[0]) - 7
+	case opcode.BuildSlice, opcode.MakeRange:
+		return -2
+	case opcode.IterNext:
+		return 2
+	case opcode.EnterWith, opcode.LoadMethod:
+		return 1
+	case opcode.MakeMap:
+		return 1 - int(i.Args[0])*2
+	case opcode.MakeFunction, opcode.StoreAttribute, opcode.CallSpread, opcode.MakeInstanceSpread:
+		return -2
+	}
+	return 0
+}
+
 func calculateBlockSize(c *InstSet) int {
 	blockLen := &maxsizer{}
-
-	i := c.Head
-	for i != nil {
-		switch i.Instr {
-		case opcode.StartLoop, opcode.StartTry:
-			blockLen.add(1)
-		case opcode.EndBlock:
-			blockLen.sub(1)
-		}
-		i = i.Next
+	for i := c.Head; i != nil; i = i.Next {
+		blockLen.add(blockEffect(i))
 	}
-
 	return blockLen.max
 }
+
+// blockEffect is the change of the block stack's size after running i.
+func blockEffect(i *Instruction) int {
+	switch i.Instr {
+	case opcode.StartLoop, opcode.StartTry, opcode.StartFinally, opcode.EnterWith:
+		return 1
+	case opcode.EndBlock:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package compiler
+
+import (
+	"github.com/nitrogen-lang/nitrogen/src/ast"
+	"github.com/nitrogen-lang/nitrogen/src/object"
+	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
+)
+
+// compileChain compiles an attribute access, index, or call. If the chain has
+// an optional link, a nil value at that link skips the rest of the chain and
+// the whole expression evaluates to nil.
+func compileChain(ccb *codeBlockCompiler, node ast.Expression) {
+	if !ast.IsOptionalChain(node) {
+		compileChainLink(ccb, node, "")
+		return
+	}
+
+	nilLbl := randomLabel("nil_")
+	compileChainLink(ccb, node, nilLbl)
+	ccb.code.addLabel(nilLbl, ccb.pos)
+}
+
+// compileChainLink compiles one link of a chain. Optional links jump to nilLbl
+// with nil on the stack when their left side is nil.
+func compileChainLink(ccb *codeBlockCompiler, node ast.Expression, nilLbl string) {
+	switch node := node.(type) {
+	case *ast.AttributeExpression:
+		ccb.pos = node.Token.Pos
+		ccb.checkMemberAccess(node)
+		compileChainLink(ccb, node.Left, nilLbl)
+		if node.Optional {
+			ccb.code.addLabeledArgs(opcode.JumpIfNil, ccb.pos, nilLbl)
+		}
+		ccb.code.addInst(opcode.LoadAttribute, ccb.pos, ccb.names.indexOf(node.Index.String()), 0) // Cache slot is set by Assemble
+
+	case *ast.IndexExpression:
+		ccb.pos = node.Token.Pos
+		compileChainLink(ccb, node.Left, nilLbl)
+		if node.Optional {
+			ccb.code.addLabeledArgs(opcode.JumpIfNil, ccb.pos, nilLbl)
+		}
+		compile(ccb, node.Index)
+		ccb.code.addInst(opcode.LoadIndex, ccb.pos)
+
+	case *ast.CallExpression:
+		compileCallExpression(ccb, node, nilLbl)
+
+	default:
+		compile(ccb, node)
+	}
+}
+
+// compileCallExpression compiles a call. The arguments are evaluated before
+// the function, so when an optional link in the function's chain is nil the
+// arguments are popped before jumping to nilLbl.
+func compileCallExpression(ccb *codeBlockCompiler, call *ast.CallExpression, nilLbl string) {
+	ccb.pos = call.Token.Pos
+
+	var callInst opcode.Opcode
+	pushed := len(call.Arguments)
+
+	if hasSpread(call.Arguments) {
+		compileSpreadList(ccb, call.Arguments)
+		compileKeywordArgs(ccb, call.Keywords)
+		callInst = opcode.CallSpread
+		pushed = 2
+	} else {
+		for i := len(call.Arguments) - 1; i >= 0; i-- {
+			compile(ccb, call.Arguments[i])
+		}
+		callInst = opcode.Call
+		if len(call.Keywords) > 0 {
+			compileKeywordArgs(ccb, call.Keywords)
+			callInst = opcode.CallKw
+			pushed++
+		}
+	}
+
+	if !call.Optional && !ast.IsOptionalChain(call.Function) {
+		if attrib, ok := call.Function.(*ast.AttributeExpression); ok && callInst == opcode.Call {
+			compileMethodCall(ccb, attrib, len(call.Arguments))
+			return
+		}
+		compile(ccb, call.Function)
+		ccb.pos = call.Token.Pos
+		addCallInst(ccb, callInst, len(call.Arguments))
+		return
+	}
+
+	callNilLbl := randomLabel("nil_")
+	doneLbl := randomLabel("call_")
+
+	compileChainLink(ccb, call.Function, callNilLbl)
+	ccb.pos = call.Token.Pos
+	if call.Optional {
+		ccb.code.addLabeledArgs(opcode.JumpIfNil, ccb.pos, callNilLbl)
+	}
+	addCallInst(ccb, callInst, len(call.Arguments))
+	ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.pos, doneLbl)
+
+	// The nil function and the arguments are replaced with nil
+	ccb.code.addLabel(callNilLbl, ccb.pos)
+	for i := 0; i <= pushed; i++ {
+		ccb.code.addInst(opcode.Pop, ccb.pos)
+	}
+	ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(object.NullConst))
+	if nilLbl != "" {
+		ccb.code.addLabeledArgs(opcode.JumpAbsolute, ccb.pos, nilLbl)
+	}
+	ccb.code.addLabel(doneLbl, ccb.pos)
+}
+
+// compileMethodCall compiles a call of an attribute whose arguments are already
+// on the stack. LOAD_METHOD leaves the instance under the method so CALL_METHOD
+// can call it without making a bound method first.
+func compileMethodCall(ccb *codeBlockCompiler, attrib *ast.AttributeExpression, argc int) {
+	ccb.pos = attrib.Token.Pos
+	ccb.checkMemberAccess(attrib)
+	compile(ccb, attrib.Left)
+	ccb.pos = attrib.Token.Pos
+	ccb.code.addInst(opcode.LoadMethod, ccb.pos, ccb.names.indexOf(attrib.Index.String()), 0)
+	ccb.code.addInst(opcode.CallMethod, ccb.pos, uint32(argc))
+}
+
+func addCallInst(ccb *codeBlockCompiler, callInst opcode.Opcode, argc int) {
+	if callInst == opcode.CallSpread {
+		ccb.code.addInst(callInst, ccb.pos)
+		return
+	}
+	ccb.code.addInst(callInst, ccb.pos, uint32(argc))
+}
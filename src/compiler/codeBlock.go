@@ -3,24 +3,41 @@ package compiler
 import (
 	"encoding/binary"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/nitrogen-lang/nitrogen/src/object"
+	"github.com/nitrogen-lang/nitrogen/src/token"
 	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
 )
 
 type CodeBlock struct {
-	Name         string
-	Filename     string
-	LocalCount   int
-	MaxStackSize int
-	MaxBlockSize int
-	Constants    []object.Object // Created at compile time
-	Locals       []string        // Created by compile time
-	Names        []string        // Created at compile time
-	Code         []byte
-	Native       bool
-	ClassMethod  bool
-	LineOffsets  []uint16
+	Name          string
+	Filename      string
+	LocalCount    int
+	Caches        []atomic.Value // Inline caches of the attribute instructions, shared by every VM running the code
+	MaxStackSize  int
+	MaxBlockSize  int
+	Constants     []object.Object // Created at compile time
+	Locals        []string        // Created by compile time
+	EnvLocals     []bool          // Locals also declared in the environment, the others are only used through their slot
+	Names         []string        // Created at compile time
+	Code          []byte
+	Native        bool
+	ClassMethod   bool
+	Generator     bool         // Calling the function returns a generator instead of running the body
+	Async         bool         // Calling the function starts a task instead of running the body
+	Defaults      []*CodeBlock // Default values of parameters, nil entries are required parameters
+	UsesArguments bool         // The `arguments` array is only made for functions that use it
+	Upvalues      []Upvalue    // Variables captured from enclosing functions when the function is made
+	LineOffsets   []LineOffset
+}
+
+// LineOffset maps the bytecode from Offset up to the next entry to a position
+// in the source.
+type LineOffset struct {
+	Offset uint32
+	Line   uint32
+	Col    uint32
 }
 
 // Implement object.Object interface
@@ -31,47 +48,76 @@ func (cb *CodeBlock) Dup() object.Object      { return object.NullConst }
 func (cb *CodeBlock) Print(indent string) {
 	offset := 0
 	lineOffsetIdx := 0
+	var ext [2]int // High bits of the arguments set by EXTENDED_ARG
 
 	for offset < len(cb.Code) {
 		code := opcode.Opcode(cb.Code[offset])
-		if lineOffsetIdx < len(cb.LineOffsets) && int(cb.LineOffsets[lineOffsetIdx]) == offset {
-			fmt.Printf("%s%d\t%s%d:\t%s", indent, cb.LineOffsets[lineOffsetIdx+1], indent, offset, opcode.Names[code])
-			lineOffsetIdx += 2
+		if lineOffsetIdx < len(cb.LineOffsets) && int(cb.LineOffsets[lineOffsetIdx].Offset) == offset {
+			pos := cb.LineOffsets[lineOffsetIdx]
+			fmt.Printf("%s%d:%d\t%s%d:\t%s", indent, pos.Line, pos.Col, indent, offset, opcode.Names[code])
+			lineOffsetIdx++
 		} else {
 			fmt.Printf("%s\t%s%d:\t%s", indent, indent, offset, opcode.Names[code])
 		}
 		offset++
 
+		arg := func(n int) int {
+			return ext[n]<<16 | int(bytesToUint16(cb.Code[offset+n*2], cb.Code[offset+n*2+1]))
+		}
 		switch code {
-		case opcode.MakeArray, opcode.MakeMap, opcode.StartTry, opcode.BuildClass, opcode.MakeInstance:
-			fmt.Printf("\t\t%d", bytesToUint16(cb.Code[offset], cb.Code[offset+1]))
+		case opcode.MakeArray, opcode.MakeMap, opcode.StartTry, opcode.StartFinally, opcode.BuildClass, opcode.BuildTrait, opcode.MakeInstance, opcode.MakeInstanceKw,
+			opcode.CheckLength, opcode.LoadRest, opcode.CheckKeys, opcode.MatchKeys, opcode.BuildString:
+			fmt.Printf("\t\t%d", arg(0))
 		case opcode.JumpForward:
-			target := int(bytesToUint16(cb.Code[offset], cb.Code[offset+1]))
+			target := arg(0)
 			fmt.Printf("\t\t%d (%d)", target, offset+2+target)
 		case opcode.JumpAbsolute:
-			target := int(bytesToUint16(cb.Code[offset], cb.Code[offset+1]))
-			fmt.Printf("\t\t%d", target)
-		case opcode.StartLoop:
-			fmt.Printf("\t\t%d %d", bytesToUint16(cb.Code[offset], cb.Code[offset+1]), bytesToUint16(cb.Code[offset+2], cb.Code[offset+3]))
-		case opcode.PopJumpIfTrue, opcode.PopJumpIfFalse, opcode.JumpIfTrueOrPop, opcode.JumpIfFalseOrPop:
-			fmt.Printf("\t%d", bytesToUint16(cb.Code[offset], cb.Code[offset+1]))
+			fmt.Printf("\t\t%d", arg(0))
+		case opcode.ExtendedArg:
+			fmt.Printf("\t\t%d %d", arg(0), arg(1))
+		case opcode.StartLoop, opcode.MatchLength:
+			fmt.Printf("\t\t%d %d", arg(0), arg(1))
+		case opcode.PopJumpIfTrue, opcode.PopJumpIfFalse, opcode.JumpIfTrueOrPop, opcode.JumpIfFalseOrPop,
+			opcode.JumpIfNil, opcode.JumpIfNotNilOrPop, opcode.IterNext, opcode.EnterWith:
+			fmt.Printf("\t%d", arg(0))
 		case opcode.LoadConst, opcode.Import:
-			index := bytesToUint16(cb.Code[offset], cb.Code[offset+1])
+			index := arg(0)
 			fmt.Printf("\t\t%d (%s)", index, cb.Constants[index].Inspect())
 		case opcode.LoadFast, opcode.StoreFast, opcode.StoreConst, opcode.DeleteFast:
-			index := bytesToUint16(cb.Code[offset], cb.Code[offset+1])
+			index := arg(0)
 			fmt.Printf("\t\t%d (%s)", index, cb.Locals[index])
 		case opcode.Define:
-			index := bytesToUint16(cb.Code[offset], cb.Code[offset+1])
+			index := arg(0)
 			fmt.Printf("\t\t\t%d (%s)", index, cb.Locals[index])
-		case opcode.Call:
-			params := bytesToUint16(cb.Code[offset], cb.Code[offset+1])
+		case opcode.LoadUpvalue, opcode.StoreUpvalue:
+			index := arg(0)
+			fmt.Printf("\t\t%d (%s)", index, cb.Upvalues[index].Name)
+		case opcode.LoadAttribute, opcode.StoreAttribute, opcode.LoadMethod:
+			index := arg(0)
+			fmt.Printf("\t\t%d (%s) cache %d", index, cb.Names[index], arg(1))
+		case opcode.Call, opcode.CallMethod:
+			params := arg(0)
 			fmt.Printf("\t\t\t%d (%d positional parameters)", params, params)
-		case opcode.LoadGlobal, opcode.StoreGlobal, opcode.LoadAttribute, opcode.StoreAttribute:
-			index := bytesToUint16(cb.Code[offset], cb.Code[offset+1])
+		case opcode.CallKw:
+			params := arg(0)
+			fmt.Printf("\t\t\t%d (%d positional parameters, keyword map)", params, params)
+		case opcode.LoadGlobal, opcode.StoreGlobal:
+			index := arg(0)
 			fmt.Printf("\t\t%d (%s)", index, cb.Names[index])
 		case opcode.Compare:
 			fmt.Printf("\t\t\t%d (%s)", cb.Code[offset], opcode.CmpOps[cb.Code[offset]])
+		case opcode.IsType:
+			fmt.Printf("\t\t\t%d (%s)", cb.Code[offset], object.ObjectType(cb.Code[offset]))
+		case opcode.MakeRange:
+			fmt.Printf("\t\t%d (inclusive %t)", cb.Code[offset], cb.Code[offset] == 1)
+		case opcode.BreakOuter, opcode.ContinueOuter:
+			fmt.Printf("\t\t%d (outer loops)", cb.Code[offset])
+		}
+
+		if code == opcode.ExtendedArg {
+			ext = [2]int{arg(0), arg(1)}
+		} else {
+			ext = [2]int{}
 		}
 
 		switch {
@@ -98,7 +144,21 @@ type codeBlockCompiler struct {
 	code           *InstSet
 	filename, name string
 	inLoop         bool
-	linenum        uint
+	loopBody       bool   // Body of a loop, break and continue in it leave this block
+	loopLabel      string // Label of the loop when loopBody is set
+	loopElse       bool   // Else block of a loop, it runs before the loop's block is left
+	pos            token.Position
+	outer          *codeBlockCompiler // Enclosing block in the same function, nil for the function body
+	enclosing      *codeBlockCompiler // Block the function is defined in, nil for module level code
+	envOuter       *codeBlockCompiler // Block a class block is defined in or function body of a default value block, they have no enclosing block
+	upvalues       []Upvalue          // Captured variables, only used by the function body
+	inClass        bool               // Function body of a method or a class's field block
+	scope          map[string]uint32  // Slots of the locals declared so far in this block
+	consts         map[string]bool    // Locals of scope that are constants
+	envSlots       map[uint32]bool    // Locals also declared in the environment, only used by the function body
+	envNames       map[string]bool    // Names looked up in the environment by the function or nested ones, only used by the function body
+	envAll         bool               // All locals are declared in the environment, only used by the function body
+	caches         int                // Inline cache slots, set when the code is assembled
 }
 
 type constantTable struct {
@@ -111,7 +171,7 @@ func newConstantTable() *constantTable {
 	}
 }
 
-func (t *constantTable) indexOf(v object.Object) uint16 {
+func (t *constantTable) indexOf(v object.Object) uint32 {
 	for i, o := range t.table {
 		if o.Type() != v.Type() {
 			continue
@@ -119,32 +179,32 @@ func (t *constantTable) indexOf(v object.Object) uint16 {
 
 		switch node := v.(type) {
 		case *object.Null:
-			return uint16(i)
+			return uint32(i)
 		case *object.Integer:
 			if node.Value == o.(*object.Integer).Value {
-				return uint16(i)
+				return uint32(i)
 			}
 		case *object.String:
 			if node.Inspect() == o.(*object.String).Inspect() {
-				return uint16(i)
+				return uint32(i)
 			}
 		case *object.Float:
 			if node.Value == o.(*object.Float).Value {
-				return uint16(i)
+				return uint32(i)
 			}
 		case *object.Boolean:
 			if node.Value == o.(*object.Boolean).Value {
-				return uint16(i)
+				return uint32(i)
 			}
 		case *object.Interface:
 			if node.Name == o.(*object.Interface).Name {
-				return uint16(i)
+				return uint32(i)
 			}
 		}
 	}
 
 	t.table = append(t.table, v)
-	return uint16(len(t.table) - 1)
+	return uint32(len(t.table) - 1)
 }
 
 type stringTable struct {
@@ -166,15 +226,27 @@ func newStringTableOffset(offset int) *stringTable {
 	}
 }
 
-func (t *stringTable) indexOf(v string) uint16 {
+func (t *stringTable) indexOf(v string) uint32 {
 	for i, s := range t.table {
 		if s == v {
-			return uint16(i)
+			return uint32(i)
 		}
 	}
 
 	t.table = append(t.table, v)
-	return uint16(len(t.table) - 1)
+	return uint32(len(t.table) - 1)
+}
+
+// add appends v to the table even if it's already in it.
+func (t *stringTable) add(v string) uint32 {
+	t.table = append(t.table, v)
+	return uint32(len(t.table) - 1)
+}
+
+// extend adds the locals of a scoped sub block. The sub table must have been
+// created with newStringTableOffset so the indexes it handed out stay valid.
+func (t *stringTable) extend(sub *stringTable) {
+	t.table = append(t.table, sub.table[len(t.table):]...)
 }
 
 func (t *stringTable) contains(s string) bool {
@@ -186,8 +258,6 @@ func (t *stringTable) contains(s string) bool {
 	return false
 }
 
-func uint16ToBytes(i uint16) []byte {
-	b := make([]byte, 2)
+func putUint16(b []byte, i uint16) {
 	binary.BigEndian.PutUint16(b, i)
-	return b
 }
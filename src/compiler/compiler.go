@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/nitrogen-lang/nitrogen/src/ast"
 	"github.com/nitrogen-lang/nitrogen/src/object"
@@ -20,12 +21,17 @@ func compileFrame(node ast.Node, name, filename string) *CodeBlock {
 		code:      NewInstSet(),
 		filename:  filename,
 		name:      name,
-		linenum:   0,
 	}
 
 	compile(ccb, node)
+	if ccb.code.contains(opcode.Yield) {
+		panic("yield used outside of a function")
+	}
+	if ccb.code.contains(opcode.Await) {
+		panic("await used outside of an async function")
+	}
 	if !ccb.code.last().Is(opcode.Return) {
-		ccb.code.addInst(opcode.Return, ccb.linenum)
+		ccb.code.addInst(opcode.Return, ccb.pos)
 	}
 
 	code := ccb.code
@@ -34,10 +40,12 @@ func compileFrame(node ast.Node, name, filename string) *CodeBlock {
 		Name:         name,
 		Filename:     filename,
 		LocalCount:   len(ccb.locals.table),
+		Caches:       make([]atomic.Value, ccb.caches),
 		Code:         assembledCode,
 		Constants:    ccb.constants.table,
 		Names:        ccb.names.table,
 		Locals:       ccb.locals.table,
+		EnvLocals:    ccb.envLocals(),
 		MaxStackSize: calculateStackSize(code),
 		MaxBlockSize: calculateBlockSize(code),
 		LineOffsets:  lineOffsets,
@@ -65,46 +73,73 @@ func compile(ccb *codeBlockCompiler, node ast.Node) {
 
 	// Literals
 	case *ast.IntegerLiteral:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		i := object.MakeIntObj(node.Value)
-		ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(i))
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(i))
 
 	case *ast.NullLiteral:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		compileLoadNull(ccb)
 
 	case *ast.StringLiteral:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		str := &object.String{Value: node.Value}
-		ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(str))
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(str))
+
+	case *ast.InterpolatedString:
+		ccb.pos = node.Token.Pos
+		for _, part := range node.Parts {
+			compile(ccb, part)
+		}
+		ccb.code.addInst(opcode.BuildString, ccb.pos, uint32(len(node.Parts)))
 
 	case *ast.FloatLiteral:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		float := &object.Float{Value: node.Value}
-		ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(float))
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(float))
 
 	case *ast.Boolean:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		b := object.NativeBoolToBooleanObj(node.Value)
-		ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(b))
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(b))
 
 	case *ast.Array:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
+		if hasSpread(node.Elements) {
+			compileSpreadList(ccb, node.Elements)
+			break
+		}
 		for _, e := range node.Elements {
 			compile(ccb, e)
 		}
-		ccb.code.addInst(opcode.MakeArray, ccb.linenum, uint16(len(node.Elements)))
+		ccb.code.addInst(opcode.MakeArray, ccb.pos, uint32(len(node.Elements)))
 
 	case *ast.HashLiteral:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
+		if len(node.Spreads) > 0 {
+			ccb.code.addInst(opcode.MakeMap, ccb.pos, 0)
+			for _, spread := range node.Spreads {
+				compile(ccb, spread.Value)
+				ccb.code.addInst(opcode.Extend, ccb.pos)
+			}
+		}
 		for k, v := range node.Pairs {
 			compile(ccb, v)
 			compile(ccb, k)
 		}
-		ccb.code.addInst(opcode.MakeMap, ccb.linenum, uint16(len(node.Pairs)))
+		ccb.code.addInst(opcode.MakeMap, ccb.pos, uint32(len(node.Pairs)))
+		if len(node.Spreads) > 0 {
+			ccb.code.addInst(opcode.Extend, ccb.pos)
+		}
+
+	case *ast.ArrayPattern, *ast.MapPattern:
+		panic("destructuring pattern used as a value")
+
+	case *ast.SpreadExpression:
+		panic("spread used outside of a call, array or map")
 
 	case *ast.InterfaceLiteral:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		iface := &object.Interface{
 			Name:    node.Name,
 			Methods: make(map[string]*object.IfaceMethodDef, len(node.Methods)),
@@ -117,109 +152,143 @@ func compile(ccb *codeBlockCompiler, node ast.Node) {
 			}
 		}
 
-		ccb.code.addInst(opcode.LoadConst, ccb.linenum, ccb.constants.indexOf(iface))
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(iface))
+
+	case *ast.EnumLiteral:
+		ccb.pos = node.Token.Pos
+		enum := object.NewEnum(node.Name)
+		for _, member := range node.Members {
+			enum.AddMember(member.Name, member.Fields)
+		}
+
+		ccb.code.addInst(opcode.LoadConst, ccb.pos, ccb.constants.indexOf(enum))
 
 	// Expressions
 	case *ast.Identifier:
-		ccb.linenum = node.Token.Pos.Line
-		if ccb.locals.contains(node.Value) {
-			ccb.code.addInst(opcode.LoadFast, ccb.linenum, ccb.locals.indexOf(node.Value))
+		ccb.pos = node.Token.Pos
+		if slot, ok := ccb.resolveLocal(node.Value); ok {
+			ccb.code.addInst(opcode.LoadFast, ccb.pos, slot)
+		} else if index, ok := ccb.resolveUpvalue(node.Value); ok {
+			ccb.code.addInst(opcode.LoadUpvalue, ccb.pos, index)
 		} else {
-			ccb.code.addInst(opcode.LoadGlobal, ccb.linenum, ccb.names.indexOf(node.Value))
+			ccb.code.addInst(opcode.LoadGlobal, ccb.pos, ccb.lookupName(node.Value))
 		}
 
 	case *ast.PrefixExpression:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		compile(ccb, node.Right)
 
 		switch node.Operator {
 		case "!":
-			ccb.code.addInst(opcode.UnaryNot, ccb.linenum)
+			ccb.code.addInst(opcode.UnaryNot, ccb.pos)
 		case "-":
-			ccb.code.addInst(opcode.UnaryNeg, ccb.linenum)
+			ccb.code.addInst(opcode.UnaryNeg, ccb.pos)
 		}
 
 	case *ast.InfixExpression:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		compile(ccb, node.Left)
 		compile(ccb, node.Right)
 
 		switch node.Operator {
 		case "+":
-			ccb.code.addInst(opcode.BinaryAdd, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryAdd, ccb.pos)
 		case "-":
-			ccb.code.addInst(opcode.BinarySub, ccb.linenum)
+			ccb.code.addInst(opcode.BinarySub, ccb.pos)
 		case "*":
-			ccb.code.addInst(opcode.BinaryMul, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryMul, ccb.pos)
 		case "/":
-			ccb.code.addInst(opcode.BinaryDivide, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryDivide, ccb.pos)
 		case "%":
-			ccb.code.addInst(opcode.BinaryMod, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryMod, ccb.pos)
+		case "**":
+			ccb.code.addInst(opcode.BinaryPow, ccb.pos)
 		case "<<":
-			ccb.code.addInst(opcode.BinaryShiftL, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryShiftL, ccb.pos)
 		case ">>":
-			ccb.code.addInst(opcode.BinaryShiftR, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryShiftR, ccb.pos)
 		case "&":
-			ccb.code.addInst(opcode.BinaryAnd, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryAnd, ccb.pos)
 		case "&^":
-			ccb.code.addInst(opcode.BinaryAndNot, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryAndNot, ccb.pos)
 		case "|":
-			ccb.code.addInst(opcode.BinaryOr, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryOr, ccb.pos)
 		case "^":
-			ccb.code.addInst(opcode.BinaryNot, ccb.linenum)
+			ccb.code.addInst(opcode.BinaryNot, ccb.pos)
 		case "<":
-			ccb.code.addInst(opcode.Compare, ccb.linenum, uint16(opcode.CmpLT))
+			ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpLT))
 		case ">":
-			ccb.code.addInst(opcode.Compare, ccb.linenum, uint16(opcode.CmpGT))
+			ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpGT))
 		case "==":
-			ccb.code.addInst(opcode.Compare, ccb.linenum, uint16(opcode.CmpEq))
+			ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpEq))
 		case "!=":
-			ccb.code.addInst(opcode.Compare, ccb.linenum, uint16(opcode.CmpNotEq))
+			ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpNotEq))
 		case "<=":
-			ccb.code.addInst(opcode.Compare, ccb.linenum, uint16(opcode.CmpLTEq))
+			ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpLTEq))
 		case ">=":
-			ccb.code.addInst(opcode.Compare, ccb.linenum, uint16(opcode.CmpGTEq))
+			ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpGTEq))
+		case "in":
+			ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpIn))
+		case "not in":
+			ccb.code.addInst(opcode.Compare, ccb.pos, uint32(opcode.CmpNotIn))
 		case "implements":
-			ccb.code.addInst(opcode.Implements, ccb.linenum)
+			ccb.code.addInst(opcode.Implements, ccb.pos)
 		}
 
 	case *ast.CallExpression:
-		ccb.linenum = node.Token.Pos.Line
-		for i := len(node.Arguments) - 1; i >= 0; i-- {
-			compile(ccb, node.Arguments[i])
-		}
-		compile(ccb, node.Function)
-		ccb.code.addInst(opcode.Call, ccb.linenum, uint16(len(node.Arguments)))
+		compileChain(ccb, node)
 
 	case *ast.ReturnStatement:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
+		compile(ccb, node.Value)
+		ccb.code.addInst(opcode.Return, ccb.pos)
+
+	case *ast.AwaitExpression:
+		ccb.pos = node.Token.Pos
+		compile(ccb, node.Value)
+		ccb.code.addInst(opcode.Await, ccb.pos)
+
+	case *ast.YieldStatement:
+		ccb.pos = node.Token.Pos
 		compile(ccb, node.Value)
-		ccb.code.addInst(opcode.Return, ccb.linenum)
+		ccb.code.addInst(opcode.Yield, ccb.pos)
 
 	case *ast.DefStatement:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		compile(ccb, node.Value)
 
+		if node.Pattern != nil {
+			compileDestructure(ccb, node.Pattern, func(name string) {
+				if node.Const {
+					ccb.code.addInst(opcode.StoreConst, ccb.pos, ccb.defineConst(name))
+				} else {
+					ccb.code.addInst(opcode.Define, ccb.pos, ccb.define(name))
+				}
+			})
+			break
+		}
+
 		if node.Const {
-			ccb.code.addInst(opcode.StoreConst, ccb.linenum, ccb.locals.indexOf(node.Name.Value))
+			ccb.code.addInst(opcode.StoreConst, ccb.pos, ccb.defineConst(node.Name.Value))
 		} else {
-			ccb.code.addInst(opcode.Define, ccb.linenum, ccb.locals.indexOf(node.Name.Value))
+			ccb.code.addInst(opcode.Define, ccb.pos, ccb.define(node.Name.Value))
 		}
 
 	case *ast.AssignStatement:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		compile(ccb, node.Value)
 
 		if indexed, ok := node.Left.(*ast.IndexExpression); ok {
 			compile(ccb, indexed.Index)
 			compile(ccb, indexed.Left)
-			ccb.code.addInst(opcode.StoreIndex, ccb.linenum)
+			ccb.code.addInst(opcode.StoreIndex, ccb.pos)
 			break
 		}
 
 		if attrib, ok := node.Left.(*ast.AttributeExpression); ok {
+			ccb.checkMemberAccess(attrib)
 			compile(ccb, attrib.Left)
-			ccb.code.addInst(opcode.StoreAttribute, ccb.linenum, ccb.names.indexOf(attrib.Index.String()))
+			ccb.code.addInst(opcode.StoreAttribute, ccb.pos, ccb.names.indexOf(attrib.Index.String()), 0)
 			break
 		}
 
@@ -228,15 +297,21 @@ func compile(ccb *codeBlockCompiler, node ast.Node) {
 			panic("Assignment to non ident or index")
 		}
 
-		if ccb.locals.contains(ident.Value) {
-			ccb.code.addInst(opcode.StoreFast, ccb.linenum, ccb.locals.indexOf(ident.Value))
+		if slot, ok := ccb.resolveLocal(ident.Value); ok {
+			ccb.code.addInst(opcode.StoreFast, ccb.pos, slot)
+		} else if index, ok := ccb.resolveUpvalue(ident.Value); ok {
+			ccb.code.addInst(opcode.StoreUpvalue, ccb.pos, index)
 		} else {
-			ccb.code.addInst(opcode.StoreGlobal, ccb.linenum, ccb.names.indexOf(ident.Value))
+			ccb.code.addInst(opcode.StoreGlobal, ccb.pos, ccb.lookupName(ident.Value))
 		}
 
 	case *ast.DeleteStatement:
-		ccb.linenum = node.Token.Pos.Line
-		ccb.code.addInst(opcode.DeleteFast, ccb.linenum, ccb.locals.indexOf(node.Name))
+		ccb.pos = node.Token.Pos
+		slot, ok := ccb.resolveLocal(node.Name)
+		if !ok {
+			slot = ccb.locals.add(node.Name) // Not a known local, deleted by name
+		}
+		ccb.code.addInst(opcode.DeleteFast, ccb.pos, slot)
 
 	case *ast.IfExpression:
 		compileIfStatement(ccb, node)
@@ -244,20 +319,20 @@ func compile(ccb *codeBlockCompiler, node ast.Node) {
 	case *ast.CompareExpression:
 		compileCompareExpression(ccb, node)
 
+	case *ast.MatchExpression:
+		compileMatchExpression(ccb, node)
+
 	case *ast.ImportStatement:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		str := &object.String{Value: node.Path.Value}
-		ccb.code.addInst(opcode.Import, ccb.linenum, ccb.constants.indexOf(str))
-		ccb.code.addInst(opcode.Define, ccb.linenum, ccb.locals.indexOf(node.Name.Value))
+		ccb.code.addInst(opcode.Import, ccb.pos, ccb.constants.indexOf(str))
+		ccb.code.addInst(opcode.Define, ccb.pos, ccb.define(node.Name.Value))
 
 	case *ast.FunctionLiteral:
 		compileFunction(ccb, node, false, false)
 
 	case *ast.IndexExpression:
-		ccb.linenum = node.Token.Pos.Line
-		compile(ccb, node.Left)
-		compile(ccb, node.Index)
-		ccb.code.addInst(opcode.LoadIndex, ccb.linenum)
+		compileChain(ccb, node)
 
 	case *ast.LoopStatement:
 		compileLoop(ccb, node)
@@ -266,46 +341,92 @@ func compile(ccb *codeBlockCompiler, node ast.Node) {
 		compileIterLoop(ccb, node)
 
 	case *ast.ContinueStatement:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		if !ccb.inLoop {
 			panic("continue used in non-loop block")
 		}
-		ccb.code.addInst(opcode.Continue, ccb.linenum)
+		compileLoopJump(ccb, opcode.Continue, opcode.ContinueOuter, node.Label)
 
 	case *ast.BreakStatement:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		if !ccb.inLoop {
 			panic("break used in non-loop block")
 		}
-		ccb.code.addInst(opcode.Break, ccb.linenum)
+		compileLoopJump(ccb, opcode.Break, opcode.BreakOuter, node.Label)
 
 	case *ast.TryCatchExpression:
 		compileTryCatch(ccb, node)
 
 	case *ast.ThrowStatement:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		compile(ccb, node.Expression)
-		ccb.code.addInst(opcode.Throw, ccb.linenum)
+		ccb.pos = node.Token.Pos
+		ccb.code.addInst(opcode.Throw, ccb.pos)
+
+	case *ast.DeferStatement:
+		compileDefer(ccb, node)
+
+	case *ast.WithStatement:
+		compileWith(ccb, node)
 
 	case *ast.ClassLiteral:
 		compileClassLiteral(ccb, node)
+	case *ast.TraitLiteral:
+		compileTraitLiteral(ccb, node)
 
 	case *ast.NewInstance:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
+		if hasSpread(node.Arguments) {
+			compileSpreadList(ccb, node.Arguments)
+			compileKeywordArgs(ccb, node.Keywords)
+			compile(ccb, node.Class)
+			ccb.code.addInst(opcode.MakeInstanceSpread, ccb.pos)
+			break
+		}
 		for i := len(node.Arguments) - 1; i >= 0; i-- {
 			compile(ccb, node.Arguments[i])
 		}
+		if len(node.Keywords) > 0 {
+			compileKeywordArgs(ccb, node.Keywords)
+			compile(ccb, node.Class)
+			ccb.code.addInst(opcode.MakeInstanceKw, ccb.pos, uint32(len(node.Arguments)))
+			break
+		}
 		compile(ccb, node.Class)
 
-		ccb.code.addInst(opcode.MakeInstance, ccb.linenum, uint16(len(node.Arguments)))
+		ccb.code.addInst(opcode.MakeInstance, ccb.pos, uint32(len(node.Arguments)))
 
 	case *ast.AttributeExpression:
-		ccb.linenum = node.Token.Pos.Line
-		compile(ccb, node.Left)
-		ccb.code.addInst(opcode.LoadAttribute, ccb.linenum, ccb.names.indexOf(node.Index.String()))
+		compileChain(ccb, node)
+
+	case *ast.SliceExpression:
+		ccb.pos = node.Token.Pos
+		for _, part := range []ast.Expression{node.Start, node.End, node.Step} {
+			if part == nil {
+				compileLoadNull(ccb)
+			} else {
+				compile(ccb, part)
+			}
+		}
+		ccb.code.addInst(opcode.BuildSlice, ccb.pos)
+
+	case *ast.RangeExpression:
+		ccb.pos = node.Token.Pos
+		compile(ccb, node.Start)
+		compile(ccb, node.End)
+		if node.Step == nil {
+			compileLoadNull(ccb)
+		} else {
+			compile(ccb, node.Step)
+		}
+		if node.Inclusive {
+			ccb.code.addInst(opcode.MakeRange, ccb.pos, 1)
+		} else {
+			ccb.code.addInst(opcode.MakeRange, ccb.pos, 0)
+		}
 
 	case *ast.PassStatement:
-		ccb.linenum = node.Token.Pos.Line
+		ccb.pos = node.Token.Pos
 		// Ignore
 
 	// Not implemented yet
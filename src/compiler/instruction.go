@@ -2,17 +2,19 @@ package compiler
 
 import (
 	"fmt"
+	"math"
 
+	"github.com/nitrogen-lang/nitrogen/src/token"
 	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
 )
 
 type Instruction struct {
 	Instr     opcode.Opcode
-	Args      []uint16 // len = 1 or 2
+	Args      []uint32 // len = 1 or 2
 	ArgLabels []string // len = 1 or 2, name of label for corresponding argument, prefix "~" means relative
 	Label     string   // Label names this instruction for linking later
 	Next      *Instruction
-	Line      uint
+	Pos       token.Position
 }
 
 func (i *Instruction) String() string {
@@ -28,25 +30,45 @@ func (i *Instruction) Is(code opcode.Opcode) bool {
 
 func (i *Instruction) IsLoad() bool {
 	switch i.Instr {
-	case opcode.LoadConst, opcode.LoadFast, opcode.LoadGlobal, opcode.LoadIndex, opcode.LoadAttribute:
+	case opcode.LoadConst, opcode.LoadFast, opcode.LoadGlobal, opcode.LoadIndex, opcode.LoadAttribute, opcode.LoadUpvalue:
 		return true
 	default:
 		return false
 	}
 }
 
-func (i *Instruction) Size() uint16 {
+// Size is the number of bytes the instruction is assembled to, including the
+// EXTENDED_ARG prefix when an argument doesn't fit in 16 bits.
+func (i *Instruction) Size() int {
+	size := 1
 	switch {
 	case i.Instr == opcode.Label:
 		return 0
 	case opcode.HasOneByteArg[i.Instr]:
 		return 2
 	case opcode.HasTwoByteArg[i.Instr]:
-		return 3
+		size = 3
 	case opcode.HasFourByteArg[i.Instr]:
-		return 5
+		size = 5
 	}
-	return 1
+
+	if i.extended() {
+		size += 5
+	}
+	return size
+}
+
+// extended checks if the instruction needs an EXTENDED_ARG prefix.
+func (i *Instruction) extended() bool {
+	if opcode.HasOneByteArg[i.Instr] {
+		return false
+	}
+	for _, arg := range i.Args {
+		if arg > math.MaxUint16 {
+			return true
+		}
+	}
+	return false
 }
 
 type InstSet struct {
@@ -65,12 +87,34 @@ func (i *InstSet) last() *Instruction {
 	return i.Tail
 }
 
-func (i *InstSet) addInst(code opcode.Opcode, line uint, args ...uint16) {
+func (i *InstSet) contains(code opcode.Opcode) bool {
+	for in := i.Head; in != nil; in = in.Next {
+		if in.Is(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesLocal checks if any instruction reads or writes the local variable at index.
+func (i *InstSet) usesLocal(index uint32) bool {
+	for in := i.Head; in != nil; in = in.Next {
+		switch in.Instr {
+		case opcode.LoadFast, opcode.StoreFast, opcode.DeleteFast, opcode.Define:
+			if in.Args[0] == index {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (i *InstSet) addInst(code opcode.Opcode, pos token.Position, args ...uint32) {
 	checkArgLength(code, len(args))
 	inst := &Instruction{
 		Instr: code,
 		Args:  args,
-		Line:  line,
+		Pos:   pos,
 	}
 
 	if i.Head == nil {
@@ -82,11 +126,11 @@ func (i *InstSet) addInst(code opcode.Opcode, line uint, args ...uint16) {
 	}
 }
 
-func (i *InstSet) addLabel(label string, line uint) {
+func (i *InstSet) addLabel(label string, pos token.Position) {
 	inst := &Instruction{
 		Instr: opcode.Label,
 		Label: label,
-		Line:  line,
+		Pos:   pos,
 	}
 
 	if i.Head == nil {
@@ -98,13 +142,13 @@ func (i *InstSet) addLabel(label string, line uint) {
 	}
 }
 
-func (i *InstSet) addLabeledArgs(code opcode.Opcode, line uint, argLabels ...string) {
+func (i *InstSet) addLabeledArgs(code opcode.Opcode, pos token.Position, argLabels ...string) {
 	checkArgLength(code, len(argLabels))
 	inst := &Instruction{
 		Instr:     code,
-		Args:      make([]uint16, len(argLabels)),
+		Args:      make([]uint32, len(argLabels)),
 		ArgLabels: argLabels,
-		Line:      line,
+		Pos:       pos,
 	}
 
 	if i.Head == nil {
@@ -117,114 +161,153 @@ func (i *InstSet) addLabeledArgs(code opcode.Opcode, line uint, argLabels ...str
 }
 
 func (i *InstSet) merge(j *InstSet) {
+	if j.Head == nil {
+		return
+	}
+	if i.Head == nil {
+		i.Head = j.Head
+		i.Tail = j.Tail
+		return
+	}
 	i.Tail.Next = j.Head
 	i.Tail = j.Tail
 }
 
 type Optimization func(*InstSet, *codeBlockCompiler)
 
-var optimizations = []Optimization{}
+type optimizer struct {
+	level int
+	pass  Optimization
+}
+
+var optimizations = []optimizer{}
 
-func AddOptimizer(o Optimization) {
-	optimizations = append(optimizations, o)
+// AddOptimizer adds a pass that's run when OptimizationLevel is at least level.
+// Passes run in the order they're added.
+func AddOptimizer(level int, o Optimization) {
+	optimizations = append(optimizations, optimizer{level: level, pass: o})
 }
 
 func checkArgLength(code opcode.Opcode, argLen int) {
 	if (opcode.HasOneByteArg[code] || opcode.HasTwoByteArg[code]) && argLen != 1 {
-		panic(fmt.Sprintf("opcode %s requires 1 16-bit argument, given %d", code.String(), argLen))
+		panic(fmt.Sprintf("opcode %s requires 1 argument, given %d", code.String(), argLen))
 	} else if opcode.HasFourByteArg[code] && argLen != 2 {
-		panic(fmt.Sprintf("opcode %s requires 2 16-bit argument, given %d", code.String(), argLen))
+		panic(fmt.Sprintf("opcode %s requires 2 arguments, given %d", code.String(), argLen))
 	}
 }
 
-func (i *InstSet) Len() uint16 {
-	var size uint16
-	in := i.Head
-	for in != nil {
+func (i *InstSet) Len() int {
+	size := 0
+	for in := i.Head; in != nil; in = in.Next {
 		size += in.Size()
-		in = in.Next
 	}
 	return size
 }
 
+// Link sets the arguments that refer to labels to the offsets of the labels.
+// Offsets that don't fit in 16 bits need an EXTENDED_ARG prefix which moves
+// the code after it, so the offsets are recalculated until none change.
 func (i *InstSet) Link() {
-	labels := make(map[string]uint16)
-
-	var offset uint16
-
-	in := i.Head
-	for in != nil {
-		if in.Is(opcode.Label) {
-			labels[in.Label] = offset
-			in = in.Next
-			continue
+	for {
+		labels := make(map[string]uint32)
+		offset := 0
+		for in := i.Head; in != nil; in = in.Next {
+			if in.Is(opcode.Label) {
+				labels[in.Label] = uint32(offset)
+			}
+			offset += in.Size()
 		}
-		offset += in.Size()
-		in = in.Next
-	}
 
-	offset = 0
-	in = i.Head
-	for in != nil {
-		if in.ArgLabels != nil {
+		changed := false
+		for in := i.Head; in != nil; in = in.Next {
 			for arg, lbl := range in.ArgLabels {
-				if lbl != "" {
+				if lbl != "" && in.Args[arg] != labels[lbl] {
 					in.Args[arg] = labels[lbl]
+					changed = true
 				}
 			}
 		}
-		offset += in.Size()
-		in = in.Next
+		if !changed {
+			return
+		}
+	}
+}
+
+// assignCaches gives each attribute instruction its own inline cache slot and
+// returns the number of slots used.
+func (i *InstSet) assignCaches() int {
+	caches := 0
+	for in := i.Head; in != nil; in = in.Next {
+		switch in.Instr {
+		case opcode.LoadAttribute, opcode.StoreAttribute, opcode.LoadMethod:
+			in.Args[1] = uint32(caches)
+			caches++
+		}
 	}
+	return caches
 }
 
-func (i *InstSet) Assemble(ccb *codeBlockCompiler) ([]byte, []uint16) {
+func (i *InstSet) Assemble(ccb *codeBlockCompiler) ([]byte, []LineOffset) {
 	for _, o := range optimizations {
-		o(i, ccb)
+		if o.level <= OptimizationLevel {
+			o.pass(i, ccb)
+		}
 	}
 
+	ccb.caches = i.assignCaches()
 	i.Link()
 
 	size := i.Len()
+	if uint64(size) > math.MaxUint32 {
+		panic(fmt.Sprintf("%s: %s is too large to compile, %d bytes of bytecode", ccb.filename, ccb.name, size))
+	}
+
 	bytes := make([]byte, size)
-	offsetMap := make([]uint16, 0, 100)
-	var lastLine uint
-	var offset uint16
+	offsetMap := make([]LineOffset, 0, 100)
+	var lastPos token.Position
+	offset := 0
 
-	in := i.Head
-	for in != nil {
+	for in := i.Head; in != nil; in = in.Next {
 		if in.Is(opcode.Label) {
-			in = in.Next
 			continue
 		}
 
-		if in.Line != lastLine {
-			offsetMap = append(offsetMap, offset, uint16(in.Line))
-			lastLine = in.Line
+		if in.Pos != lastPos {
+			offsetMap = append(offsetMap, LineOffset{
+				Offset: uint32(offset),
+				Line:   uint32(in.Pos.Line),
+				Col:    uint32(in.Pos.Col),
+			})
+			lastPos = in.Pos
 		}
+
+		// The prefix holds the high 16 bits of each argument
+		if in.extended() {
+			bytes[offset] = opcode.ExtendedArg.ToByte()
+			for arg := range in.Args {
+				putUint16(bytes[offset+1+arg*2:], uint16(in.Args[arg]>>16))
+			}
+			offset += 5
+		}
+
 		bytes[offset] = in.Instr.ToByte()
 		offset++
 
 		switch {
 		case opcode.HasOneByteArg[in.Instr]:
+			if in.Args[0] > math.MaxUint8 {
+				panic(fmt.Sprintf("%s:%d: argument %d of %s is larger than %d", ccb.filename, in.Pos.Line, in.Args[0], in.Instr, math.MaxUint8))
+			}
 			bytes[offset] = byte(in.Args[0])
 			offset++
 		case opcode.HasTwoByteArg[in.Instr]:
-			arg := uint16ToBytes(in.Args[0])
-			bytes[offset] = arg[0]
-			bytes[offset+1] = arg[1]
+			putUint16(bytes[offset:], uint16(in.Args[0]))
 			offset += 2
 		case opcode.HasFourByteArg[in.Instr]:
-			arg := uint16ToBytes(in.Args[0])
-			bytes[offset] = arg[0]
-			bytes[offset+1] = arg[1]
-
-			arg = uint16ToBytes(in.Args[1])
-			bytes[offset+2] = arg[0]
-			bytes[offset+3] = arg[1]
+			putUint16(bytes[offset:], uint16(in.Args[0]))
+			putUint16(bytes[offset+2:], uint16(in.Args[1]))
 			offset += 4
 		}
-		in = in.Next
 	}
 
 	return bytes, offsetMap
@@ -247,24 +330,31 @@ func (c *Code) NextInstruction() *Instruction {
 	}
 
 	curr := opcode.Opcode(c.code[c.i])
+	var ext [2]uint32
+	if curr == opcode.ExtendedArg {
+		ext[0] = uint32(bytesToUint16(c.code[c.i+1], c.code[c.i+2])) << 16
+		ext[1] = uint32(bytesToUint16(c.code[c.i+3], c.code[c.i+4])) << 16
+		c.i += 5
+		curr = opcode.Opcode(c.code[c.i])
+	}
 
 	i := &Instruction{
 		Instr: curr,
-		Args:  make([]uint16, 0),
+		Args:  make([]uint32, 0),
 	}
 	c.i++
 
 	switch {
 	case opcode.HasOneByteArg[curr]:
-		i.Args = []uint16{uint16(c.code[c.i])}
+		i.Args = []uint32{uint32(c.code[c.i])}
 		c.i++
 	case opcode.HasTwoByteArg[curr]:
-		i.Args = []uint16{bytesToUint16(c.code[c.i], c.code[c.i+1])}
+		i.Args = []uint32{ext[0] | uint32(bytesToUint16(c.code[c.i], c.code[c.i+1]))}
 		c.i += 2
 	case opcode.HasFourByteArg[curr]:
-		i.Args = []uint16{
-			bytesToUint16(c.code[c.i], c.code[c.i+1]),
-			bytesToUint16(c.code[c.i+2], c.code[c.i+3]),
+		i.Args = []uint32{
+			ext[0] | uint32(bytesToUint16(c.code[c.i], c.code[c.i+1])),
+			ext[1] | uint32(bytesToUint16(c.code[c.i+2], c.code[c.i+3])),
 		}
 		c.i += 4
 	}
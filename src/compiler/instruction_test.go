@@ -0,0 +1,105 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/nitrogen-lang/nitrogen/src/token"
+	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
+)
+
+func assembleTestCode(code *InstSet) ([]byte, []LineOffset) {
+	level := OptimizationLevel
+	OptimizationLevel = 0
+	defer func() { OptimizationLevel = level }()
+
+	return code.Assemble(&codeBlockCompiler{filename: "test", name: "test"})
+}
+
+func decodeTestCode(bytecode []byte) map[int]*Instruction {
+	insts := make(map[int]*Instruction)
+	c := NewCode(bytecode)
+	for {
+		offset := int(c.i)
+		in := c.NextInstruction()
+		if in == nil {
+			return insts
+		}
+		insts[offset] = in
+	}
+}
+
+func TestExtendedArgs(t *testing.T) {
+	pos := token.Position{Line: 1, Col: 1}
+	code := NewInstSet()
+	code.addLabeledArgs(opcode.JumpAbsolute, pos, "end")
+	for i := 0; i < 20000; i++ {
+		code.addInst(opcode.LoadConst, pos, uint32(i))
+		code.addInst(opcode.Pop, pos)
+	}
+	code.addInst(opcode.LoadConst, pos, 70000)
+	code.addInst(opcode.LoadAttribute, pos, 65536, 0)
+	code.addLabel("end", pos)
+	code.addInst(opcode.Return, pos)
+
+	bytecode, _ := assembleTestCode(code)
+	insts := decodeTestCode(bytecode)
+
+	// The jump's prefix moves all the code after it
+	if bytecode[0] != opcode.ExtendedArg.ToByte() {
+		t.Fatalf("Jump doesn't have an EXTENDED_ARG prefix")
+	}
+	jump := insts[0]
+	if !jump.Is(opcode.JumpAbsolute) {
+		t.Fatalf("Wrong first instruction. Expected JUMP_ABSOLUTE, got %s", jump)
+	}
+	if end := insts[int(jump.Args[0])]; !end.Is(opcode.Return) {
+		t.Fatalf("Jump to %d doesn't land on RETURN", jump.Args[0])
+	}
+
+	load := insts[8+20000*4]
+	if !load.Is(opcode.LoadConst) || load.Args[0] != 70000 {
+		t.Errorf("Wrong wide LOAD_CONST. Expected argument 70000, got %s %v", load, load.Args)
+	}
+	attr := insts[8+20000*4+8]
+	if !attr.Is(opcode.LoadAttribute) || attr.Args[0] != 65536 || attr.Args[1] != 0 {
+		t.Errorf("Wrong wide LOAD_ATTRIBUTE. Expected arguments [65536 0], got %s %v", attr, attr.Args)
+	}
+	if len(bytecode) != code.Len() {
+		t.Errorf("Wrong code length. Expected %d, got %d", code.Len(), len(bytecode))
+	}
+}
+
+func TestByteArgOverflow(t *testing.T) {
+	code := NewInstSet()
+	code.addInst(opcode.BreakOuter, token.Position{Line: 3}, 256)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Argument larger than a byte was assembled")
+		}
+	}()
+	assembleTestCode(code)
+}
+
+func TestLineOffsets(t *testing.T) {
+	code := NewInstSet()
+	code.addInst(opcode.LoadConst, token.Position{Line: 1, Col: 5}, 0)
+	code.addInst(opcode.Pop, token.Position{Line: 1, Col: 5})
+	code.addInst(opcode.LoadConst, token.Position{Line: 1, Col: 9}, 70000)
+	code.addInst(opcode.Return, token.Position{Line: 70000, Col: 1})
+
+	_, lines := assembleTestCode(code)
+	expected := []LineOffset{
+		{Offset: 0, Line: 1, Col: 5},
+		{Offset: 4, Line: 1, Col: 9},
+		{Offset: 12, Line: 70000, Col: 1},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Wrong line table. Expected %v, got %v", expected, lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Wrong line table entry %d. Expected %v, got %v", i, expected[i], lines[i])
+		}
+	}
+}
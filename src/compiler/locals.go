@@ -0,0 +1,123 @@
+package compiler
+
+// define declares name as a local of this block and returns its slot. Every
+// block of a function has its own slots so a name declared in a nested block
+// doesn't replace the one of an enclosing block.
+func (ccb *codeBlockCompiler) define(name string) uint32 {
+	return ccb.declare(name, ccb.locals.indexOf(name), false)
+}
+
+// defineConst declares name as a constant local of this block.
+func (ccb *codeBlockCompiler) defineConst(name string) uint32 {
+	return ccb.declare(name, ccb.locals.indexOf(name), true)
+}
+
+// defineParam declares a parameter of a function. Parameters are always given
+// a new slot so they're in the same order as in the function definition.
+func (ccb *codeBlockCompiler) defineParam(name string, readonly bool) uint32 {
+	return ccb.declare(name, ccb.locals.add(name), readonly)
+}
+
+func (ccb *codeBlockCompiler) declare(name string, slot uint32, readonly bool) uint32 {
+	ccb.checkRedefinition(name, slot)
+
+	if ccb.scope == nil {
+		ccb.scope = make(map[string]uint32)
+	}
+	ccb.scope[name] = slot
+	if readonly {
+		if ccb.consts == nil {
+			ccb.consts = make(map[string]bool)
+		}
+		ccb.consts[name] = true
+	}
+	return slot
+}
+
+// checkRedefinition declares the local in the environment if defining it
+// throws when the code runs. That's when it's already defined in the same
+// block or it has the name of a constant of an enclosing scope. The constant
+// is also declared in the environment so the check finds it.
+func (ccb *codeBlockCompiler) checkRedefinition(name string, slot uint32) {
+	for b := ccb; b != nil; b = b.lexicalOuter() {
+		found, ok := b.scope[name]
+		if !ok {
+			continue
+		}
+		if b == ccb {
+			ccb.declareInEnv(slot)
+		} else if b.consts[name] {
+			ccb.declareInEnv(slot)
+			b.declareInEnv(found)
+		}
+		return
+	}
+}
+
+// lexicalOuter returns the block this block is nested in, including blocks
+// of enclosing functions.
+func (ccb *codeBlockCompiler) lexicalOuter() *codeBlockCompiler {
+	switch {
+	case ccb.outer != nil:
+		return ccb.outer
+	case ccb.enclosing != nil:
+		return ccb.enclosing
+	default:
+		return ccb.envOuter
+	}
+}
+
+// declareInEnv makes the local in slot also be declared in the environment
+// of its scope.
+func (ccb *codeBlockCompiler) declareInEnv(slot uint32) {
+	fn := ccb.function()
+	if fn.envSlots == nil {
+		fn.envSlots = make(map[uint32]bool)
+	}
+	fn.envSlots[slot] = true
+}
+
+// lookupName returns the name table index of a name that's looked up in the
+// environment when the code runs. Locals of this and enclosing functions with
+// the name are declared in the environment so the lookup finds them.
+func (ccb *codeBlockCompiler) lookupName(name string) uint32 {
+	for b := ccb; b != nil; b = b.lexicalOuter() {
+		fn := b.function()
+		if fn.envNames == nil {
+			fn.envNames = make(map[string]bool)
+		}
+		fn.envNames[name] = true
+
+		// isDefined() also finds the slots of the function calling it, but
+		// not the ones of enclosing functions
+		if name == "isDefined" && fn != ccb.function() {
+			fn.envAll = true
+		}
+		b = fn
+	}
+	return ccb.names.indexOf(name)
+}
+
+// envLocals returns which locals of a function are declared in the
+// environment. The others are only used through their slot. All locals of
+// module level code are globals and are in the environment.
+func (ccb *codeBlockCompiler) envLocals() []bool {
+	env := make([]bool, len(ccb.locals.table))
+	for slot, name := range ccb.locals.table {
+		env[slot] = ccb.enclosing == nil || ccb.envAll || ccb.envSlots[uint32(slot)] || ccb.envNames[name]
+	}
+	return env
+}
+
+// resolveLocal returns the slot of name if it's declared in this block or an
+// enclosing block of the same function. Names of blocks that already ended
+// and names that aren't declared yet aren't resolved, they're looked up by
+// name when the code runs.
+func (ccb *codeBlockCompiler) resolveLocal(name string) (uint32, bool) {
+	for b := ccb; b != nil; b = b.outer {
+		if slot, ok := b.scope[name]; ok {
+			return slot, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,85 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/nitrogen-lang/nitrogen/src/lexer"
+	"github.com/nitrogen-lang/nitrogen/src/parser"
+)
+
+func TestEnvLocals(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected map[string]bool
+	}{
+		{
+			src: `const f = fn(p) {
+	let a = 1
+	let b = 2
+	const g = fn() { a }
+	b
+}`,
+			expected: map[string]bool{"p": false, "a": true, "b": false, "g": false},
+		},
+		{
+			src: `const f = fn() {
+	let a = 1
+	const g = fn() { b }
+	let b = 2
+}`,
+			expected: map[string]bool{"a": false, "g": false, "b": true},
+		},
+		{
+			src: `const f = fn(p) {
+	let a = 1
+	isDefined("a")
+}`,
+			expected: map[string]bool{"p": false, "a": false},
+		},
+		{
+			src: `const f = fn(p) {
+	let a = 1
+	const g = fn() { isDefined("a") }
+}`,
+			expected: map[string]bool{"p": true, "a": true, "g": true},
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.NewString(tt.src), &parser.Settings{})
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("Parsing %q failed: %v", tt.src, p.Errors())
+		}
+
+		code := Compile(program, "test")
+		for slot, env := range code.EnvLocals {
+			if !env {
+				t.Errorf("Module local %s isn't in the environment", code.Locals[slot])
+			}
+		}
+
+		fn := firstFunction(code)
+		if fn == nil {
+			t.Fatalf("No function compiled from %q", tt.src)
+		}
+		for slot, name := range fn.Locals {
+			expected, ok := tt.expected[name]
+			if !ok {
+				continue
+			}
+			if fn.EnvLocals[slot] != expected {
+				t.Errorf("Local %s of %q in environment is %t, expected %t", name, tt.src, fn.EnvLocals[slot], expected)
+			}
+		}
+	}
+}
+
+func firstFunction(code *CodeBlock) *CodeBlock {
+	for _, c := range code.Constants {
+		if fn, ok := c.(*CodeBlock); ok {
+			return fn
+		}
+	}
+	return nil
+}
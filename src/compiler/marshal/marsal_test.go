@@ -147,3 +147,34 @@ func TestCodeBlockMarshal(t *testing.T) {
 		t.Fatal("Code objects are not the same")
 	}
 }
+
+func TestEnumMarshal(t *testing.T) {
+	enum := object.NewEnum("Shape")
+	enum.AddMember("Circle", []string{"radius"})
+	enum.AddMember("Rect", []string{"width", "height"})
+	enum.AddMember("Empty", nil)
+
+	bytes, err := Marshal(enum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newenum, rest, err := Unmarshal(bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Errorf("Unmarshal left %d bytes", len(rest))
+	}
+	// An unmarshaled enum is a new enum, only its members are the same
+	got, ok := newenum.(*object.Enum)
+	if !ok || got.Name != enum.Name || len(got.Members) != len(enum.Members) {
+		t.Fatalf("Enums are not the same. Expected %s, got %s", enum.Inspect(), newenum.Inspect())
+	}
+	for i, m := range got.Members {
+		expected := enum.Members[i]
+		if m.Enum != got || m.Name != expected.Name || m.Index != expected.Index || !reflect.DeepEqual(m.Fields, expected.Fields) {
+			t.Errorf("Member %d is not the same. Expected %#v, got %#v", i, expected, m)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sync/atomic"
 
 	"github.com/nitrogen-lang/nitrogen/src/compiler"
 	"github.com/nitrogen-lang/nitrogen/src/object"
@@ -71,6 +72,40 @@ func Marshal(o object.Object) ([]byte, error) {
 		copy(out[9:], buf.Bytes())
 		return out, nil
 
+	case *object.Enum:
+		buf := new(bytes.Buffer)
+		tmpStr := object.MakeStringObj(o.Name)
+		res, _ := Marshal(tmpStr)
+		buf.Write(res)
+
+		buf.Write(encodeUint16(uint16(len(o.Members))))
+
+		for _, member := range o.Members {
+			tmpStr.Value = []rune(member.Name) // Reuse String object
+			res, _ = Marshal(tmpStr)
+			buf.Write(res)
+
+			if member.Fields == nil {
+				buf.WriteByte(0)
+				continue
+			}
+			buf.WriteByte(1)
+
+			buf.Write(encodeUint16(uint16(len(member.Fields))))
+			for _, field := range member.Fields {
+				tmpStr.Value = []rune(field) // Reuse String object
+				res, _ = Marshal(tmpStr)
+				buf.Write(res)
+			}
+		}
+
+		clen := buf.Len()
+		out := make([]byte, clen+9)
+		out[0] = 'u'
+		binary.BigEndian.PutUint64(out[1:9], uint64(clen))
+		copy(out[9:], buf.Bytes())
+		return out, nil
+
 	case *compiler.CodeBlock:
 		buf := new(bytes.Buffer)
 		tmpStr := object.MakeStringObj(o.Name)
@@ -92,11 +127,44 @@ func Marshal(o object.Object) ([]byte, error) {
 		} else {
 			buf.WriteByte(0)
 		}
-		buf.Write(encodeUint16(uint16(o.LocalCount)))
-		buf.Write(encodeUint16(uint16(o.MaxStackSize)))
-		buf.Write(encodeUint16(uint16(o.MaxBlockSize)))
 
-		buf.Write(encodeUint16(uint16(len(o.Constants))))
+		if o.Generator {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+
+		if o.Async {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+
+		if o.UsesArguments {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+
+		buf.Write(encodeUint16(uint16(len(o.Defaults))))
+		for _, d := range o.Defaults {
+			if d == nil { // Required parameter
+				buf.WriteByte('n')
+				continue
+			}
+			res, err := Marshal(d)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(res)
+		}
+
+		buf.Write(encodeUint32(uint32(o.LocalCount)))
+		buf.Write(encodeUint32(uint32(len(o.Caches))))
+		buf.Write(encodeUint32(uint32(o.MaxStackSize)))
+		buf.Write(encodeUint32(uint32(o.MaxBlockSize)))
+
+		buf.Write(encodeUint32(uint32(len(o.Constants))))
 		for _, c := range o.Constants {
 			res, err := Marshal(c)
 			if err != nil {
@@ -105,30 +173,48 @@ func Marshal(o object.Object) ([]byte, error) {
 			buf.Write(res)
 		}
 
-		buf.Write(encodeUint16(uint16(len(o.Locals))))
-		for _, l := range o.Locals {
+		buf.Write(encodeUint32(uint32(len(o.Locals))))
+		for i, l := range o.Locals {
 			tmpStr.Value = []rune(l)
 			res, _ := Marshal(tmpStr) // No error check, strings are almost guaranteed to work
 			buf.Write(res)
+
+			if o.EnvLocals[i] {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
 		}
 
-		buf.Write(encodeUint16(uint16(len(o.Names))))
+		buf.Write(encodeUint32(uint32(len(o.Names))))
 		for _, l := range o.Names {
 			tmpStr.Value = []rune(l)
 			res, _ := Marshal(tmpStr) // No error check, strings are almost guaranteed to work
 			buf.Write(res)
 		}
 
-		buf.Write(encodeUint16(uint16(len(o.LineOffsets) / 2)))
-		for i := 0; i < len(o.LineOffsets); i += 2 {
-			addr := o.LineOffsets[i]
-			line := o.LineOffsets[i+1]
+		buf.Write(encodeUint32(uint32(len(o.Upvalues))))
+		for _, up := range o.Upvalues {
+			tmpStr.Value = []rune(up.Name)
+			res, _ := Marshal(tmpStr)
+			buf.Write(res)
+
+			if up.Local {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+			buf.Write(encodeUint32(up.Index))
+		}
 
-			buf.Write(encodeUint16(uint16(addr)))
-			buf.Write(encodeUint16(uint16(line)))
+		buf.Write(encodeUint32(uint32(len(o.LineOffsets))))
+		for _, l := range o.LineOffsets {
+			buf.Write(encodeUint32(l.Offset))
+			buf.Write(encodeUint32(l.Line))
+			buf.Write(encodeUint32(l.Col))
 		}
 
-		buf.Write(encodeUint16(uint16(len(o.Code))))
+		buf.Write(encodeUint32(uint32(len(o.Code))))
 		buf.Write(o.Code)
 
 		clen := buf.Len()
@@ -190,6 +276,37 @@ func Unmarshal(in []byte) (object.Object, []byte, error) {
 		}
 
 		return iface, inslice, nil
+	case 'u':
+		inslice := in[9:]
+
+		name, inslice, _ := Unmarshal(inslice)
+		enum := object.NewEnum(string(name.(*object.String).Value))
+
+		numOfMembers := int(decodeUint16(inslice[:2]))
+		inslice = inslice[2:]
+
+		for i := 0; i < numOfMembers; i++ {
+			name, inslice, _ = Unmarshal(inslice)
+			hasFields := inslice[0] == 1
+			inslice = inslice[1:]
+
+			var fields []string
+			if hasFields {
+				numOfFields := int(decodeUint16(inslice[:2]))
+				inslice = inslice[2:]
+				fields = make([]string, numOfFields)
+
+				for f := 0; f < numOfFields; f++ {
+					var field object.Object
+					field, inslice, _ = Unmarshal(inslice)
+					fields[f] = string(field.(*object.String).Value)
+				}
+			}
+
+			enum.AddMember(string(name.(*object.String).Value), fields)
+		}
+
+		return enum, inslice, nil
 	case 'c':
 		inslice := in[9:] // Length is bytes [1-8]
 
@@ -204,15 +321,41 @@ func Unmarshal(in []byte) (object.Object, []byte, error) {
 		inslice = inslice[1:]
 		cb.ClassMethod = inslice[0] == 1
 		inslice = inslice[1:]
-		cb.LocalCount = int(decodeUint16(inslice[:2]))
-		inslice = inslice[2:]
-		cb.MaxStackSize = int(decodeUint16(inslice[:2]))
-		inslice = inslice[2:]
-		cb.MaxBlockSize = int(decodeUint16(inslice[:2]))
-		inslice = inslice[2:]
+		cb.Generator = inslice[0] == 1
+		inslice = inslice[1:]
+		cb.Async = inslice[0] == 1
+		inslice = inslice[1:]
+		cb.UsesArguments = inslice[0] == 1
+		inslice = inslice[1:]
 
-		constantsLen := int(decodeUint16(inslice[:2]))
+		defaultsLen := int(decodeUint16(inslice[:2]))
 		inslice = inslice[2:]
+		if defaultsLen > 0 {
+			cb.Defaults = make([]*compiler.CodeBlock, defaultsLen)
+		}
+		for i := 0; i < defaultsLen; i++ {
+			var def object.Object
+			var err error
+			def, inslice, err = Unmarshal(inslice)
+			if err != nil {
+				return nil, inslice, err
+			}
+			if def, ok := def.(*compiler.CodeBlock); ok {
+				cb.Defaults[i] = def
+			}
+		}
+
+		cb.LocalCount = int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
+		cb.Caches = make([]atomic.Value, decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
+		cb.MaxStackSize = int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
+		cb.MaxBlockSize = int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
+
+		constantsLen := int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
 		cb.Constants = make([]object.Object, constantsLen)
 		var err error
 		for i := range cb.Constants {
@@ -222,9 +365,10 @@ func Unmarshal(in []byte) (object.Object, []byte, error) {
 			}
 		}
 
-		localsLen := int(decodeUint16(inslice[:2]))
-		inslice = inslice[2:]
+		localsLen := int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
 		cb.Locals = make([]string, localsLen)
+		cb.EnvLocals = make([]bool, localsLen)
 		for i := range cb.Locals {
 			var tmpStr object.Object
 			tmpStr, inslice, err = Unmarshal(inslice)
@@ -232,10 +376,12 @@ func Unmarshal(in []byte) (object.Object, []byte, error) {
 				return nil, inslice, err
 			}
 			cb.Locals[i] = string(tmpStr.(*object.String).Value)
+			cb.EnvLocals[i] = inslice[0] == 1
+			inslice = inslice[1:]
 		}
 
-		namesLen := int(decodeUint16(inslice[:2]))
-		inslice = inslice[2:]
+		namesLen := int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
 		cb.Names = make([]string, namesLen)
 		for i := range cb.Names {
 			var tmpStr object.Object
@@ -246,18 +392,35 @@ func Unmarshal(in []byte) (object.Object, []byte, error) {
 			cb.Names[i] = string(tmpStr.(*object.String).Value)
 		}
 
-		lineOffsetPairs := int(decodeUint16(inslice[:2]))
-		inslice = inslice[2:]
-		cb.LineOffsets = make([]uint16, lineOffsetPairs*2)
-		for i := 0; i < len(cb.LineOffsets); i += 2 {
-			cb.LineOffsets[i] = decodeUint16(inslice[:2])
-			inslice = inslice[2:]
-			cb.LineOffsets[i+1] = decodeUint16(inslice[:2])
-			inslice = inslice[2:]
+		upvaluesLen := int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
+		if upvaluesLen > 0 {
+			cb.Upvalues = make([]compiler.Upvalue, upvaluesLen)
+		}
+		for i := range cb.Upvalues {
+			var tmpStr object.Object
+			tmpStr, inslice, err = Unmarshal(inslice)
+			if err != nil {
+				return nil, inslice, err
+			}
+			cb.Upvalues[i].Name = string(tmpStr.(*object.String).Value)
+			cb.Upvalues[i].Local = inslice[0] == 1
+			cb.Upvalues[i].Index = decodeUint32(inslice[1:5])
+			inslice = inslice[5:]
 		}
 
-		codeLen := int(decodeUint16(inslice[:2]))
-		inslice = inslice[2:]
+		lineOffsetsLen := int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
+		cb.LineOffsets = make([]compiler.LineOffset, lineOffsetsLen)
+		for i := range cb.LineOffsets {
+			cb.LineOffsets[i].Offset = decodeUint32(inslice[:4])
+			cb.LineOffsets[i].Line = decodeUint32(inslice[4:8])
+			cb.LineOffsets[i].Col = decodeUint32(inslice[8:12])
+			inslice = inslice[12:]
+		}
+
+		codeLen := int(decodeUint32(inslice[:4]))
+		inslice = inslice[4:]
 		cb.Code = make([]byte, codeLen)
 		copy(cb.Code, inslice)
 
@@ -276,6 +439,16 @@ func encodeUint64(in uint64) []byte {
 	return out
 }
 
+func decodeUint32(in []byte) uint32 {
+	return binary.BigEndian.Uint32(in)
+}
+
+func encodeUint32(in uint32) []byte {
+	out := make([]byte, 4)
+	binary.BigEndian.PutUint32(out, in)
+	return out
+}
+
 func decodeUint16(in []byte) uint16 {
 	return binary.BigEndian.Uint16(in)
 }
@@ -0,0 +1,95 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nitrogen-lang/nitrogen/src/ast"
+)
+
+// magicMethods are called by the virtual machine to implement operators and
+// builtins. They start with an underscore but aren't private.
+var magicMethods = map[string]bool{
+	"_iter": true, "_next": true,
+	"_add": true, "_sub": true, "_mul": true, "_div": true, "_mod": true, "_pow": true,
+	"_shl": true, "_shr": true, "_and": true, "_or": true, "_xor": true, "_andNot": true,
+	"_eq": true, "_lt": true,
+	"_getIndex": true, "_setIndex": true, "_len": true, "_str": true, "_hash": true,
+	"_contains": true, "_enter": true, "_exit": true,
+}
+
+// isPrivateName checks if a member is private by its name alone.
+func isPrivateName(name string) bool {
+	return strings.HasPrefix(name, "_") && !magicMethods[name]
+}
+
+// privateMembers returns the sorted names of all private members of a class.
+func privateMembers(class *ast.ClassLiteral) []string {
+	private := make(map[string]bool, len(class.Private))
+	for name := range class.Private {
+		private[name] = true
+	}
+
+	add := func(name string) {
+		if isPrivateName(name) {
+			private[name] = true
+		}
+	}
+	for _, f := range class.Fields {
+		add(f.Name.Value)
+	}
+	for _, f := range class.Statics {
+		add(f.Name.Value)
+	}
+	for name := range class.Methods {
+		add(name)
+	}
+	for name := range class.Getters {
+		add(name)
+	}
+	for name := range class.Setters {
+		add(name)
+	}
+
+	names := make([]string, 0, len(private))
+	for name := range private {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// insideClass checks if code is part of a class, either directly in a method
+// or in a function defined in one.
+func (ccb *codeBlockCompiler) insideClass() bool {
+	for fn := ccb.function(); ; fn = fn.enclosing.function() {
+		if fn.inClass {
+			return true
+		}
+		if fn.enclosing == nil {
+			return false
+		}
+	}
+}
+
+// checkMemberAccess rejects using an underscore prefixed member of this or of a
+// new instance outside of a class. Other objects, like hashes and modules, can
+// have such members, instances of classes are checked when the code runs.
+func (ccb *codeBlockCompiler) checkMemberAccess(attrib *ast.AttributeExpression) {
+	name := attrib.Index.String()
+	if !isPrivateName(name) || ccb.insideClass() {
+		return
+	}
+
+	switch left := attrib.Left.(type) {
+	case *ast.Identifier:
+		if left.Value != "this" {
+			return
+		}
+	case *ast.NewInstance:
+	default:
+		return
+	}
+	panic(fmt.Sprintf("private member %s used outside of a class", name))
+}
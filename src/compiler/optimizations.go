@@ -1,48 +1,432 @@
 package compiler
 
 import (
+	"math"
+
 	"github.com/nitrogen-lang/nitrogen/src/object"
 	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
 )
 
+// OptimizationLevel selects the optimization passes run on compiled code.
+// Level 0 disables optimizations, level 1 rewrites short sequences of
+// instructions, and level 2 also changes the control flow of the code.
+var OptimizationLevel = 2
+
 func init() {
-	AddOptimizer(optimizeLoadPop)
-	AddOptimizer(optimizeNegativeNums)
+	AddOptimizer(1, optimizeLoadPop)
+	AddOptimizer(1, foldConstants)
+	AddOptimizer(1, foldNotJumps)
+	AddOptimizer(2, threadJumps)
+	AddOptimizer(2, removeDeadCode)
 }
 
+// The passes keep the stack and block sizes calculated for every instruction
+// they don't remove, so calculateStackSize and calculateBlockSize stay correct.
+// Instructions are only removed or merged when their combined effect on the
+// stack is kept.
+
 // optimizeLoadPop removes the pattern LOAD_ followed by POP.
 // A Load Pop doesn't do anything since the value isn't being stored.
-// This function does not account for Labels which would require
-// calculating jump targets and blocks.
+// Only loads that don't pop any values are removed. A label between the
+// instructions keeps them since the POP is a jump target.
 func optimizeLoadPop(i *InstSet, ccb *codeBlockCompiler) {
-	var last *Instruction
+	var prev *Instruction
 	curr := i.Head
 	for curr != nil && curr.Next != nil {
-		if curr.IsLoad() && curr.Next.Is(opcode.Pop) && last != nil {
-			last.Next = curr.Next.Next
-			curr = curr.Next.Next
-			continue
+		switch curr.Instr {
+		case opcode.LoadConst, opcode.LoadFast, opcode.LoadGlobal, opcode.LoadUpvalue:
+			if curr.Next.Is(opcode.Pop) {
+				i.removeNext(prev)
+				i.removeNext(prev)
+				curr = i.next(prev)
+				continue
+			}
 		}
 
-		last = curr
+		prev = curr
 		curr = curr.Next
 	}
 }
 
-// optimizeNegativeNums replaces a LoadConst -> UnaryNeg sequence with
-// a single LoadConst of the negative number.
-func optimizeNegativeNums(i *InstSet, ccb *codeBlockCompiler) {
-	curr := i.Head
+// foldConstants replaces arithmetic and string concatenation of constants
+// with a single LoadConst of the result. Operations that would throw or
+// overflow are left to be done at runtime.
+func foldConstants(i *InstSet, ccb *codeBlockCompiler) {
+	for folded := true; folded; {
+		folded = false
 
-	for curr != nil && curr.Next != nil {
-		if curr.Is(opcode.LoadConst) && curr.Next.Is(opcode.UnaryNeg) {
-			numObj, ok := ccb.constants.table[curr.Args[0]].(*object.Integer)
-			if ok {
-				curr.Args[0] = ccb.constants.indexOf(object.MakeIntObj(-numObj.Value))
-				curr.Next = curr.Next.Next
+		for curr := i.Head; curr != nil; curr = curr.Next {
+			if !curr.Is(opcode.LoadConst) {
+				continue
+			}
+			left := ccb.constants.table[curr.Args[0]]
+
+			if curr.Next.Is(opcode.UnaryNeg) {
+				if res := foldNegation(left); res != nil {
+					curr.Args[0] = ccb.constants.indexOf(res)
+					i.removeNext(curr)
+					folded = true
+				}
+				continue
+			}
+
+			if !curr.Next.Is(opcode.LoadConst) || curr.Next.Next == nil {
+				continue
+			}
+			right := ccb.constants.table[curr.Next.Args[0]]
+
+			if res := foldBinary(curr.Next.Next.Instr, left, right); res != nil {
+				curr.Args[0] = ccb.constants.indexOf(res)
+				i.removeNext(curr)
+				i.removeNext(curr)
+				folded = true
 			}
 		}
+	}
+}
 
-		curr = curr.Next
+func foldNegation(val object.Object) object.Object {
+	switch val := val.(type) {
+	case *object.Integer:
+		if val.Value != math.MinInt64 {
+			return object.MakeIntObj(-val.Value)
+		}
+	case *object.Float:
+		return foldedFloat(-val.Value)
+	}
+	return nil
+}
+
+func foldBinary(op opcode.Opcode, left, right object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Integer:
+		switch right := right.(type) {
+		case *object.Integer:
+			return foldIntegers(op, left.Value, right.Value)
+		case *object.Float:
+			return foldFloats(op, float64(left.Value), right.Value)
+		}
+	case *object.Float:
+		switch right := right.(type) {
+		case *object.Integer:
+			return foldFloats(op, left.Value, float64(right.Value))
+		case *object.Float:
+			return foldFloats(op, left.Value, right.Value)
+		}
+	case *object.String:
+		if right, ok := right.(*object.String); ok && op == opcode.BinaryAdd {
+			val := make([]rune, 0, len(left.Value)+len(right.Value))
+			val = append(val, left.Value...)
+			return &object.String{Value: append(val, right.Value...)}
+		}
+	}
+	return nil
+}
+
+// foldIntegers calculates integer operations the same as the VM. Results the
+// VM would make a big integer or an exception from aren't folded.
+func foldIntegers(op opcode.Opcode, left, right int64) object.Object {
+	switch op {
+	case opcode.BinaryAdd:
+		res := left + right
+		if (left > 0 && right > 0 && res < 0) || (left < 0 && right < 0 && res >= 0) {
+			return nil
+		}
+		return object.MakeIntObj(res)
+	case opcode.BinarySub:
+		res := left - right
+		if (left >= 0 && right < 0 && res < 0) || (left < 0 && right > 0 && res >= 0) {
+			return nil
+		}
+		return object.MakeIntObj(res)
+	case opcode.BinaryMul:
+		res := left * right
+		if left != 0 && (res/left != right || (left == -1 && right == math.MinInt64)) {
+			return nil
+		}
+		return object.MakeIntObj(res)
+	case opcode.BinaryDivide:
+		if right == 0 || (left == math.MinInt64 && right == -1) {
+			return nil
+		}
+		return object.MakeIntObj(left / right)
+	case opcode.BinaryMod:
+		if right == 0 {
+			return nil
+		}
+		return object.MakeIntObj(left % right)
+	case opcode.BinaryShiftL:
+		if right < 0 || right >= 63 || (left<<uint64(right))>>uint64(right) != left {
+			return nil
+		}
+		return object.MakeIntObj(left << uint64(right))
+	case opcode.BinaryShiftR:
+		if right < 0 {
+			return nil
+		}
+		return object.MakeIntObj(left >> uint64(right))
+	case opcode.BinaryAnd:
+		return object.MakeIntObj(left & right)
+	case opcode.BinaryAndNot:
+		return object.MakeIntObj(left &^ right)
+	case opcode.BinaryOr:
+		return object.MakeIntObj(left | right)
+	case opcode.BinaryNot:
+		return object.MakeIntObj(left ^ right)
+	}
+	return nil
+}
+
+func foldFloats(op opcode.Opcode, left, right float64) object.Object {
+	switch op {
+	case opcode.BinaryAdd:
+		return foldedFloat(left + right)
+	case opcode.BinarySub:
+		return foldedFloat(left - right)
+	case opcode.BinaryMul:
+		return foldedFloat(left * right)
+	case opcode.BinaryDivide:
+		if right != 0 {
+			return foldedFloat(left / right)
+		}
+	}
+	return nil
+}
+
+// foldedFloat returns val as a constant. Negative zero and NaN aren't folded
+// since the constant table would mix them up with other values.
+func foldedFloat(val float64) object.Object {
+	if math.IsNaN(val) || (val == 0 && math.Signbit(val)) {
+		return nil
+	}
+	return object.MakeFloatObj(val)
+}
+
+// foldNotJumps replaces UnaryNot followed by a PopJumpIfFalse or PopJumpIfTrue
+// with the opposite jump. UnaryNot throws when its operand isn't a boolean, so
+// it's only removed when the instruction before it always pushes one.
+func foldNotJumps(i *InstSet, ccb *codeBlockCompiler) {
+	var prev *Instruction
+	for curr := i.Head; curr != nil; curr = curr.Next {
+		if curr.Is(opcode.UnaryNot) && curr.Next != nil && pushesBoolean(prev, ccb) {
+			switch curr.Next.Instr {
+			case opcode.PopJumpIfFalse:
+				curr.Next.Instr = opcode.PopJumpIfTrue
+				i.removeNext(prev)
+				continue
+			case opcode.PopJumpIfTrue:
+				curr.Next.Instr = opcode.PopJumpIfFalse
+				i.removeNext(prev)
+				continue
+			}
+		}
+		prev = curr
+	}
+}
+
+// pushesBoolean checks if in always leaves a boolean on the stack.
+func pushesBoolean(in *Instruction, ccb *codeBlockCompiler) bool {
+	if in == nil {
+		return false
+	}
+
+	switch in.Instr {
+	case opcode.Compare, opcode.UnaryNot, opcode.IsType:
+		return true
+	case opcode.LoadConst:
+		_, ok := ccb.constants.table[in.Args[0]].(*object.Boolean)
+		return ok
+	}
+	return false
+}
+
+// threadJumps points jumps that land on an unconditional jump, or on the same
+// conditional jump which will jump again, to the final target. Jumps to the
+// next instruction are removed.
+func threadJumps(i *InstSet, ccb *codeBlockCompiler) {
+	targets := i.labelTargets()
+
+	for curr := i.Head; curr != nil; curr = curr.Next {
+		if !isJump(curr) {
+			continue
+		}
+
+		// Jumps that only lead to each other stop when a target repeats
+		seen := map[string]bool{curr.ArgLabels[0]: true}
+		for {
+			target := targets[curr.ArgLabels[0]]
+			if target == nil || !(target.Is(opcode.JumpAbsolute) || keepsCondition(curr, target)) {
+				break
+			}
+			if seen[target.ArgLabels[0]] {
+				break
+			}
+			seen[target.ArgLabels[0]] = true
+			curr.ArgLabels[0] = target.ArgLabels[0]
+		}
+	}
+
+	var prev *Instruction
+	for curr := i.Head; curr != nil; curr = curr.Next {
+		if curr.Is(opcode.JumpAbsolute) && targets[curr.ArgLabels[0]] == i.nextInstruction(curr) {
+			i.removeNext(prev)
+			continue
+		}
+		prev = curr
+	}
+}
+
+func isJump(i *Instruction) bool {
+	switch i.Instr {
+	case opcode.JumpAbsolute, opcode.PopJumpIfTrue, opcode.PopJumpIfFalse, opcode.JumpIfTrueOrPop,
+		opcode.JumpIfFalseOrPop, opcode.JumpIfNil, opcode.JumpIfNotNilOrPop:
+		return true
+	}
+	return false
+}
+
+// keepsCondition checks if jump leaves the value it checked on the stack when
+// it jumps to target, and target checks it the same way.
+func keepsCondition(jump, target *Instruction) bool {
+	if jump.Instr != target.Instr {
+		return false
+	}
+	switch jump.Instr {
+	case opcode.JumpIfTrueOrPop, opcode.JumpIfFalseOrPop, opcode.JumpIfNil, opcode.JumpIfNotNilOrPop:
+		return true
+	}
+	return false
+}
+
+// removeDeadCode removes instructions that can't be reached from the start of
+// the code. A run of unreachable instructions is kept if removing it would
+// change the stack or block size calculated for the instructions after it.
+// Labels are always kept.
+func removeDeadCode(i *InstSet, ccb *codeBlockCompiler) {
+	reachable := i.reachable()
+	dead := make(map[*Instruction]bool)
+
+	var run []*Instruction
+	stack, blocks := 0, 0
+	endRun := func() {
+		if stack == 0 && blocks == 0 {
+			for _, in := range run {
+				dead[in] = true
+			}
+		}
+		run = run[:0]
+		stack, blocks = 0, 0
+	}
+
+	for curr := i.Head; curr != nil; curr = curr.Next {
+		switch {
+		case curr.Is(opcode.Label):
+		case reachable[curr]:
+			endRun()
+		default:
+			run = append(run, curr)
+			stack += stackEffect(curr)
+			blocks += blockEffect(curr)
+		}
+	}
+	endRun()
+
+	var prev *Instruction
+	for curr := i.Head; curr != nil; curr = curr.Next {
+		if dead[curr] {
+			i.removeNext(prev)
+			continue
+		}
+		prev = curr
+	}
+}
+
+// reachable finds the instructions control can reach from the start of the
+// code. Every label an instruction uses is followed, so exception handlers and
+// the ends of loops are reachable from the blocks that use them.
+func (i *InstSet) reachable() map[*Instruction]bool {
+	targets := i.labelTargets()
+	reachable := make(map[*Instruction]bool)
+
+	start := i.Head
+	if start.Is(opcode.Label) {
+		start = i.nextInstruction(start)
+	}
+
+	queue := []*Instruction{start}
+	for len(queue) > 0 {
+		curr := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if curr == nil || reachable[curr] {
+			continue
+		}
+		reachable[curr] = true
+
+		for _, lbl := range curr.ArgLabels {
+			if lbl != "" {
+				queue = append(queue, targets[lbl])
+			}
+		}
+		if !endsFlow(curr) {
+			queue = append(queue, i.nextInstruction(curr))
+		}
+	}
+	return reachable
+}
+
+// endsFlow checks if the instruction after i only runs when it's jumped to.
+func endsFlow(i *Instruction) bool {
+	switch i.Instr {
+	case opcode.Return, opcode.Throw, opcode.JumpAbsolute, opcode.Break, opcode.Continue,
+		opcode.NextIter, opcode.BreakOuter, opcode.ContinueOuter, opcode.NoMatch:
+		return true
+	}
+	return false
+}
+
+// labelTargets maps labels to the instruction that follows them, nil for
+// labels at the end of the code.
+func (i *InstSet) labelTargets() map[string]*Instruction {
+	targets := make(map[string]*Instruction)
+	for curr := i.Head; curr != nil; curr = curr.Next {
+		if curr.Is(opcode.Label) {
+			targets[curr.Label] = i.nextInstruction(curr)
+		}
+	}
+	return targets
+}
+
+// nextInstruction returns the first instruction after in that isn't a label.
+func (i *InstSet) nextInstruction(in *Instruction) *Instruction {
+	next := in.Next
+	for next != nil && next.Is(opcode.Label) {
+		next = next.Next
+	}
+	return next
+}
+
+// next returns the instruction after prev, or the first instruction when prev is nil.
+func (i *InstSet) next(prev *Instruction) *Instruction {
+	if prev == nil {
+		return i.Head
+	}
+	return prev.Next
+}
+
+// removeNext removes the instruction after prev, or the first instruction
+// when prev is nil.
+func (i *InstSet) removeNext(prev *Instruction) {
+	removed := i.next(prev)
+	if removed == nil {
+		return
+	}
+
+	if prev == nil {
+		i.Head = removed.Next
+	} else {
+		prev.Next = removed.Next
+	}
+	if i.Tail == removed {
+		i.Tail = prev
 	}
 }
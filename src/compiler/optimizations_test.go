@@ -0,0 +1,244 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nitrogen-lang/nitrogen/src/ast"
+	"github.com/nitrogen-lang/nitrogen/src/lexer"
+	"github.com/nitrogen-lang/nitrogen/src/object"
+	"github.com/nitrogen-lang/nitrogen/src/parser"
+	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
+)
+
+var optimizerTestCode = []string{
+	`const x = 2 * (3 + 4) - -1; const s = "a" + "b" + "c"`,
+	`const y = 1 / 0; const z = 9223372036854775807 + 1; const w = 1.5 * 2`,
+	`let a = 1; let o = {"b": 2}; a; o.b; 5; println(a)`,
+	`let a = 1; let b = true; if !(a == 1) { println(1) } else { println(2) }; while !(a > 2) { b = !b; a += 1 }; if !b { println(3) }`,
+	`let a = 1; if a == 1 { if a == 2 { println(1) } else { println(2) } } else { println(3) }`,
+	`let a = true; let b = false; let c = (a and b) and (b or a) and a; let d = a ?? b ?? c`,
+	`for i in range(0, 3) { if i == 1 { continue } break; println("dead") }`,
+	`for (i = 0; i < 3; i += 1) { try { throw i; println("dead") } catch e { println(e) } }`,
+	`let v = match 3 { 1 => "one", 3 => "three", _ => "other" }; println(v)`,
+	`return 1; println("dead"); for i in [1, 2] { println(i) }`,
+}
+
+func compileTestCode(t *testing.T, src string) *codeBlockCompiler {
+	p := parser.New(lexer.NewString(src), &parser.Settings{})
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("Parsing %q failed: %v", src, p.Errors())
+	}
+
+	ccb := &codeBlockCompiler{
+		constants: newConstantTable(),
+		locals:    newStringTable(),
+		names:     newStringTable(),
+		code:      NewInstSet(),
+		filename:  "test",
+		name:      "test",
+	}
+	compile(ccb, &ast.BlockStatement{Statements: program.Statements})
+	return ccb
+}
+
+type sizes struct{ stack, blocks int }
+
+// sizesAfter records the stack and block sizes calculated after each instruction.
+func sizesAfter(i *InstSet) map[*Instruction]sizes {
+	m := make(map[*Instruction]sizes)
+	var current sizes
+	for in := i.Head; in != nil; in = in.Next {
+		current.stack += stackEffect(in)
+		current.blocks += blockEffect(in)
+		m[in] = current
+	}
+	return m
+}
+
+func instNames(i *InstSet) []string {
+	var names []string
+	for in := i.Head; in != nil; in = in.Next {
+		if !in.Is(opcode.Label) {
+			names = append(names, in.String())
+		}
+	}
+	return names
+}
+
+func countInst(i *InstSet, code opcode.Opcode) int {
+	n := 0
+	for in := i.Head; in != nil; in = in.Next {
+		if in.Is(code) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestOptimizationsKeepStackSize(t *testing.T) {
+	passes := map[string]Optimization{
+		"optimizeLoadPop": optimizeLoadPop,
+		"foldConstants":   foldConstants,
+		"foldNotJumps":    foldNotJumps,
+		"threadJumps":     threadJumps,
+		"removeDeadCode":  removeDeadCode,
+	}
+
+	for name, pass := range passes {
+		for _, src := range optimizerTestCode {
+			ccb := compileTestCode(t, src)
+			before := sizesAfter(ccb.code)
+			stackSize := calculateStackSize(ccb.code)
+			blockSize := calculateBlockSize(ccb.code)
+
+			pass(ccb.code, ccb)
+
+			var last *Instruction
+			for in, after := range sizesAfter(ccb.code) {
+				// Labels left in removed code don't mark anything anymore
+				if before[in] != after && !in.Is(opcode.Label) {
+					t.Errorf("%s changed the sizes after %s in %q. Expected %v, got %v", name, in, src, before[in], after)
+				}
+			}
+			for in := ccb.code.Head; in != nil; in = in.Next {
+				last = in
+			}
+			if ccb.code.Tail != last {
+				t.Errorf("%s left the wrong tail in %q", name, src)
+			}
+
+			if size := calculateStackSize(ccb.code); size > stackSize {
+				t.Errorf("%s increased the stack size of %q from %d to %d", name, src, stackSize, size)
+			}
+			if size := calculateBlockSize(ccb.code); size > blockSize {
+				t.Errorf("%s increased the block size of %q from %d to %d", name, src, blockSize, size)
+			}
+		}
+	}
+}
+
+func TestFoldConstants(t *testing.T) {
+	ccb := compileTestCode(t, optimizerTestCode[0])
+	if size := calculateStackSize(ccb.code); size != 3 {
+		t.Fatalf("Wrong stack size before folding. Expected 3, got %d", size)
+	}
+
+	foldConstants(ccb.code, ccb)
+
+	expected := []string{"LOAD_CONST", "STORE_CONST", "LOAD_CONST", "STORE_CONST"}
+	if names := instNames(ccb.code); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Wrong instructions. Expected %v, got %v", expected, names)
+	}
+	if size := calculateStackSize(ccb.code); size != 1 {
+		t.Fatalf("Wrong stack size after folding. Expected 1, got %d", size)
+	}
+
+	x := ccb.constants.table[ccb.code.Head.Args[0]]
+	if x, ok := x.(*object.Integer); !ok || x.Value != 15 {
+		t.Errorf("Wrong folded integer. Expected 15, got %s", x.Inspect())
+	}
+	s := ccb.constants.table[ccb.code.Head.Next.Next.Args[0]]
+	if s, ok := s.(*object.String); !ok || s.String() != "abc" {
+		t.Errorf("Wrong folded string. Expected abc, got %s", s.Inspect())
+	}
+
+	// Division by zero and overflow are left for the VM, the float is folded
+	ccb = compileTestCode(t, optimizerTestCode[1])
+	foldConstants(ccb.code, ccb)
+	if n := countInst(ccb.code, opcode.BinaryDivide); n != 1 {
+		t.Errorf("Division by zero was folded")
+	}
+	if n := countInst(ccb.code, opcode.BinaryAdd); n != 1 {
+		t.Errorf("Overflowing addition was folded")
+	}
+	if n := countInst(ccb.code, opcode.BinaryMul); n != 0 {
+		t.Errorf("Float multiplication wasn't folded")
+	}
+	if size := calculateStackSize(ccb.code); size != 2 {
+		t.Fatalf("Wrong stack size after folding. Expected 2, got %d", size)
+	}
+}
+
+func TestOptimizeLoadPop(t *testing.T) {
+	ccb := compileTestCode(t, optimizerTestCode[2])
+	optimizeLoadPop(ccb.code, ccb)
+
+	// The attribute lookup pops the object so it's kept
+	if n := countInst(ccb.code, opcode.Pop); n != 1 {
+		t.Errorf("Wrong number of POPs. Expected 1, got %d", n)
+	}
+	if n := countInst(ccb.code, opcode.LoadAttribute); n != 1 {
+		t.Errorf("Attribute lookup was removed")
+	}
+}
+
+func TestFoldNotJumps(t *testing.T) {
+	ccb := compileTestCode(t, optimizerTestCode[3])
+	foldNotJumps(ccb.code, ccb)
+
+	// The not in the assignment isn't followed by a jump and b might not be a
+	// boolean
+	if n := countInst(ccb.code, opcode.UnaryNot); n != 2 {
+		t.Errorf("Wrong number of UNARY_NOTs. Expected 2, got %d", n)
+	}
+	if n := countInst(ccb.code, opcode.PopJumpIfTrue); n != 2 {
+		t.Errorf("Wrong number of POP_JUMP_IF_TRUEs. Expected 2, got %d", n)
+	}
+}
+
+func TestThreadJumps(t *testing.T) {
+	ccb := compileTestCode(t, optimizerTestCode[4])
+	if jumpsToJumps(ccb.code) == 0 {
+		t.Fatalf("Test code doesn't have a jump to a jump")
+	}
+
+	threadJumps(ccb.code, ccb)
+	if n := jumpsToJumps(ccb.code); n != 0 {
+		t.Errorf("%d jumps still jump to a jump", n)
+	}
+
+	ccb = compileTestCode(t, optimizerTestCode[5])
+	threadJumps(ccb.code, ccb)
+	targets := ccb.code.labelTargets()
+	for in := ccb.code.Head; in != nil; in = in.Next {
+		if isJump(in) && keepsCondition(in, targets[in.ArgLabels[0]]) {
+			t.Errorf("%s still jumps to the same check", in)
+		}
+	}
+}
+
+func TestRemoveDeadCode(t *testing.T) {
+	ccb := compileTestCode(t, optimizerTestCode[9])
+	removeDeadCode(ccb.code, ccb)
+
+	expected := []string{"LOAD_CONST", "RETURN"}
+	if names := instNames(ccb.code); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Wrong instructions. Expected %v, got %v", expected, names)
+	}
+
+	ccb = compileTestCode(t, optimizerTestCode[6])
+	removeDeadCode(ccb.code, ccb)
+	for in := ccb.code.Head; in != nil; in = in.Next {
+		if in.Is(opcode.LoadConst) && ccb.constants.table[in.Args[0]].Inspect() == "dead" {
+			t.Errorf("Code after break wasn't removed")
+		}
+	}
+	if n := countInst(ccb.code, opcode.StartLoop); n != 1 {
+		t.Errorf("Loop was removed")
+	}
+}
+
+func jumpsToJumps(i *InstSet) int {
+	n := 0
+	targets := i.labelTargets()
+	for in := i.Head; in != nil; in = in.Next {
+		if isJump(in) {
+			if target := targets[in.ArgLabels[0]]; target != nil && target.Is(opcode.JumpAbsolute) {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package compiler
+
+// Upvalue is a variable a function captures from an enclosing function. The
+// captured binding is shared so changes made on either side are seen by both.
+type Upvalue struct {
+	Name  string
+	Local bool   // Captured from a local of the enclosing function, otherwise from one of its upvalues
+	Index uint32 // Local slot in the enclosing function, or its upvalue index when Local is false
+}
+
+// function returns the compiler of the function body this block is part of.
+func (ccb *codeBlockCompiler) function() *codeBlockCompiler {
+	for ccb.outer != nil {
+		ccb = ccb.outer
+	}
+	return ccb
+}
+
+// resolveUpvalue returns the upvalue index of name if it's a local of an
+// enclosing function. Names defined in module level code are globals and are
+// never captured, neither are names that aren't defined yet when the function
+// is compiled. Those are looked up by name when the function runs.
+func (ccb *codeBlockCompiler) resolveUpvalue(name string) (uint32, bool) {
+	if _, ok := ccb.resolveLocal(name); ok {
+		return 0, false
+	}
+	return ccb.function().captureUpvalue(name)
+}
+
+// captureUpvalue adds name to the upvalues of a function body, capturing it
+// from the enclosing function's upvalues if it isn't one of its locals.
+func (ccb *codeBlockCompiler) captureUpvalue(name string) (uint32, bool) {
+	if ccb.enclosing == nil {
+		return 0, false
+	}
+
+	for i, up := range ccb.upvalues {
+		if up.Name == name {
+			return uint32(i), true
+		}
+	}
+
+	parent := ccb.enclosing.function()
+	if parent.enclosing == nil { // Module level
+		return 0, false
+	}
+
+	var up Upvalue
+	if slot, ok := ccb.enclosing.resolveLocal(name); ok {
+		up = Upvalue{Name: name, Local: true, Index: slot}
+		ccb.enclosing.declareInEnv(slot) // Looked up by name if it isn't defined yet when the function is made
+	} else {
+		index, ok := parent.captureUpvalue(name)
+		if !ok {
+			return 0, false
+		}
+		up = Upvalue{Name: name, Index: index}
+	}
+
+	ccb.upvalues = append(ccb.upvalues, up)
+	return uint32(len(ccb.upvalues) - 1), true
+}
+
+// capturesLocal checks if any function defined in a code block captures its
+// local name.
+func capturesLocal(constants *constantTable, name string) bool {
+	for _, c := range constants.table {
+		if cb, ok := c.(*CodeBlock); ok {
+			for _, up := range cb.Upvalues {
+				if up.Local && up.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
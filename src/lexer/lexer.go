@@ -19,6 +19,9 @@ type Lexer struct {
 	peekCh    rune // peek character
 	lastToken token.Token
 
+	// Brace depth of each open interpolated expression in a string
+	interpolations []int
+
 	fileList    []string
 	line, col   uint
 	currentFile string
@@ -110,6 +113,10 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.devourWhitespaceNotNewLine()
 
+	if (l.curCh == '\n' || l.curCh == 0) && len(l.interpolations) > 0 {
+		return l.unterminatedInterpolation()
+	}
+
 	switch l.curCh {
 	case '\n':
 		if l.needSemicolon() {
@@ -154,6 +161,19 @@ func (l *Lexer) NextToken() token.Token {
 				Filename: l.currentFile,
 			}
 			l.readRune()
+		} else if l.peekChar() == '*' {
+			tok = token.Token{
+				Type:     token.Power,
+				Literal:  "**",
+				Pos:      l.curPosition(),
+				Filename: l.currentFile,
+			}
+			l.readRune()
+			if l.peekChar() == '=' {
+				tok.Type = token.PowerAssign
+				tok.Literal = "**="
+				l.readRune()
+			}
 		} else {
 			tok = l.newToken(token.Asterisk, l.curCh)
 		}
@@ -212,6 +232,14 @@ func (l *Lexer) NextToken() token.Token {
 				Filename: l.currentFile,
 			}
 			l.readRune()
+		} else if l.peekChar() == '>' {
+			tok = token.Token{
+				Type:     token.Arrow,
+				Literal:  "=>",
+				Pos:      l.curPosition(),
+				Filename: l.currentFile,
+			}
+			l.readRune()
 		} else {
 			tok = l.newToken(token.Assign, l.curCh)
 		}
@@ -281,7 +309,49 @@ func (l *Lexer) NextToken() token.Token {
 	case ':':
 		tok = l.newToken(token.Colon, l.curCh)
 	case '.':
-		tok = l.newToken(token.Dot, l.curCh)
+		if l.peekChar() == '.' {
+			tok = token.Token{
+				Type:     token.Range,
+				Literal:  "..",
+				Pos:      l.curPosition(),
+				Filename: l.currentFile,
+			}
+			l.readRune()
+
+			switch l.peekChar() {
+			case '.':
+				tok.Type = token.Ellipsis
+				tok.Literal = "..."
+				l.readRune()
+			case '=':
+				tok.Type = token.RangeInclusive
+				tok.Literal = "..="
+				l.readRune()
+			}
+		} else {
+			tok = l.newToken(token.Dot, l.curCh)
+		}
+	case '?':
+		switch l.peekChar() {
+		case '.':
+			tok = token.Token{
+				Type:     token.OptionalDot,
+				Literal:  "?.",
+				Pos:      l.curPosition(),
+				Filename: l.currentFile,
+			}
+			l.readRune()
+		case '?':
+			tok = token.Token{
+				Type:     token.NullCoalesce,
+				Literal:  "??",
+				Pos:      l.curPosition(),
+				Filename: l.currentFile,
+			}
+			l.readRune()
+		default:
+			tok = l.newToken(token.Illegal, l.curCh)
+		}
 	case '^':
 		tok = l.newToken(token.Carrot, l.curCh)
 
@@ -291,8 +361,20 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = l.newToken(token.RParen, l.curCh)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = l.newToken(token.LBrace, l.curCh)
 	case '}':
+		if n := len(l.interpolations); n > 0 {
+			if l.interpolations[n-1] == 0 {
+				// End of an interpolated expression, continue the string
+				l.interpolations = l.interpolations[:n-1]
+				tok = l.readStringPart(true)
+				break
+			}
+			l.interpolations[n-1]--
+		}
 		tok = l.newToken(token.RBrace, l.curCh)
 	case '[':
 		tok = l.newToken(token.LSquare, l.curCh)
@@ -354,6 +436,7 @@ func (l *Lexer) needSemicolon() bool {
 		token.Integer,
 		token.Float,
 		token.String,
+		token.InterpEnd,
 		token.True,
 		token.False,
 		token.Nil,
@@ -375,11 +458,23 @@ func (l *Lexer) readIdentifier() string {
 }
 
 func (l *Lexer) readString() token.Token {
+	return l.readStringPart(false)
+}
+
+// readStringPart reads a double quoted string up to the closing quote or the
+// opening brace of an interpolated expression. cont is true when continuing
+// a string after an interpolated expression.
+func (l *Lexer) readStringPart(cont bool) token.Token {
 	var ident bytes.Buffer
 	pos := l.curPosition()
-	l.readRune() // Go past the starting double quote
+	l.readRune() // Go past the starting double quote or closing brace
 
 	for l.curCh != '"' {
+		if (l.curCh == '\n' || l.curCh == 0) && len(l.interpolations) > 0 {
+			// A string in an expression that isn't closed, most likely the
+			// quote ending the outer string was taken as its start
+			return l.unterminatedInterpolation()
+		}
 		if l.curCh == '\n' {
 			return token.Token{
 				Literal:  "Newline not allowed in string",
@@ -388,6 +483,28 @@ func (l *Lexer) readString() token.Token {
 				Filename: l.currentFile,
 			}
 		}
+		if l.curCh == 0 {
+			return token.Token{
+				Literal:  "Unterminated string",
+				Type:     token.Illegal,
+				Pos:      pos,
+				Filename: l.currentFile,
+			}
+		}
+
+		if l.curCh == '{' && startsInterpolation(l.peekChar()) {
+			l.interpolations = append(l.interpolations, 0)
+			tokType := token.InterpStart
+			if cont {
+				tokType = token.InterpMid
+			}
+			return token.Token{
+				Literal:  ident.String(),
+				Type:     tokType,
+				Pos:      pos,
+				Filename: l.currentFile,
+			}
+		}
 
 		if l.curCh == '\\' {
 			l.readRune()
@@ -412,6 +529,8 @@ func (l *Lexer) readString() token.Token {
 				ident.WriteRune('\\')
 			case '"': // double quote
 				ident.WriteRune('"')
+			case '{', '}': // literal braces
+				ident.WriteRune(l.curCh)
 			default:
 				ident.WriteByte('\\')
 				ident.WriteRune(l.curCh)
@@ -423,14 +542,30 @@ func (l *Lexer) readString() token.Token {
 		l.readRune()
 	}
 
+	tokType := token.String
+	if cont {
+		tokType = token.InterpEnd
+	}
 	return token.Token{
 		Literal:  ident.String(),
-		Type:     token.String,
+		Type:     tokType,
 		Pos:      pos,
 		Filename: l.currentFile,
 	}
 }
 
+// unterminatedInterpolation is returned when a line ends in an interpolated
+// expression. Strings can't span lines so neither can their expressions.
+func (l *Lexer) unterminatedInterpolation() token.Token {
+	l.interpolations = nil
+	return token.Token{
+		Literal:  `Unterminated expression in string, use \{ for a literal brace`,
+		Type:     token.Illegal,
+		Pos:      l.curPosition(),
+		Filename: l.currentFile,
+	}
+}
+
 func (l *Lexer) readRawString() token.Token {
 	var ident bytes.Buffer
 	pos := l.curPosition()
@@ -486,6 +621,9 @@ func (l *Lexer) readNumber() token.Token {
 	}
 
 	for isDigit(l.curCh) || isHexDigit(l.curCh) || l.curCh == '_' {
+		if l.curCh == '.' && l.peekChar() == '.' {
+			break // Start of a range
+		}
 		if l.curCh == '_' {
 			l.readRune()
 			continue
@@ -587,6 +725,17 @@ func (l *Lexer) newToken(tokenType token.TokenType, ch rune) token.Token {
 }
 
 // Identifiers must start with a letter
+// startsInterpolation checks if a brace followed by ch in a string starts an
+// interpolated expression. Any other brace is part of the string so strings
+// like JSON or format strings don't need to escape them.
+func startsInterpolation(ch rune) bool {
+	switch ch {
+	case '(', '[', '-', '!':
+		return true
+	}
+	return isLetter(ch) || ('0' <= ch && ch <= '9')
+}
+
 func isLetter(ch rune) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || unicode.IsLetter(ch)
 }
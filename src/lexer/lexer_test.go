@@ -228,3 +228,83 @@ for
 		}
 	}
 }
+
+func TestStringInterpolation(t *testing.T) {
+	const unterminated = `Unterminated expression in string, use \{ for a literal brace`
+
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{`"a{b}c"`, []token.Token{
+			{Type: token.InterpStart, Literal: "a"},
+			{Type: token.Identifier, Literal: "b"},
+			{Type: token.InterpEnd, Literal: "c"},
+		}},
+		{`"{a}{f("{b}")}"`, []token.Token{
+			{Type: token.InterpStart, Literal: ""},
+			{Type: token.Identifier, Literal: "a"},
+			{Type: token.InterpMid, Literal: ""},
+			{Type: token.Identifier, Literal: "f"},
+			{Type: token.LParen, Literal: "("},
+			{Type: token.InterpStart, Literal: ""},
+			{Type: token.Identifier, Literal: "b"},
+			{Type: token.InterpEnd, Literal: ""},
+			{Type: token.RParen, Literal: ")"},
+			{Type: token.InterpEnd, Literal: ""},
+		}},
+		{`"{(1)}{[2]}{-3}{!x}{4}"`, []token.Token{
+			{Type: token.InterpStart, Literal: ""},
+			{Type: token.LParen, Literal: "("},
+			{Type: token.Integer, Literal: "1"},
+			{Type: token.RParen, Literal: ")"},
+			{Type: token.InterpMid, Literal: ""},
+			{Type: token.LSquare, Literal: "["},
+			{Type: token.Integer, Literal: "2"},
+			{Type: token.RSquare, Literal: "]"},
+			{Type: token.InterpMid, Literal: ""},
+			{Type: token.Dash, Literal: "-"},
+			{Type: token.Integer, Literal: "3"},
+			{Type: token.InterpMid, Literal: ""},
+			{Type: token.Bang, Literal: "!"},
+			{Type: token.Identifier, Literal: "x"},
+			{Type: token.InterpMid, Literal: ""},
+			{Type: token.Integer, Literal: "4"},
+			{Type: token.InterpEnd, Literal: ""},
+		}},
+		// Braces that aren't followed by an expression are part of the string
+		{`"{}{ x }{	}{" "{.}\{a}"`, []token.Token{
+			{Type: token.String, Literal: "{}{ x }{\t}{"},
+			{Type: token.String, Literal: "{.}{a}"},
+		}},
+		{`"{" + x + "}"`, []token.Token{
+			{Type: token.String, Literal: "{"},
+			{Type: token.Plus, Literal: "+"},
+			{Type: token.Identifier, Literal: "x"},
+			{Type: token.Plus, Literal: "+"},
+			{Type: token.String, Literal: "}"},
+		}},
+		{`"{\"a\": [1, {\"b\": 2}]}"`, []token.Token{
+			{Type: token.String, Literal: `{"a": [1, {"b": 2}]}`},
+		}},
+		{"\"a{b\nc", []token.Token{
+			{Type: token.InterpStart, Literal: "a"},
+			{Type: token.Identifier, Literal: "b"},
+			{Type: token.Illegal, Literal: unterminated},
+			{Type: token.Semicolon, Literal: ";"},
+			{Type: token.Identifier, Literal: "c"},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := NewString(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("%q tokens[%d] wrong. Expected=%q, %q, got=%q, %q",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+				break
+			}
+		}
+	}
+}
@@ -14,10 +14,7 @@ func TestEval(input string) object.Object {
 	program := parser.New(lexer.NewString(input), nil).ParseProgram()
 	code := compiler.Compile(program, "__main")
 	env := object.NewEnvironment()
-	vmSettings := vm.NewSettings()
-	// Force the virtual machine to not panic on uncaught exceptions
-	vmSettings.ReturnExceptions = true
-	machine := vm.NewVM(vmSettings)
+	machine := vm.NewVM(vm.NewSettings())
 
 	ret, _ := machine.Execute(code, env)
 	return ret
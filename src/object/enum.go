@@ -0,0 +1,128 @@
+package object
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+var lastEnumID uint64
+
+// Enum is a type with a fixed set of named members.
+type Enum struct {
+	Name    string
+	Members []*EnumMember // In declaration order
+
+	id uint64 // Tells apart enums with the same name in map keys
+}
+
+// NewEnum creates an enum without any members.
+func NewEnum(name string) *Enum {
+	return &Enum{Name: name, id: atomic.AddUint64(&lastEnumID, 1)}
+}
+
+// AddMember adds a member to the end of the enum. A member with fields carries
+// associated values and is called with them to create a value.
+func (e *Enum) AddMember(name string, fields []string) *EnumMember {
+	m := &EnumMember{
+		Enum:   e,
+		Name:   name,
+		Index:  len(e.Members),
+		Fields: fields,
+	}
+	e.Members = append(e.Members, m)
+	return m
+}
+
+// Member returns the member called name or nil if the enum doesn't have one.
+func (e *Enum) Member(name string) *EnumMember {
+	for _, m := range e.Members {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func (e *Enum) Inspect() string  { return "enum " + e.Name }
+func (e *Enum) Type() ObjectType { return EnumObj }
+func (e *Enum) Dup() Object      { return e }
+
+// EnumMember is a member of an enum. Members with fields are created with
+// their associated values in Values.
+type EnumMember struct {
+	Enum   *Enum
+	Name   string
+	Index  int
+	Fields []string
+	Values []Object
+}
+
+// WithValues creates a value of the member carrying the associated values.
+func (m *EnumMember) WithValues(values []Object) *EnumMember {
+	return &EnumMember{
+		Enum:   m.Enum,
+		Name:   m.Name,
+		Index:  m.Index,
+		Fields: m.Fields,
+		Values: values,
+	}
+}
+
+// Is checks if both values are the same member of the same enum. Associated
+// values aren't compared.
+func (m *EnumMember) Is(other *EnumMember) bool {
+	return m.Enum == other.Enum && m.Index == other.Index
+}
+
+// Value returns the associated value named field.
+func (m *EnumMember) Value(field string) (Object, bool) {
+	for i, f := range m.Fields {
+		if f == field && i < len(m.Values) {
+			return m.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+func (m *EnumMember) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString(m.Enum.Name)
+	out.WriteByte('.')
+	out.WriteString(m.Name)
+
+	if m.Values != nil {
+		out.WriteByte('(')
+		for i, v := range m.Values {
+			out.WriteString(v.Inspect())
+			if i < len(m.Values)-1 {
+				out.WriteString(", ")
+			}
+		}
+		out.WriteByte(')')
+	}
+	return out.String()
+}
+func (m *EnumMember) Type() ObjectType { return EnumMemberObj }
+func (m *EnumMember) Dup() Object      { return m }
+
+// HashKey hashes the member's enum and name with the hash keys of its
+// associated values. Members aren't Hashable on their own because the values
+// may not be, the VM hashes them with its own hash keys.
+func (m *EnumMember) HashKey(values []HashKey) HashKey {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, m.Enum.id)
+	h.Write(buf)
+	binary.BigEndian.PutUint64(buf, uint64(m.Index))
+	h.Write(buf)
+
+	for _, k := range values {
+		binary.BigEndian.PutUint64(buf, uint64(k.Type))
+		h.Write(buf)
+		binary.BigEndian.PutUint64(buf, k.Value)
+		h.Write(buf)
+	}
+	return HashKey{Type: m.Type(), Value: h.Sum64()}
+}
@@ -15,15 +15,46 @@ func IsConstErr(e error) bool {
 	return e == constError
 }
 
-type eco struct {
+// Cell is a single binding in an environment. Closures keep the cells of the
+// variables they capture so they see any later changes to them.
+type Cell struct {
 	name     string
 	v        Object
 	readonly bool
-	n        *eco
+	n        *Cell
+	scope    *Environment // Scope of a cell that isn't part of an environment
 }
 
+// NewCell makes a binding that isn't part of an environment. It's visible in
+// scope and the scopes nested in it.
+func NewCell(name string, val Object, readonly bool, scope *Environment) *Cell {
+	return &Cell{name: name, v: val, readonly: readonly, scope: scope}
+}
+
+// Redefine reuses a cell made by NewCell for a new binding of the same name.
+func (c *Cell) Redefine(val Object, readonly bool, scope *Environment) {
+	c.v = val
+	c.readonly = readonly
+	c.scope = scope
+}
+
+// VisibleIn checks if a cell made by NewCell is visible in env.
+func (c *Cell) VisibleIn(env *Environment) bool {
+	for ; env != nil; env = env.parent {
+		if env == c.scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cell) Name() string   { return c.name }
+func (c *Cell) Get() Object    { return c.v }
+func (c *Cell) Set(val Object) { c.v = val }
+func (c *Cell) IsConst() bool  { return c.readonly }
+
 type Environment struct {
-	root   *eco
+	root   *Cell
 	parent *Environment
 }
 
@@ -45,10 +76,29 @@ func NewSizedEnclosedEnv(outer *Environment, size int) *Environment {
 	return env
 }
 
+// Clone makes a copy of the environment with the same parent. The bindings are
+// copied so changing them in one environment doesn't affect the other.
 func (e *Environment) Clone() *Environment {
-	return &Environment{
-		root:   e.root,
-		parent: e.parent,
+	env := &Environment{root: e.root, parent: e.parent}
+	env.CopyCells(nil)
+	return env
+}
+
+// CopyCells replaces the bindings of the environment with copies. Anything
+// holding the old cells, like a closure, keeps their values. copied, if not
+// nil, is called with each cell and its copy.
+func (e *Environment) CopyCells(copied func(orig, copy *Cell)) {
+	last := &e.root
+	for v := e.root; v != nil; v = v.n {
+		*last = &Cell{
+			name:     v.name,
+			v:        v.v,
+			readonly: v.readonly,
+		}
+		if copied != nil {
+			copied(v, *last)
+		}
+		last = &(*last).n
 	}
 }
 
@@ -87,7 +137,7 @@ func (e *Environment) Print(indent string) {
 	}
 }
 
-func (e *Environment) find(name string) *eco {
+func (e *Environment) find(name string) *Cell {
 	if e == nil {
 		return nil
 	}
@@ -102,6 +152,17 @@ func (e *Environment) find(name string) *eco {
 	return nil
 }
 
+// Cell returns the binding of name in the environment or its parents, nil if
+// it isn't defined.
+func (e *Environment) Cell(name string) *Cell {
+	for ; e != nil; e = e.parent {
+		if obj := e.find(name); obj != nil {
+			return obj
+		}
+	}
+	return nil
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj := e.find(name)
 	if obj != nil {
@@ -148,11 +209,7 @@ func (e *Environment) Create(name string, val Object) (Object, error) {
 		return nil, errAlreadyDefined
 	}
 
-	e.root = &eco{
-		name: name,
-		n:    e.root,
-		v:    val,
-	}
+	e.Declare(name, val, false)
 	return val, nil
 }
 
@@ -162,13 +219,21 @@ func (e *Environment) CreateConst(name string, val Object) (Object, error) {
 		return nil, errAlreadyDefined
 	}
 
-	e.root = &eco{
+	e.Declare(name, val, true)
+	return val, nil
+}
+
+// Declare adds a binding to the environment and returns its cell. Unlike
+// Create it doesn't check if the name is already defined, the new binding
+// hides any earlier one.
+func (e *Environment) Declare(name string, val Object, readonly bool) *Cell {
+	e.root = &Cell{
 		name:     name,
 		n:        e.root,
 		v:        val,
-		readonly: true,
+		readonly: readonly,
 	}
-	return val, nil
+	return e.root
 }
 
 func (e *Environment) Set(name string, val Object) (Object, error) {
@@ -201,7 +266,7 @@ func (e *Environment) SetForce(name string, val Object, readonly bool) {
 		return
 	}
 
-	e.root = &eco{
+	e.root = &Cell{
 		name:     name,
 		n:        e.root,
 		v:        val,
@@ -209,7 +274,7 @@ func (e *Environment) SetForce(name string, val Object, readonly bool) {
 	}
 }
 
-func (e *Environment) findParentNode(name string) (*eco, *eco) {
+func (e *Environment) findParentNode(name string) (*Cell, *Cell) {
 	if e == nil {
 		return nil, nil // No environment
 	}
@@ -242,6 +307,22 @@ func (e *Environment) UnsetLocal(name string) {
 	}
 }
 
+// UnsetCell removes the binding cell from the environment or its parents.
+func (e *Environment) UnsetCell(cell *Cell) {
+	for ; e != nil; e = e.parent {
+		if e.root == cell {
+			e.root = cell.n
+			return
+		}
+		for v := e.root; v != nil; v = v.n {
+			if v.n == cell {
+				v.n = cell.n
+				return
+			}
+		}
+	}
+}
+
 func (e *Environment) Unset(name string) {
 	p, el := e.findParentNode(name)
 	if p != nil {
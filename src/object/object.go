@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"io"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -40,6 +41,12 @@ const (
 	InstanceObj
 	BuiltinMethodObj
 	BoundMethodObj
+	BigIntObj
+	TraitObj
+	EnumObj
+	EnumMemberObj
+	SliceObj
+	RangeObj
 )
 
 var objectTypeNames = map[ObjectType]string{
@@ -62,6 +69,12 @@ var objectTypeNames = map[ObjectType]string{
 	InstanceObj:      "INSTANCE",
 	BuiltinMethodObj: "BUILTIN METHOD",
 	BoundMethodObj:   "BOUND METHOD",
+	BigIntObj:        "BIGINT",
+	TraitObj:         "TRAIT",
+	EnumObj:          "ENUM",
+	EnumMemberObj:    "ENUM_MEMBER",
+	SliceObj:         "SLICE",
+	RangeObj:         "RANGE",
 }
 
 const maxStaticInt = 255
@@ -113,6 +126,24 @@ func MakeIntObj(v int64) *Integer {
 	return &Integer{Value: v}
 }
 
+// BigInt is an arbitrary precision integer. Integer arithmetic that overflows
+// an int64 produces a BigInt, BigInt results that fit an int64 become an Integer again.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (i *BigInt) Inspect() string  { return i.Value.String() }
+func (i *BigInt) Type() ObjectType { return BigIntObj }
+func (i *BigInt) Dup() Object      { return &BigInt{Value: new(big.Int).Set(i.Value)} }
+
+// MakeBigIntObj returns v as an Integer if it fits in an int64, otherwise as a BigInt.
+func MakeBigIntObj(v *big.Int) Object {
+	if v.IsInt64() {
+		return MakeIntObj(v.Int64())
+	}
+	return &BigInt{Value: v}
+}
+
 type Float struct {
 	Value float64
 }
@@ -185,18 +216,72 @@ func (r *ReturnValue) Inspect() string  { return r.Value.Inspect() }
 func (r *ReturnValue) Type() ObjectType { return ReturnObj }
 func (r *ReturnValue) Dup() Object      { return &ReturnValue{Value: r.Value.Dup()} }
 
-// TODO: Expand with line/column numbers and stack trace
+// DefaultExceptionKind is the kind given to exceptions that weren't created from a class instance.
+const DefaultExceptionKind = "Exception"
+
+// StackFrame is a single call frame recorded when an exception is thrown.
+type StackFrame struct {
+	Filename string
+	Name     string
+	Line     uint
+	Col      uint
+}
+
+// Exception is a thrown error. Kind is the class name of the thrown instance, or
+// DefaultExceptionKind. If a value other than an exception was thrown, it's kept in Value.
 type Exception struct {
 	Catchable     bool
+	Kind          string
 	Message       string
+	Filename      string
+	Line          uint
+	Col           uint
+	Frames        []StackFrame
+	Cause         *Exception
+	Value         Object
 	Caught        bool
 	HasStackTrace bool
 }
 
 func (e *Exception) Inspect() string  { return e.Message }
 func (e *Exception) Type() ObjectType { return ExceptionObj }
-func (e *Exception) Dup() Object      { return &Exception{Message: e.Message} }
-func (e *Exception) String() string   { return e.Message }
+func (e *Exception) Dup() Object {
+	return &Exception{
+		Catchable:     e.Catchable,
+		Kind:          e.Kind,
+		Message:       e.Message,
+		Filename:      e.Filename,
+		Line:          e.Line,
+		Col:           e.Col,
+		Frames:        e.Frames,
+		Cause:         e.Cause,
+		Value:         e.Value,
+		HasStackTrace: e.HasStackTrace,
+	}
+}
+func (e *Exception) String() string { return e.Message }
+
+// StackTrace returns the exception message followed by the recorded stack frames
+// and the trace of any cause.
+func (e *Exception) StackTrace() string {
+	var out bytes.Buffer
+
+	if e.Kind != "" && e.Kind != DefaultExceptionKind {
+		out.WriteString(e.Kind)
+		out.WriteString(": ")
+	}
+	out.WriteString(e.Message)
+	out.WriteString("\nStack Trace:\n")
+	for _, frame := range e.Frames {
+		fmt.Fprintf(&out, "\t%s: %s:%d:%d\n", frame.Filename, frame.Name, frame.Line, frame.Col)
+	}
+
+	if e.Cause != nil {
+		out.WriteString("Caused by: ")
+		out.WriteString(e.Cause.StackTrace())
+	}
+	return out.String()
+}
 
 type Error struct {
 	Message string
@@ -337,6 +422,12 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (i *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(i.Value.String()))
+	return HashKey{Type: i.Type(), Value: h.Sum64()}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(string(s.Value)))
@@ -459,13 +550,17 @@ func (m *Module) Dup() Object      { return NullConst }
 
 func NewException(format string, a ...interface{}) *Exception {
 	return &Exception{
+		Kind:      DefaultExceptionKind,
 		Message:   fmt.Sprintf(format, a...),
 		Catchable: true,
 	}
 }
 
 func NewPanic(format string, a ...interface{}) *Exception {
-	return &Exception{Message: fmt.Sprintf(format, a...)}
+	return &Exception{
+		Kind:    DefaultExceptionKind,
+		Message: fmt.Sprintf(format, a...),
+	}
 }
 
 func NewError(format string, a ...interface{}) *Error {
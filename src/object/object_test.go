@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := MakeStringObj("Hello World")
@@ -21,3 +24,174 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestEnvironmentClone(t *testing.T) {
+	env := NewEnvironment()
+	env.Create("a", MakeIntObj(1))
+	env.CreateConst("b", MakeIntObj(2))
+
+	clone := env.Clone()
+	clone.SetLocal("a", MakeIntObj(3))
+
+	if val, _ := env.GetLocal("a"); val.(*Integer).Value != 1 {
+		t.Errorf("changing a clone changed the original. got=%d", val.(*Integer).Value)
+	}
+	if val, _ := clone.GetLocal("a"); val.(*Integer).Value != 3 {
+		t.Errorf("clone not changed. got=%d", val.(*Integer).Value)
+	}
+	if !clone.IsConstLocal("b") {
+		t.Errorf("clone lost constant b")
+	}
+}
+
+func TestEnvironmentCell(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Create("a", MakeIntObj(1))
+	inner := NewEnclosedEnv(outer)
+
+	cell := inner.Cell("a")
+	if cell == nil {
+		t.Fatal("cell for a not found")
+	}
+
+	outer.Set("a", MakeIntObj(2))
+	if cell.Get().(*Integer).Value != 2 {
+		t.Errorf("cell doesn't see changes to the binding. got=%d", cell.Get().(*Integer).Value)
+	}
+
+	if inner.Cell("b") != nil {
+		t.Errorf("expected nil cell for undefined name")
+	}
+}
+
+func TestEnvironmentDeclare(t *testing.T) {
+	outer := NewEnvironment()
+	a1 := outer.Declare("a", MakeIntObj(1), false)
+	a2 := outer.Declare("a", MakeIntObj(2), true)
+	inner := NewEnclosedEnv(outer)
+
+	if val, _ := inner.Get("a"); val.(*Integer).Value != 2 {
+		t.Errorf("latest declaration not found. got=%d", val.(*Integer).Value)
+	}
+	if !a2.IsConst() || a1.IsConst() {
+		t.Errorf("declared cells have the wrong readonly flags")
+	}
+
+	inner.UnsetCell(a2)
+	if val, _ := inner.Get("a"); val.(*Integer).Value != 1 {
+		t.Errorf("unset cell still found. got=%d", val.(*Integer).Value)
+	}
+
+	inner.UnsetCell(a1)
+	if _, ok := outer.Get("a"); ok {
+		t.Errorf("expected a to be undefined")
+	}
+}
+
+func TestSliceIndices(t *testing.T) {
+	tests := []struct {
+		start, end, step Object
+		expected         [4]int
+	}{
+		{MakeIntObj(1), MakeIntObj(3), NullConst, [4]int{1, 3, 1, 2}},
+		{NullConst, MakeIntObj(-1), NullConst, [4]int{0, 4, 1, 4}},
+		{MakeIntObj(-2), NullConst, NullConst, [4]int{3, 5, 1, 2}},
+		{NullConst, NullConst, MakeIntObj(2), [4]int{0, 5, 2, 3}},
+		{NullConst, NullConst, MakeIntObj(-1), [4]int{4, -1, -1, 5}},
+		{MakeIntObj(10), MakeIntObj(-10), NullConst, [4]int{5, 0, 1, 0}},
+		{MakeIntObj(3), MakeIntObj(1), NullConst, [4]int{3, 1, 1, 0}},
+	}
+
+	for _, tt := range tests {
+		slice := &Slice{Start: tt.start, End: tt.end, Step: tt.step}
+		start, end, step, count, err := slice.Indices(5)
+		if err != nil {
+			t.Fatalf("slice %s returned error %s", slice.Inspect(), err)
+		}
+
+		actual := [4]int{start, end, step, count}
+		if actual != tt.expected {
+			t.Errorf("slice %s expected=%v, got=%v", slice.Inspect(), tt.expected, actual)
+		}
+	}
+
+	slice := &Slice{Start: NullConst, End: NullConst, Step: MakeIntObj(0)}
+	if _, _, _, _, err := slice.Indices(5); err == nil {
+		t.Errorf("slice with zero step didn't return an error")
+	}
+}
+
+func TestRangeLen(t *testing.T) {
+	tests := []struct {
+		r        *Range
+		expected int64
+	}{
+		{&Range{Start: 0, End: 10, Step: 1}, 10},
+		{&Range{Start: 0, End: 10, Step: 1, Inclusive: true}, 11},
+		{&Range{Start: 0, End: 100, Step: 5}, 20},
+		{&Range{Start: 0, End: 100, Step: 5, Inclusive: true}, 21},
+		{&Range{Start: 0, End: 10, Step: 3}, 4},
+		{&Range{Start: 10, End: 0, Step: -2}, 5},
+		{&Range{Start: 10, End: 0, Step: 1}, 0},
+		{&Range{Start: 0, End: 0, Step: 1}, 0},
+		{&Range{Start: 0, End: 0, Step: 1, Inclusive: true}, 1},
+		{&Range{Start: 0, End: math.MaxInt64, Step: 1}, math.MaxInt64},
+		{&Range{Start: 1, End: math.MaxInt64, Step: 1, Inclusive: true}, math.MaxInt64},
+		{&Range{Start: math.MinInt64, End: math.MaxInt64, Step: 4}, 1 << 62},
+		{&Range{Start: math.MaxInt64, End: math.MinInt64, Step: math.MinInt64, Inclusive: true}, 2},
+		{&Range{Start: math.MinInt64, End: math.MaxInt64, Step: math.MaxInt64}, 3},
+	}
+
+	for _, tt := range tests {
+		actual, err := tt.r.Len()
+		if err != nil {
+			t.Errorf("range %s returned error %q", tt.r.Inspect(), err)
+		} else if actual != tt.expected {
+			t.Errorf("range %s expected=%d, got=%d", tt.r.Inspect(), tt.expected, actual)
+		}
+	}
+}
+
+func TestRangeLenTooLong(t *testing.T) {
+	tests := []*Range{
+		{Start: 0, End: math.MaxInt64, Step: 1, Inclusive: true},
+		{Start: -math.MaxInt64, End: math.MaxInt64, Step: 1},
+		{Start: math.MinInt64, End: math.MaxInt64, Step: 1, Inclusive: true},
+		{Start: math.MaxInt64, End: math.MinInt64, Step: -1},
+		{Start: -1, End: math.MaxInt64, Step: 1},
+		{Start: math.MinInt64, End: math.MaxInt64, Step: 2, Inclusive: true},
+	}
+
+	for _, r := range tests {
+		if _, err := r.Len(); err == nil {
+			t.Errorf("range %s didn't return an error", r.Inspect())
+		}
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	tests := []struct {
+		r        *Range
+		n        int64
+		expected bool
+	}{
+		{&Range{Start: 0, End: 10, Step: 1}, 9, true},
+		{&Range{Start: 0, End: 10, Step: 1}, 10, false},
+		{&Range{Start: 0, End: 10, Step: 1, Inclusive: true}, 10, true},
+		{&Range{Start: 0, End: 10, Step: 3}, 6, true},
+		{&Range{Start: 0, End: 10, Step: 3}, 7, false},
+		{&Range{Start: 10, End: 0, Step: -2}, 4, true},
+		{&Range{Start: 10, End: 0, Step: -2}, 0, false},
+		{&Range{Start: 0, End: math.MaxInt64, Step: 1, Inclusive: true}, math.MaxInt64, true},
+		{&Range{Start: 1, End: math.MaxInt64, Step: 1}, math.MinInt64, false},
+		{&Range{Start: math.MinInt64, End: math.MaxInt64, Step: 2}, math.MaxInt64 - 1, true},
+		{&Range{Start: math.MinInt64, End: math.MaxInt64, Step: 2}, math.MaxInt64 - 2, false},
+		{&Range{Start: math.MaxInt64, End: math.MinInt64, Step: math.MinInt64, Inclusive: true}, -1, true},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.r.Contains(tt.n); actual != tt.expected {
+			t.Errorf("range %s contains %d expected=%t, got=%t", tt.r.Inspect(), tt.n, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+)
+
+var errRangeTooLong = errors.New("range has more integers than fit in an integer")
+
+// Range is a lazy sequence of integers from Start towards End in increments
+// of Step. End is included only if Inclusive is set.
+type Range struct {
+	Start, End, Step int64
+	Inclusive        bool
+}
+
+func (r *Range) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString(strconv.FormatInt(r.Start, 10))
+	if r.Inclusive {
+		out.WriteString("..=")
+	} else {
+		out.WriteString("..")
+	}
+	out.WriteString(strconv.FormatInt(r.End, 10))
+	if r.Step != 1 {
+		out.WriteString(" by ")
+		out.WriteString(strconv.FormatInt(r.Step, 10))
+	}
+	return out.String()
+}
+func (r *Range) Type() ObjectType { return RangeObj }
+func (r *Range) Dup() Object      { return r }
+
+// Len returns the number of integers in the range. It fails if the number
+// is larger than the largest integer.
+func (r *Range) Len() (int64, error) {
+	// The distance between two int64s always fits in a uint64
+	var dist, step uint64
+	if r.Step > 0 {
+		if r.End < r.Start {
+			return 0, nil
+		}
+		dist, step = uint64(r.End)-uint64(r.Start), uint64(r.Step)
+	} else {
+		if r.End > r.Start {
+			return 0, nil
+		}
+		dist, step = uint64(r.Start)-uint64(r.End), -uint64(r.Step)
+	}
+
+	var n uint64
+	switch {
+	case r.Inclusive:
+		n = dist/step + 1
+	case dist == 0:
+		return 0, nil
+	default:
+		n = (dist-1)/step + 1
+	}
+	// n wraps to 0 when an inclusive range has every int64
+	if n == 0 || n > math.MaxInt64 {
+		return 0, errRangeTooLong
+	}
+	return int64(n), nil
+}
+
+// At returns the ith integer of the range. i must be less than Len.
+func (r *Range) At(i int64) int64 {
+	return r.Start + i*r.Step
+}
+
+// Contains checks if n is one of the integers in the range.
+func (r *Range) Contains(n int64) bool {
+	var offset, step uint64
+	if r.Step > 0 {
+		if n < r.Start || n > r.End || (n == r.End && !r.Inclusive) {
+			return false
+		}
+		offset, step = uint64(n)-uint64(r.Start), uint64(r.Step)
+	} else {
+		if n > r.Start || n < r.End || (n == r.End && !r.Inclusive) {
+			return false
+		}
+		offset, step = uint64(r.Start)-uint64(n), -uint64(r.Step)
+	}
+	return offset%step == 0
+}
+
+// Slice returns the range of integers selected by the slice.
+func (r *Range) Slice(s *Slice) (*Range, error) {
+	length, err := r.Len()
+	if err != nil {
+		return nil, err
+	}
+	start, _, step, count, err := s.Indices(int(length))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Range{
+		Start:     r.At(int64(start)),
+		Step:      r.Step * int64(step),
+		Inclusive: true,
+	}
+	if count == 0 {
+		res.End = res.Start
+		res.Inclusive = false
+	} else {
+		res.End = res.At(int64(count - 1))
+	}
+	return res, nil
+}
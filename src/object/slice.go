@@ -0,0 +1,101 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+)
+
+var errSliceStep = errors.New("slice step cannot be zero")
+
+// Slice is the index of a slice expression such as a[1:3] or a[::2]. Omitted
+// parts are nil.
+type Slice struct {
+	Start, End, Step Object
+}
+
+func (s *Slice) Inspect() string {
+	var out bytes.Buffer
+	if s.Start != NullConst {
+		out.WriteString(s.Start.Inspect())
+	}
+	out.WriteByte(':')
+	if s.End != NullConst {
+		out.WriteString(s.End.Inspect())
+	}
+	if s.Step != NullConst {
+		out.WriteByte(':')
+		out.WriteString(s.Step.Inspect())
+	}
+	return out.String()
+}
+func (s *Slice) Type() ObjectType { return SliceObj }
+func (s *Slice) Dup() Object      { return s }
+
+// Indices resolves the slice for a sequence of the given length. Negative
+// indices count from the end and out of range indices are clamped. It
+// returns the start and end positions, the step, and the number of
+// elements selected.
+func (s *Slice) Indices(length int) (start, end, step, count int, err error) {
+	step = 1
+	if s.Step != NullConst {
+		if step, err = sliceIndex(s.Step); err != nil {
+			return
+		}
+		if step == 0 {
+			err = errSliceStep
+			return
+		}
+	}
+
+	// A negative step walks from the end so the bounds shift down by one
+	lower, upper := 0, length
+	if step < 0 {
+		lower, upper = -1, length-1
+	}
+
+	if start, err = clampSliceIndex(s.Start, length, lower, upper, step > 0); err != nil {
+		return
+	}
+	if end, err = clampSliceIndex(s.End, length, lower, upper, step < 0); err != nil {
+		return
+	}
+
+	if step > 0 && start < end {
+		count = (end-start-1)/step + 1
+	} else if step < 0 && end < start {
+		count = (start-end-1)/(-step) + 1
+	}
+	return
+}
+
+func clampSliceIndex(obj Object, length, lower, upper int, omittedLower bool) (int, error) {
+	if obj == NullConst {
+		if omittedLower {
+			return lower, nil
+		}
+		return upper, nil
+	}
+
+	idx, err := sliceIndex(obj)
+	if err != nil {
+		return 0, err
+	}
+
+	if idx < 0 {
+		idx += length
+		if idx < lower {
+			idx = lower
+		}
+	} else if idx > upper {
+		idx = upper
+	}
+	return idx, nil
+}
+
+func sliceIndex(obj Object) (int, error) {
+	i, ok := obj.(*Integer)
+	if !ok {
+		return 0, errors.New("slice indices must be integers or nil, got " + obj.Type().String())
+	}
+	return int(i.Value), nil
+}
@@ -18,30 +18,48 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseDefStatement()
 	case token.Return:
 		return p.parseReturnStatement()
+	case token.Yield:
+		return p.parseYieldStatement()
 	case token.Function:
 		return p.parseFuncDefStatement()
+	case token.Async:
+		if p.peekTokenIs(token.Function) {
+			return p.parseFuncDefStatement()
+		}
+		return p.parseExpressionStatement()
 	case token.Class:
 		return p.parseClassDefStatement()
 	case token.Interface:
 		return p.parseInterfaceDefStatement()
+	case token.Trait:
+		return p.parseTraitDefStatement()
+	case token.Enum:
+		return p.parseEnumDefStatement()
 	case token.For:
 		return p.parseForLoop()
 	case token.While:
 		return p.parseWhileLoop()
 	case token.Loop:
 		return p.parseInfiniteLoop()
+	case token.Identifier:
+		if p.peekTokenIs(token.Colon) {
+			return p.parseLabeledLoop()
+		}
+		return p.parseExpressionStatement()
 	case token.Import:
 		return p.parseImport()
 	case token.Delete:
 		return p.parseDelete()
 	case token.Use:
 		return p.parseUseStatement()
+	case token.Defer:
+		return p.parseDeferStatement()
+	case token.With:
+		return p.parseWithStatement()
 	case token.Throw:
+		t := &ast.ThrowStatement{Token: p.curToken}
 		p.nextToken()
-		t := &ast.ThrowStatement{
-			Token:      p.curToken,
-			Expression: p.parseExpression(priLowest).(ast.Expression),
-		}
+		t.Expression = p.parseExpression(priLowest).(ast.Expression)
 		if p.peekTokenIs(token.Semicolon) {
 			p.nextToken()
 		}
@@ -49,6 +67,7 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.Continue:
 		stat := &ast.ContinueStatement{
 			Token: p.curToken,
+			Label: p.parseLoopLabel(),
 		}
 		if p.peekTokenIs(token.Semicolon) {
 			p.nextToken()
@@ -57,6 +76,7 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.Break:
 		stat := &ast.BreakStatement{
 			Token: p.curToken,
+			Label: p.parseLoopLabel(),
 		}
 		if p.peekTokenIs(token.Semicolon) {
 			p.nextToken()
@@ -76,6 +96,52 @@ func (p *Parser) parseStatement() ast.Statement {
 	return p.parseExpressionStatement()
 }
 
+func (p *Parser) parseDeferStatement() ast.Statement {
+	stmt := &ast.DeferStatement{Token: p.curToken}
+	p.nextToken()
+
+	exp, ok := p.parseExpression(priLowest).(ast.Expression)
+	if !ok {
+		p.addErrorWithPos("defer expected an expression")
+		return nil
+	}
+	stmt.Expression = exp
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseWithStatement() ast.Statement {
+	stmt := &ast.WithStatement{Token: p.curToken}
+	p.nextToken()
+
+	exp, ok := p.parseExpression(priLowest).(ast.Expression)
+	if !ok {
+		return nil
+	}
+	stmt.Value = exp
+
+	if p.peekTokenIs(token.As) {
+		p.nextToken()
+		if !p.expectPeek(token.Identifier) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.LBrace) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatements()
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseUseStatement() ast.Statement {
 	stmt := &ast.DefStatement{
 		Token: p.curToken,
@@ -183,6 +249,32 @@ func (p *Parser) parseDefStatement() ast.Statement {
 
 	stmt.Const = p.curTokenIs(token.Const)
 
+	if p.peekTokenIs(token.LSquare, token.LBrace) {
+		p.nextToken()
+		stmt.Pattern = p.parsePattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+
+		if !p.peekTokenIs(token.Assign) {
+			p.addErrorWithCPos(stmt.Token.Pos, "Destructuring declaration with no value")
+			return nil
+		}
+		p.nextToken()
+		p.nextToken()
+
+		thing := p.parseExpression(priLowest)
+		if thing == nil {
+			return nil
+		}
+		stmt.Value = thing.(ast.Expression)
+
+		if p.peekTokenIs(token.Semicolon) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
 	if !p.expectPeek(token.Identifier) {
 		return nil
 	}
@@ -226,6 +318,104 @@ func (p *Parser) parseDefStatement() ast.Statement {
 	return stmt
 }
 
+// parsePattern parses a destructuring pattern starting at the current '[' or '{' token.
+func (p *Parser) parsePattern() ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parsePattern")
+	}
+	switch p.curToken.Type {
+	case token.LSquare:
+		return p.parseArrayPattern()
+	case token.LBrace:
+		return p.parseMapPattern()
+	}
+
+	p.addErrorWithPos("expected a destructuring pattern, got %s", p.curToken.Type.String())
+	return nil
+}
+
+// parsePatternTarget parses what a pattern element is bound to, either an
+// identifier or a nested pattern.
+func (p *Parser) parsePatternTarget() ast.Expression {
+	if p.curTokenIs(token.Identifier) {
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+	return p.parsePattern()
+}
+
+func (p *Parser) parseArrayPattern() ast.Expression {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RSquare) {
+		p.nextToken()
+		if p.curTokenIs(token.Ellipsis) {
+			if !p.expectPeek(token.Identifier) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+			if !p.peekTokenIs(token.RSquare) {
+				p.addErrorWithCPos(pattern.Rest.Token.Pos, "Rest element %s must be the last element", pattern.Rest.Value)
+				return nil
+			}
+			break
+		}
+
+		target := p.parsePatternTarget()
+		if target == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, target)
+
+		if !p.peekTokenIs(token.RSquare) && !p.expectPeek(token.Comma) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RSquare) {
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseMapPattern() ast.Expression {
+	pattern := &ast.MapPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBrace) {
+		p.nextToken()
+		if !p.curTokenIs(token.Identifier, token.String) {
+			p.addErrorWithPos("expected a map key, got %s", p.curToken.Type.String())
+			return nil
+		}
+		entry := &ast.MapPatternEntry{Token: p.curToken, Key: p.curToken.Literal}
+
+		if p.peekTokenIs(token.Colon) {
+			p.nextToken()
+			p.nextToken()
+			entry.Value = p.parsePatternTarget()
+			if entry.Value == nil {
+				return nil
+			}
+		} else {
+			if !p.curTokenIs(token.Identifier) {
+				p.addErrorWithPos("String key %q must be bound to a name", entry.Key)
+				return nil
+			}
+			entry.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		}
+		pattern.Entries = append(pattern.Entries, entry)
+
+		if !p.peekTokenIs(token.RBrace) && !p.expectPeek(token.Comma) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBrace) {
+		return nil
+	}
+	return pattern
+}
+
 func (p *Parser) parseReturnStatement() ast.Statement {
 	if p.settings.Debug {
 		fmt.Println("parseReturnStatement")
@@ -256,6 +446,36 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 	return stmt
 }
 
+func (p *Parser) parseYieldStatement() ast.Statement {
+	if p.settings.Debug {
+		fmt.Println("parseYieldStatement")
+	}
+	stmt := &ast.YieldStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.Semicolon, token.RBrace) {
+		if p.peekTokenIs(token.Semicolon) {
+			p.nextToken()
+		}
+
+		stmt.Value = &ast.NullLiteral{Token: createKeywordToken("null")}
+		return stmt
+	}
+	p.nextToken()
+
+	exp := p.parseExpression(priLowest)
+	if exp == nil {
+		stmt.Value = &ast.NullLiteral{Token: createKeywordToken("null")}
+	} else {
+		stmt.Value = exp.(ast.Expression)
+	}
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseFuncDefStatement() ast.Statement {
 	if p.settings.Debug {
 		fmt.Println("parseFuncDefStatement")
@@ -357,6 +577,80 @@ func (p *Parser) parseInterfaceDefStatement() ast.Statement {
 	return stmt
 }
 
+func (p *Parser) parseTraitDefStatement() ast.Statement {
+	if p.settings.Debug {
+		fmt.Println("parseTraitDefStatement")
+	}
+	if !p.peekTokenIs(token.Identifier) {
+		return p.parseExpressionStatement()
+	}
+
+	traitToken := p.curToken
+	if !p.expectPeek(token.Identifier) {
+		return nil
+	}
+
+	stmt := &ast.DefStatement{Token: createKeywordToken("let")}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	p.insertToken(traitToken)
+	p.nextToken()
+
+	exp, ok := p.parseExpression(priLowest).(ast.Expression)
+	if !ok {
+		return nil
+	}
+	stmt.Value = exp
+
+	if trait, ok := stmt.Value.(*ast.TraitLiteral); ok {
+		trait.Name = stmt.Name.String()
+		p.traits[trait.Name] = trait
+	}
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseEnumDefStatement() ast.Statement {
+	if p.settings.Debug {
+		fmt.Println("parseEnumDefStatement")
+	}
+	if !p.peekTokenIs(token.Identifier) {
+		return p.parseExpressionStatement()
+	}
+
+	enumToken := p.curToken
+	if !p.expectPeek(token.Identifier) {
+		return nil
+	}
+
+	stmt := &ast.DefStatement{Token: createKeywordToken("const"), Const: true}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	p.insertToken(enumToken)
+	p.nextToken()
+
+	exp, ok := p.parseExpression(priLowest).(ast.Expression)
+	if !ok {
+		return nil
+	}
+	stmt.Value = exp
+
+	if enum, ok := stmt.Value.(*ast.EnumLiteral); ok {
+		enum.Name = stmt.Name.String()
+		p.enums[enum.Name] = enum
+	}
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseAssignmentStatement(left ast.Expression) ast.Node {
 	if p.settings.Debug {
 		fmt.Println("parseAssignmentStatement")
@@ -366,6 +660,11 @@ func (p *Parser) parseAssignmentStatement(left ast.Expression) ast.Node {
 		Left:  left,
 	}
 
+	if ast.IsOptionalChain(left) {
+		p.addErrorWithPos("Can't assign to an optional chain")
+		return nil
+	}
+
 	p.nextToken()
 
 	var ok bool
@@ -394,6 +693,11 @@ func (p *Parser) parseCompoundAssign(left ast.Expression) ast.Node {
 		Left:  left,
 	}
 
+	if ast.IsOptionalChain(left) {
+		p.addErrorWithPos("Can't assign to an optional chain")
+		return nil
+	}
+
 	p.nextToken()
 
 	right := p.parseExpression(priLowest).(ast.Expression)
@@ -409,6 +713,8 @@ func (p *Parser) parseCompoundAssign(left ast.Expression) ast.Node {
 		stmt.Value = makeInfix(token.Slash, left, right)
 	case token.ModAssign:
 		stmt.Value = makeInfix(token.Modulo, left, right)
+	case token.PowerAssign:
+		stmt.Value = makeInfix(token.Power, left, right)
 	}
 
 	if p.peekTokenIs(token.Semicolon) {
@@ -112,6 +112,42 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestYieldStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"yield 5;", 5},
+		{"yield foobar;", "foobar"},
+		{"yield;", nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
+		yieldStmt, ok := stmt.(*ast.YieldStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.YieldStatement. got=%T", stmt)
+		}
+		if yieldStmt.TokenLiteral() != "yield" {
+			t.Fatalf("yieldStmt.TokenLiteral not 'yield', got %q",
+				yieldStmt.TokenLiteral())
+		}
+		if !testLiteralExpression(t, yieldStmt.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
 func TestFunctionSugar(t *testing.T) {
 	input := `func hello(place) {
         return "Hello, " + place;
@@ -243,3 +279,52 @@ func TestImportWithAs(t *testing.T) {
 		t.Fatalf("import name is not correct. Expected \"http2\", got %s", imp.Name.String())
 	}
 }
+
+func TestDestructuringDefStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = c;", "let [a, b] = c;"},
+		{"const [a, ...rest] = c;", "const [a, ...rest] = c;"},
+		{`let {name, "port": p} = c;`, "let {name, port: p} = c;"},
+		{"let [a, {b, c: [d, e]}] = f;", "let [a, {b, c: [d, e]}] = f;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.DefStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.DefStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Pattern == nil {
+			t.Fatalf("stmt.Pattern is nil for %q", tt.input)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestInvalidDestructuring(t *testing.T) {
+	tests := []string{
+		"let [a, b];",
+		"let [...a, b] = c;",
+		`let {"name"} = c;`,
+		"let [a, 1] = c;",
+	}
+
+	for _, input := range tests {
+		l := lexer.NewString(input)
+		p := New(l, nil)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
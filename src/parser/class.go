@@ -17,6 +17,10 @@ func (p *Parser) parseClassLiteral() ast.Expression {
 		Token:   classToken,
 		Fields:  make([]*ast.DefStatement, 0),
 		Methods: make(map[string]*ast.FunctionLiteral),
+		Statics: make([]*ast.DefStatement, 0),
+		Getters: make(map[string]*ast.FunctionLiteral),
+		Setters: make(map[string]*ast.FunctionLiteral),
+		Private: make(map[string]bool),
 	}
 
 	if p.peekTokenIs(token.Carrot) {
@@ -27,36 +31,44 @@ func (p *Parser) parseClassLiteral() ast.Expression {
 		c.Parent = p.curToken.Literal
 	}
 
+	if p.peekTokenIs(token.Use) {
+		p.nextToken()
+		if !p.parseTraitUses(c) {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(token.LBrace) {
 		return nil
 	}
+	p.nextToken()
 
-	body := p.parseBlockStatements()
-
-	for _, statement := range body.Statements {
-		def, ok := statement.(*ast.DefStatement)
-		if !ok {
-			p.addErrorWithCPos(classToken.Pos, "Only function and variable statements are allowed in a class definition")
+	for !p.curTokenIs(token.RBrace) && !p.curTokenIs(token.EOF) {
+		if !p.parseClassMember(c) {
 			return nil
 		}
-
-		switch s := def.Value.(type) {
-		case *ast.FunctionLiteral:
-			c.Methods[s.Name] = s
-		default:
-			c.Fields = append(c.Fields, def)
-		}
+		p.nextToken()
 	}
 
 	errored := false
+	fields := make(map[string]bool, len(c.Fields))
 	for _, f := range c.Fields {
+		fields[f.Name.Value] = true
 		if fn, exists := c.Methods[f.Name.Value]; exists {
 			p.addErrorWithCPos(fn.Token.Pos, "Duplicate named function %s", fn.Name)
 			errored = true
 		}
 	}
+	for _, accessors := range []map[string]*ast.FunctionLiteral{c.Getters, c.Setters} {
+		for name, fn := range accessors {
+			if _, exists := c.Methods[name]; exists || fields[name] {
+				p.addErrorWithCPos(fn.Token.Pos, "Accessor %s has the same name as a field or method", name)
+				errored = true
+			}
+		}
+	}
 
-	if errored {
+	if errored || !p.checkTraitConflicts(c) {
 		return nil
 	}
 
@@ -67,6 +79,207 @@ func (p *Parser) parseClassLiteral() ast.Expression {
 	return c
 }
 
+// parseTraitUses parses the list of traits composed into a class. Each trait
+// can be followed by a list of method aliases: use Trait(method as alias).
+func (p *Parser) parseTraitUses(c *ast.ClassLiteral) bool {
+	for {
+		if !p.expectPeek(token.Identifier) {
+			return false
+		}
+		use := &ast.TraitUse{
+			Name:    p.curToken.Literal,
+			Aliases: make(map[string]string),
+		}
+
+		if p.peekTokenIs(token.LParen) {
+			p.nextToken()
+			for !p.peekTokenIs(token.RParen) {
+				if !p.expectPeek(token.Identifier) {
+					return false
+				}
+				method := p.curToken.Literal
+				if !p.expectPeek(token.As) || !p.expectPeek(token.Identifier) {
+					return false
+				}
+				use.Aliases[method] = p.curToken.Literal
+
+				if !p.peekTokenIs(token.RParen) && !p.expectPeek(token.Comma) {
+					return false
+				}
+			}
+			p.nextToken()
+		}
+
+		c.Traits = append(c.Traits, use)
+		if !p.peekTokenIs(token.Comma) {
+			return true
+		}
+		p.nextToken()
+	}
+}
+
+// checkTraitConflicts reports methods defined by more than one of the traits
+// used by a class. Methods of the class itself override its traits. Only traits
+// declared earlier in the same file can be checked, the rest are checked when
+// the class is built.
+func (p *Parser) checkTraitConflicts(c *ast.ClassLiteral) bool {
+	methods := make(map[string]string)
+	ok := true
+
+	for _, use := range c.Traits {
+		trait, known := p.traits[use.Name]
+		if !known {
+			continue
+		}
+
+		for method := range use.Aliases {
+			if _, exists := trait.Methods[method]; !exists {
+				p.addErrorWithCPos(c.Token.Pos, "Trait %s has no method %s to alias", use.Name, method)
+				ok = false
+			}
+		}
+
+		for name := range trait.Methods {
+			if alias, aliased := use.Aliases[name]; aliased {
+				name = alias
+			}
+			if other, exists := methods[name]; exists {
+				p.addErrorWithCPos(c.Token.Pos, "Method %s is defined by traits %s and %s, alias one of them", name, other, use.Name)
+				ok = false
+			}
+			methods[name] = use.Name
+		}
+	}
+	return ok
+}
+
+func (p *Parser) parseTraitLiteral() ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parseTraitLiteral")
+	}
+
+	t := &ast.TraitLiteral{
+		Token:   p.curToken,
+		Fields:  make([]*ast.DefStatement, 0),
+		Methods: make(map[string]*ast.FunctionLiteral),
+	}
+
+	if !p.expectPeek(token.LBrace) {
+		return nil
+	}
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBrace) && !p.curTokenIs(token.EOF) {
+		def, ok := p.parseStatement().(*ast.DefStatement)
+		if !ok {
+			p.addErrorWithCPos(t.Token.Pos, "Only function and variable statements are allowed in a trait definition")
+			return nil
+		}
+
+		if def.Pattern != nil {
+			p.addErrorWithCPos(def.Token.Pos, "Trait fields can't be destructured")
+			return nil
+		}
+
+		if fn, isFunc := def.Value.(*ast.FunctionLiteral); isFunc {
+			if _, exists := t.Methods[fn.Name]; exists {
+				p.addErrorWithCPos(fn.Token.Pos, "Duplicate named function %s", fn.Name)
+				return nil
+			}
+			t.Methods[fn.Name] = fn
+		} else {
+			t.Fields = append(t.Fields, def)
+		}
+		p.nextToken()
+	}
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+
+	return t
+}
+
+// parseClassMember parses a field, method, or accessor definition in a class
+// body. Members can be prefixed with static and private in any order.
+func (p *Parser) parseClassMember(c *ast.ClassLiteral) bool {
+	memberToken := p.curToken
+	static, private := false, false
+	for p.curTokenIs(token.Static) || p.curTokenIs(token.Private) {
+		if p.curTokenIs(token.Static) {
+			static = true
+		} else {
+			private = true
+		}
+		p.nextToken()
+	}
+
+	// get and set are only keywords when they start an accessor definition
+	accessor := ""
+	if p.curTokenIs(token.Identifier) && (p.curToken.Literal == "get" || p.curToken.Literal == "set") && p.peekTokenIs(token.Identifier) {
+		accessor = p.curToken.Literal
+		p.curToken = token.Token{
+			Type:     token.Function,
+			Literal:  "fn",
+			Pos:      p.curToken.Pos,
+			Filename: p.curToken.Filename,
+		}
+	}
+
+	def, ok := p.parseStatement().(*ast.DefStatement)
+	if !ok {
+		p.addErrorWithCPos(c.Token.Pos, "Only function and variable statements are allowed in a class definition")
+		return false
+	}
+
+	if def.Pattern != nil {
+		p.addErrorWithCPos(def.Token.Pos, "Class fields can't be destructured")
+		return false
+	}
+
+	name := def.Name.Value
+	if private {
+		c.Private[name] = true
+	}
+
+	fn, isFunc := def.Value.(*ast.FunctionLiteral)
+
+	switch {
+	case accessor != "":
+		if static {
+			p.addErrorWithCPos(memberToken.Pos, "Accessor %s can't be static", name)
+			return false
+		}
+
+		if accessor == "get" {
+			if len(fn.Parameters) != 0 || fn.Rest != nil {
+				p.addErrorWithCPos(fn.Token.Pos, "Getter %s can't have parameters", name)
+				return false
+			}
+			c.Getters[name] = fn
+		} else {
+			if len(fn.Parameters) != 1 || fn.Rest != nil {
+				p.addErrorWithCPos(fn.Token.Pos, "Setter %s must have one parameter", name)
+				return false
+			}
+			c.Setters[name] = fn
+		}
+	case static:
+		for _, s := range c.Statics {
+			if s.Name.Value == name {
+				p.addErrorWithCPos(def.Token.Pos, "Duplicate static member %s", name)
+				return false
+			}
+		}
+		c.Statics = append(c.Statics, def)
+	case isFunc:
+		c.Methods[fn.Name] = fn
+	default:
+		c.Fields = append(c.Fields, def)
+	}
+	return true
+}
+
 func (p *Parser) parseMakeExpression() ast.Expression {
 	if p.settings.Debug {
 		fmt.Println("parseMakeExpression")
@@ -86,6 +299,7 @@ func (p *Parser) parseMakeExpression() ast.Expression {
 
 	m.Class = call.Function
 	m.Arguments = call.Arguments
+	m.Keywords = call.Keywords
 
 	if p.peekTokenIs(token.Semicolon) {
 		p.nextToken()
@@ -123,7 +337,7 @@ func (p *Parser) parseInterfaceLiteral() ast.Expression {
 			return nil
 		}
 
-		params := p.parseFunctionParameters()
+		params, _, _, _ := p.parseFunctionParameters()
 		ifaceMeth.Params = make([]string, len(params))
 		for i, p := range params {
 			ifaceMeth.Params[i] = p.String()
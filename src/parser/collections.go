@@ -25,6 +25,20 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 	for !p.peekTokenIs(token.RBrace) {
 		p.nextToken()
+		if p.curTokenIs(token.Ellipsis) {
+			spread, ok := p.parseSpreadExpression().(*ast.SpreadExpression)
+			if !ok {
+				return nil
+			}
+			hash.Spreads = append(hash.Spreads, spread)
+
+			if !p.peekTokenIs(token.RBrace) && !p.expectPeek(token.Comma) {
+				p.addErrorWithPos("Invalid hash literal")
+				return nil
+			}
+			continue
+		}
+
 		key := p.parseExpression(priLowest)
 		keyExp, ok := key.(ast.Expression)
 
@@ -66,7 +80,18 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Node {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
 	p.nextToken()
-	exp.Index = p.parseExpression(priLowest).(ast.Expression)
+	if p.curTokenIs(token.Colon) {
+		exp.Index = p.parseSliceExpression(nil)
+	} else {
+		exp.Index = p.parseExpression(priLowest).(ast.Expression)
+		if p.peekTokenIs(token.Colon) {
+			p.nextToken()
+			exp.Index = p.parseSliceExpression(exp.Index)
+		}
+	}
+	if exp.Index == nil {
+		return nil
+	}
 
 	if !p.expectPeek(token.RSquare) {
 		return nil
@@ -74,6 +99,40 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Node {
 	return exp
 }
 
+// parseSliceExpression parses the end and step of a slice index. The current
+// token is the colon after the start.
+func (p *Parser) parseSliceExpression(start ast.Expression) ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parseSliceExpression")
+	}
+	slice := &ast.SliceExpression{Token: p.curToken, Start: start}
+
+	if !p.peekTokenIs(token.Colon) && !p.peekTokenIs(token.RSquare) {
+		p.nextToken()
+		end, ok := p.parseExpression(priLowest).(ast.Expression)
+		if !ok {
+			p.addErrorWithPos("Invalid slice end")
+			return nil
+		}
+		slice.End = end
+	}
+
+	if p.peekTokenIs(token.Colon) {
+		p.nextToken()
+		if !p.peekTokenIs(token.RSquare) {
+			p.nextToken()
+			step, ok := p.parseExpression(priLowest).(ast.Expression)
+			if !ok {
+				p.addErrorWithPos("Invalid slice step")
+				return nil
+			}
+			slice.Step = step
+		}
+	}
+
+	return slice
+}
+
 func (p *Parser) parseAttributeExpression(left ast.Expression) ast.Node {
 	if p.settings.Debug {
 		fmt.Println("parseAttributeExpression")
@@ -100,3 +159,70 @@ func (p *Parser) parseAttributeExpression(left ast.Expression) ast.Node {
 
 	return exp
 }
+
+// parseOptionalChain parses an attribute access, index, or call after a ?.
+// token. The expression evaluates to nil if left is nil.
+func (p *Parser) parseOptionalChain(left ast.Expression) ast.Node {
+	if p.settings.Debug {
+		fmt.Println("parseOptionalChain")
+	}
+
+	switch p.peekToken.Type {
+	case token.LSquare:
+		p.nextToken()
+		exp, ok := p.parseIndexExpression(left).(*ast.IndexExpression)
+		if !ok {
+			return nil
+		}
+		exp.Optional = true
+		return exp
+	case token.LParen:
+		p.nextToken()
+		exp, ok := p.parseCallExpression(left).(*ast.CallExpression)
+		if !ok {
+			return nil
+		}
+		exp.Optional = true
+		return exp
+	}
+
+	exp, ok := p.parseAttributeExpression(left).(*ast.AttributeExpression)
+	if !ok {
+		return nil
+	}
+	exp.Optional = true
+	return exp
+}
+
+// parseRangeExpression parses a range such as 0..10, 0..=10, or 0..10 by 2.
+func (p *Parser) parseRangeExpression(left ast.Expression) ast.Node {
+	if p.settings.Debug {
+		fmt.Println("parseRangeExpression")
+	}
+	exp := &ast.RangeExpression{
+		Token:     p.curToken,
+		Start:     left,
+		Inclusive: p.curTokenIs(token.RangeInclusive),
+	}
+
+	p.nextToken()
+	end, ok := p.parseExpression(priRange).(ast.Expression)
+	if !ok {
+		p.addErrorWithPos("Invalid range end")
+		return nil
+	}
+	exp.End = end
+
+	if p.peekTokenIs(token.By) {
+		p.nextToken()
+		p.nextToken()
+		step, ok := p.parseExpression(priRange).(ast.Expression)
+		if !ok {
+			p.addErrorWithPos("Invalid range step")
+			return nil
+		}
+		exp.Step = step
+	}
+
+	return exp
+}
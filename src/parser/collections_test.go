@@ -51,6 +51,60 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:3]", "(a[1:3])"},
+		{"a[:-1]", "(a[:(-1)])"},
+		{"a[2:]", "(a[2:])"},
+		{"a[:]", "(a[:])"},
+		{"a[::2]", "(a[::2])"},
+		{"a[1 + 1:n:-1]", "(a[(1 + 1):n:(-1)])"},
+		{"a[1:3] = b", "(a[1:3]) = b;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestParsingRangeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0..10", "(0..10)"},
+		{"0..=10", "(0..=10)"},
+		{"0..100 by 5", "(0..100 by 5)"},
+		{"n - 1..n * 2 by -1", "((n - 1)..(n * 2) by (-1))"},
+		{"x in 0..10", "(x in (0..10))"},
+		{"a < 0..10", "(a < (0..10))"},
+		{"a...b", "a...b"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -312,3 +366,77 @@ func TestInvalidHashLiteralMultiLine(t *testing.T) {
 		t.Fatalf("Incorrect error message. Got %q", p.Errors()[0])
 	}
 }
+
+func TestHashLiteralSpread(t *testing.T) {
+	input := `{...defaults, "one": 1}`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 1 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+	if len(hash.Spreads) != 1 {
+		t.Fatalf("hash.Spreads has wrong length. got=%d", len(hash.Spreads))
+	}
+	testLiteralExpression(t, hash.Spreads[0].Value, "defaults")
+}
+
+func TestOptionalChainParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a?.b", "(a?.b)"},
+		{"a?.b.c", "((a?.b).c)"},
+		{"a?.[1]", "(a?.[1])"},
+		{"a?.(1, 2)", "a?.(1, 2)"},
+		{"a.b?.()", "(a.b)?.()"},
+		{"a ?? b", "(a ?? b)"},
+		{"a?.b ?? c + d", "((a?.b) ?? (c + d))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestInvalidOptionalChain(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"a?.b = 1", "line 1, col 6 Can't assign to an optional chain"},
+		{"a?.b.c += 1", "line 1, col 8 Can't assign to an optional chain"},
+		{"a?.[1] = 1", "line 1, col 8 Can't assign to an optional chain"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Fatalf("No errors for %q", tt.input)
+		}
+
+		if p.Errors()[0] != tt.err {
+			t.Fatalf("Incorrect error message. Got %q", p.Errors()[0])
+		}
+	}
+}
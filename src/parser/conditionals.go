@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/nitrogen-lang/nitrogen/src/ast"
 	"github.com/nitrogen-lang/nitrogen/src/token"
@@ -53,6 +54,115 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseMatchExpression() ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parseMatchExpression")
+	}
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	expression.Value = p.parseGroupedExpressionE()
+	if expression.Value == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBrace) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBrace) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		for p.peekTokenIs(token.Comma, token.Semicolon) {
+			p.nextToken()
+		}
+	}
+	p.nextToken()
+
+	p.matches = append(p.matches, expression)
+	return expression
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	if p.settings.Debug {
+		fmt.Println("parseMatchArm")
+	}
+	arm := &ast.MatchArm{Token: p.curToken}
+
+	switch {
+	case p.curTokenIs(token.LSquare, token.LBrace):
+		arm.Pattern = p.parsePattern()
+		if arm.Pattern == nil {
+			return nil
+		}
+	case p.curTokenIs(token.Identifier) && p.curToken.Literal == "_":
+		// Wildcard, matches anything
+	default:
+		pattern, ok := p.parseExpression(priLowest).(ast.Expression)
+		if !ok {
+			return nil
+		}
+		if !isMatchPattern(pattern) {
+			p.addErrorWithCPos(arm.Token.Pos, "Invalid match pattern %s", pattern.String())
+			return nil
+		}
+		arm.Pattern = pattern
+	}
+
+	if p.peekTokenIs(token.If) {
+		p.nextToken()
+		arm.Guard = p.parseGroupedExpressionE()
+		if arm.Guard == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.Arrow) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.LBrace) {
+		p.nextToken()
+		arm.Body = p.parseBlockStatements()
+	} else {
+		arm.Body = p.parseSingleStmtBlock()
+	}
+	return arm
+}
+
+// isMatchPattern checks if an expression can be used as a match pattern.
+// Literals match by equality, identifiers and attributes name a type, class,
+// interface, enum or enum member. A call of an enum member binds the names
+// given as arguments to its associated values.
+func isMatchPattern(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean, *ast.NullLiteral:
+		return true
+	case *ast.Identifier, *ast.AttributeExpression:
+		return true
+	case *ast.CallExpression:
+		if _, ok := exp.Function.(*ast.AttributeExpression); !ok || len(exp.Keywords) > 0 {
+			return false
+		}
+		for _, arg := range exp.Arguments {
+			if _, ok := arg.(*ast.Identifier); !ok {
+				return false
+			}
+		}
+		return true
+	case *ast.PrefixExpression:
+		switch exp.Right.(type) {
+		case *ast.IntegerLiteral, *ast.FloatLiteral:
+			return exp.Operator == "-"
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseForLoop() ast.Statement {
 	if p.settings.Debug {
 		fmt.Println("parseForLoop")
@@ -67,6 +177,16 @@ func (p *Parser) parseForLoop() ast.Statement {
 		p.nextToken()
 	}
 
+	if p.peekTokenIs(token.LSquare, token.LBrace) {
+		p.nextToken()
+		loop := &ast.IterLoopStatement{Token: p.curToken}
+		loop.Pattern = p.parsePattern()
+		if loop.Pattern == nil {
+			return nil
+		}
+		return p.parseIterLoop(loop, expectClosingParen)
+	}
+
 	if !p.peekTokenIs(token.Identifier) {
 		p.peekError(token.Identifier)
 		return nil
@@ -91,42 +211,20 @@ func (p *Parser) parseForLoop() ast.Statement {
 		p.nextToken() // Skip comma
 		p.nextToken()
 
-		if !p.curTokenIs(token.Identifier) {
+		switch {
+		case p.curTokenIs(token.Identifier):
+			loop.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		case p.curTokenIs(token.LSquare, token.LBrace):
+			loop.Pattern = p.parsePattern()
+			if loop.Pattern == nil {
+				return nil
+			}
+		default:
 			p.addErrorWithPos("expected an ident, got %s", p.curToken.Type.String())
 			return nil
 		}
 
-		loop.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-
-		if !p.expectPeek(token.In) {
-			return nil
-		}
-		p.nextToken()
-
-		val, ok := p.parseExpression(priLowest).(ast.Expression)
-		if !ok {
-			return nil
-		}
-		loop.Iter = val
-
-		if expectClosingParen && !p.expectPeek(token.RParen) {
-			return nil
-		}
-
-		if !p.peekTokenIs(token.LBrace) {
-			p.peekError(token.LBrace)
-			return nil
-		}
-
-		p.nextToken()
-		loop.Body = p.parseBlockStatements()
-		p.nextToken()
-
-		if p.peekTokenIs(token.Semicolon) {
-			p.nextToken()
-		}
-
-		return loop
+		return p.parseIterLoop(loop, expectClosingParen)
 	} else if p.peekTokenIs(token.In) {
 		p.curToken = peekTok
 		loop := &ast.IterLoopStatement{Token: p.curToken}
@@ -137,36 +235,7 @@ func (p *Parser) parseForLoop() ast.Statement {
 		}
 
 		loop.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-
-		if !p.expectPeek(token.In) {
-			return nil
-		}
-		p.nextToken()
-
-		val, ok := p.parseExpression(priLowest).(ast.Expression)
-		if !ok {
-			return nil
-		}
-		loop.Iter = val
-
-		if expectClosingParen && !p.expectPeek(token.RParen) {
-			return nil
-		}
-
-		if !p.peekTokenIs(token.LBrace) {
-			p.peekError(token.LBrace)
-			return nil
-		}
-
-		p.nextToken()
-		loop.Body = p.parseBlockStatements()
-		p.nextToken()
-
-		if p.peekTokenIs(token.Semicolon) {
-			p.nextToken()
-		}
-
-		return loop
+		return p.parseIterLoop(loop, expectClosingParen)
 	} else {
 		p.insertToken(peekTok)
 
@@ -199,6 +268,41 @@ func (p *Parser) parseForLoop() ast.Statement {
 
 	p.nextToken()
 	loop.Body = p.parseBlockStatements()
+	loop.Else = p.parseLoopElse()
+	p.nextToken()
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+
+	return loop
+}
+
+// parseIterLoop parses the rest of a for..in loop after the loop variables.
+func (p *Parser) parseIterLoop(loop *ast.IterLoopStatement, expectClosingParen bool) ast.Statement {
+	if !p.expectPeek(token.In) {
+		return nil
+	}
+	p.nextToken()
+
+	val, ok := p.parseExpression(priLowest).(ast.Expression)
+	if !ok {
+		return nil
+	}
+	loop.Iter = val
+
+	if expectClosingParen && !p.expectPeek(token.RParen) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.LBrace) {
+		p.peekError(token.LBrace)
+		return nil
+	}
+
+	p.nextToken()
+	loop.Body = p.parseBlockStatements()
+	loop.Else = p.parseLoopElse()
 	p.nextToken()
 
 	if p.peekTokenIs(token.Semicolon) {
@@ -240,6 +344,7 @@ func (p *Parser) parseWhileLoop() ast.Statement {
 
 	p.nextToken()
 	loop.Body = p.parseBlockStatements()
+	loop.Else = p.parseLoopElse()
 	p.nextToken()
 
 	if p.peekTokenIs(token.Semicolon) {
@@ -268,6 +373,11 @@ func (p *Parser) parseInfiniteLoop() ast.Statement {
 
 	p.nextToken()
 	loop.Body = p.parseBlockStatements()
+	if p.peekTokenIs(token.Else) {
+		p.nextToken()
+		p.addErrorWithPos("loop can't have an else block, it only ends with a break")
+		return nil
+	}
 	p.nextToken()
 
 	if p.peekTokenIs(token.Semicolon) {
@@ -282,7 +392,7 @@ func (p *Parser) parseCompareExpression(left ast.Expression) ast.Node {
 		fmt.Println("parseCompareExpression")
 	}
 	c := p.curToken
-	p.nextToken() // Go over OR, AND
+	p.nextToken() // Go over OR, AND, ??
 
 	return &ast.CompareExpression{
 		Token: c,
@@ -299,31 +409,232 @@ func (p *Parser) parseTryCatch() ast.Expression {
 		return nil
 	}
 
-	try := p.parseBlockStatements()
+	try := &ast.TryCatchExpression{
+		Try: p.parseBlockStatements(),
+	}
+
+	for p.peekTokenIs(token.Catch) {
+		p.nextToken()
+		clause := p.parseCatchClause()
+		if clause == nil {
+			return nil
+		}
+		try.Catches = append(try.Catches, clause)
+	}
+
+	if p.peekTokenIs(token.Finally) {
+		p.nextToken()
+		if !p.expectPeek(token.LBrace) {
+			return nil
+		}
+		try.Finally = p.parseBlockStatements()
+	}
 
-	if !p.expectPeek(token.Catch) {
+	if len(try.Catches) == 0 && try.Finally == nil {
+		p.peekError(token.Catch)
 		return nil
 	}
 
-	var symbol *ast.Identifier
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+
+	return try
+}
+
+func (p *Parser) parseCatchClause() *ast.CatchClause {
+	if p.settings.Debug {
+		fmt.Println("parseCatchClause")
+	}
+	clause := &ast.CatchClause{Token: p.curToken}
+
 	if p.peekTokenIs(token.Identifier) {
 		p.nextToken()
-		symbol = p.parseIdentifier().(*ast.Identifier)
+		clause.Symbol = p.parseIdentifier().(*ast.Identifier)
+	}
+
+	if p.peekTokenIs(token.Carrot) {
+		p.nextToken()
+		p.nextToken()
+		class, ok := p.parseExpression(priSum).(ast.Expression)
+		if !ok {
+			p.addErrorWithPos("catch clause expected a class or interface")
+			return nil
+		}
+		clause.Class = class
 	}
 
 	if !p.expectPeek(token.LBrace) {
 		return nil
 	}
 
-	catch := p.parseBlockStatements()
+	clause.Body = p.parseBlockStatements()
+	return clause
+}
 
-	if p.peekTokenIs(token.Semicolon) {
-		p.nextToken()
+// checkEnumMatches reports match expressions over the members of an enum that
+// don't handle all of the members. Only enums declared in the same file can be
+// checked.
+func (p *Parser) checkEnumMatches() {
+	for _, match := range p.matches {
+		enum, handled := p.matchedEnum(match)
+		if enum == nil {
+			continue
+		}
+
+		var missing []string
+		for _, member := range enum.Members {
+			if !handled[member.Name] {
+				missing = append(missing, member.Name)
+			}
+		}
+		if len(missing) > 0 {
+			p.addErrorWithCPos(match.Token.Pos, "Match on enum %s doesn't handle %s", enum.Name, strings.Join(missing, ", "))
+		}
 	}
+}
+
+// matchedEnum returns the enum whose members are the patterns of every arm in
+// match, and the members handled by arms without a guard. The returned enum is
+// nil if any other pattern is used.
+func (p *Parser) matchedEnum(match *ast.MatchExpression) (*ast.EnumLiteral, map[string]bool) {
+	var enum *ast.EnumLiteral
+	handled := make(map[string]bool)
+
+	for _, arm := range match.Arms {
+		pattern := arm.Pattern
+		if call, ok := pattern.(*ast.CallExpression); ok {
+			pattern = call.Function
+		}
 
-	return &ast.TryCatchExpression{
-		Try:    try,
-		Catch:  catch,
-		Symbol: symbol,
+		attr, ok := pattern.(*ast.AttributeExpression)
+		if !ok {
+			return nil, nil
+		}
+		left, ok := attr.Left.(*ast.Identifier)
+		if !ok {
+			return nil, nil
+		}
+
+		e := p.enums[left.Value]
+		if e == nil || (enum != nil && e != enum) {
+			return nil, nil
+		}
+		enum = e
+
+		if arm.Guard == nil {
+			handled[attr.Index.String()] = true
+		}
+	}
+	return enum, handled
+}
+
+func (p *Parser) parseEnumLiteral() ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parseEnumLiteral")
+	}
+	e := &ast.EnumLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LBrace) {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	for {
+		for p.peekTokenIs(token.Comma, token.Semicolon) {
+			p.nextToken()
+		}
+		if p.peekTokenIs(token.RBrace) {
+			break
+		}
+
+		if !p.expectPeek(token.Identifier) {
+			return nil
+		}
+		member := &ast.EnumMemberDef{Name: p.curToken.Literal}
+		if names[member.Name] {
+			p.addErrorWithPos("Duplicate enum member %s", member.Name)
+			return nil
+		}
+		names[member.Name] = true
+
+		if p.peekTokenIs(token.LParen) {
+			p.nextToken()
+			member.Fields = []string{}
+			for !p.peekTokenIs(token.RParen) {
+				if !p.expectPeek(token.Identifier) {
+					return nil
+				}
+				member.Fields = append(member.Fields, p.curToken.Literal)
+
+				if !p.peekTokenIs(token.RParen) && !p.expectPeek(token.Comma) {
+					return nil
+				}
+			}
+			p.nextToken()
+		}
+
+		e.Members = append(e.Members, member)
+	}
+	p.nextToken()
+
+	if len(e.Members) == 0 {
+		p.addErrorWithCPos(e.Token.Pos, "Enum must have at least one member")
+		return nil
+	}
+	return e
+}
+
+// parseLabeledLoop parses a loop with a label that break and continue
+// statements in nested loops can use to refer to it.
+func (p *Parser) parseLabeledLoop() ast.Statement {
+	if p.settings.Debug {
+		fmt.Println("parseLabeledLoop")
+	}
+	label := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.nextToken()
+	p.nextToken()
+
+	var stmt ast.Statement
+	switch p.curToken.Type {
+	case token.For:
+		stmt = p.parseForLoop()
+	case token.While:
+		stmt = p.parseWhileLoop()
+	case token.Loop:
+		stmt = p.parseInfiniteLoop()
+	default:
+		p.addErrorWithPos("expected a loop after label %s, got %s", label.Value, p.curToken.Type.String())
+		return nil
+	}
+
+	switch loop := stmt.(type) {
+	case *ast.LoopStatement:
+		loop.Label = label
+	case *ast.IterLoopStatement:
+		loop.Label = label
+	}
+	return stmt
+}
+
+// parseLoopLabel parses the optional label after break or continue.
+func (p *Parser) parseLoopLabel() *ast.Identifier {
+	if !p.peekTokenIs(token.Identifier) {
+		return nil
+	}
+	p.nextToken()
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parseLoopElse parses the optional else block after the body of a loop.
+func (p *Parser) parseLoopElse() *ast.BlockStatement {
+	if !p.peekTokenIs(token.Else) {
+		return nil
+	}
+	p.nextToken()
+
+	if !p.expectPeek(token.LBrace) {
+		return nil
 	}
+	return p.parseBlockStatements()
 }
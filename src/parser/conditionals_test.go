@@ -401,3 +401,246 @@ func TestInfiniteForLoopEmptyParens(t *testing.T) {
 		t.Fatalf("Incorrect number of body statements. Expected 1, got %d", len(fl.Body.Statements))
 	}
 }
+
+func TestTryCatchExpression(t *testing.T) {
+	input := `try { x } catch e ^ IOError { y } catch { z } finally { w }`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.TryCatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TryCatchExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if len(exp.Catches) != 2 {
+		t.Fatalf("try has wrong number of catch blocks. got=%d", len(exp.Catches))
+	}
+
+	typed := exp.Catches[0]
+	if !testIdentifier(t, typed.Symbol, "e") {
+		return
+	}
+	if !testIdentifier(t, typed.Class, "IOError") {
+		return
+	}
+
+	untyped := exp.Catches[1]
+	if untyped.Symbol != nil || untyped.Class != nil {
+		t.Errorf("second catch block should be untyped. got=%s", untyped.String())
+	}
+
+	if exp.Finally == nil || len(exp.Finally.Statements) != 1 {
+		t.Fatalf("try has no finally block")
+	}
+}
+
+func TestTryFinallyExpression(t *testing.T) {
+	input := `try { x } finally { y }`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TryCatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TryCatchExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if len(exp.Catches) != 0 {
+		t.Fatalf("try has wrong number of catch blocks. got=%d", len(exp.Catches))
+	}
+	if exp.Finally == nil {
+		t.Fatalf("try has no finally block")
+	}
+}
+
+func TestTryWithoutCatch(t *testing.T) {
+	l := lexer.NewString(`try { x }`)
+	p := New(l, nil)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected a parser error for try without catch or finally")
+	}
+}
+
+func TestForLoopDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		key      string
+		expected string
+	}{
+		{"for [a, b] in pairs { a }", "", "[a, b]"},
+		{"for i, {name} in people { name }", "i", "{name}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		loop, ok := program.Statements[0].(*ast.IterLoopStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.IterLoopStatement. got=%T", program.Statements[0])
+		}
+
+		if tt.key != "" {
+			testIdentifier(t, loop.Key, tt.key)
+		}
+		if loop.Pattern == nil {
+			t.Fatalf("loop.Pattern is nil for %q", tt.input)
+		}
+		if loop.Pattern.String() != tt.expected {
+			t.Errorf("loop.Pattern wrong. expected=%q, got=%q", tt.expected, loop.Pattern.String())
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match x {
+    1 => "one",
+    int if x > 10 => "big"
+    [a, b] => a + b
+    _ => { nil }
+}`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	testIdentifier(t, exp.Value, "x")
+
+	if len(exp.Arms) != 4 {
+		t.Fatalf("wrong number of arms. want=4, got=%d", len(exp.Arms))
+	}
+
+	testLiteralExpression(t, exp.Arms[0].Pattern, 1)
+	testIdentifier(t, exp.Arms[1].Pattern, "int")
+	testInfixExpression(t, exp.Arms[1].Guard, "x", ">", 10)
+	if _, ok := exp.Arms[2].Pattern.(*ast.ArrayPattern); !ok {
+		t.Errorf("arm 2 pattern is not ast.ArrayPattern. got=%T", exp.Arms[2].Pattern)
+	}
+	if exp.Arms[3].Pattern != nil {
+		t.Errorf("wildcard arm has a pattern. got=%T", exp.Arms[3].Pattern)
+	}
+}
+
+func TestInvalidMatchPattern(t *testing.T) {
+	input := `match x { a + b => 1 }`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatal("expected parser errors")
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"outer: for x in a { break outer }", "outer: for x in a { break outer; }"},
+		{"outer: while true { continue outer }", "outer: while true { continue outer; }"},
+		{"for x in a { break } else { f() }", "for x in a { break; } else { f(); }"},
+		{"while x { x } else { y }", "while x { x; } else { y; }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestInvalidLabeledLoops(t *testing.T) {
+	tests := []string{
+		"outer: x + 1",
+		"loop { break } else { f() }",
+	}
+
+	for _, input := range tests {
+		l := lexer.NewString(input)
+		p := New(l, nil)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected errors parsing %q", input)
+		}
+	}
+}
+
+func TestDeferAndWith(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"defer f.close()", "defer (f.close)()"},
+		{"with open(path) as f { f.read() }", "with open(path) as f { (f.read)(); }"},
+		{"with lock { x }", "with lock { x; }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestInvalidDeferAndWith(t *testing.T) {
+	tests := []string{
+		"defer x = 1",
+		"with f as { x }",
+		"with f as g x",
+	}
+
+	for _, input := range tests {
+		l := lexer.NewString(input)
+		p := New(l, nil)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected errors parsing %q", input)
+		}
+	}
+}
@@ -33,9 +33,21 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.Defaults, lit.Patterns, lit.Rest = p.parseFunctionParameters()
 
 	if lit.Native {
+		for _, def := range lit.Defaults {
+			if def != nil {
+				p.addErrorWithCPos(lit.Token.Pos, "Native functions can't have default parameters")
+				return nil
+			}
+		}
+		for _, pattern := range lit.Patterns {
+			if pattern != nil {
+				p.addErrorWithCPos(lit.Token.Pos, "Native functions can't have destructured parameters")
+				return nil
+			}
+		}
 		return lit
 	}
 
@@ -53,45 +65,217 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+func (p *Parser) parseAsyncFunctionLiteral() ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parseAsyncFunctionLiteral")
+	}
+	asyncToken := p.curToken
+
+	if !p.expectPeek(token.Function) {
+		return nil
+	}
+
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	if lit.Native {
+		p.addErrorWithCPos(asyncToken.Pos, "Native functions can't be async")
+		return nil
+	}
+
+	lit.Async = true
+	return lit
+}
+
+func (p *Parser) parseAwaitExpression() ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parseAwaitExpression")
+	}
+	expression := &ast.AwaitExpression{Token: p.curToken}
+
+	p.nextToken()
+	value, ok := p.parseExpression(priPrefix).(ast.Expression)
+	if !ok {
+		return nil
+	}
+	expression.Value = value
+
+	return expression
+}
+
+// parseFunctionParameters parses a parameter list. Parameters can be given a
+// default with `name = value`, the returned defaults are nil for parameters without one.
+// The last parameter can be written `...name` to collect any extra arguments.
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []ast.Expression, []ast.Expression, *ast.Identifier) {
 	if p.settings.Debug {
 		fmt.Println("parseFunctionParameters")
 	}
 	idents := []*ast.Identifier{}
+	defaults := []ast.Expression{}
+	patterns := []ast.Expression{}
 
 	if p.peekTokenIs(token.RParen) {
 		p.nextToken()
-		return idents
+		return idents, defaults, patterns, nil
 	}
 
-	p.nextToken()
+	hasDefault := false
+	for {
+		p.nextToken()
+		if p.curTokenIs(token.Ellipsis) {
+			if !p.expectPeek(token.Identifier) {
+				return nil, nil, nil, nil
+			}
+			rest := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	idents = append(idents, ident)
+			if !p.peekTokenIs(token.RParen) {
+				p.addErrorWithCPos(rest.Token.Pos, "Rest parameter %s must be the last parameter", rest.Value)
+				return nil, nil, nil, nil
+			}
+			p.nextToken()
+			return idents, defaults, patterns, rest
+		}
 
-	for p.peekTokenIs(token.Comma) {
-		p.nextToken()
-		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		var ident *ast.Identifier
+		if p.curTokenIs(token.LSquare, token.LBrace) {
+			// A destructured parameter is named after its pattern which can't
+			// clash with a real identifier
+			tok := p.curToken
+			pattern := p.parsePattern()
+			if pattern == nil {
+				return nil, nil, nil, nil
+			}
+			ident = &ast.Identifier{Token: tok, Value: pattern.String()}
+			patterns = append(patterns, pattern)
+		} else {
+			ident = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			patterns = append(patterns, nil)
+		}
 		idents = append(idents, ident)
+
+		if p.peekTokenIs(token.Assign) {
+			p.nextToken()
+			p.nextToken()
+			def, ok := p.parseExpression(priLowest).(ast.Expression)
+			if !ok {
+				return nil, nil, nil, nil
+			}
+			defaults = append(defaults, def)
+			hasDefault = true
+		} else {
+			if hasDefault {
+				p.addErrorWithCPos(ident.Token.Pos, "Parameter %s without a default follows parameters with defaults", ident.Value)
+				return nil, nil, nil, nil
+			}
+			defaults = append(defaults, nil)
+		}
+
+		if !p.peekTokenIs(token.Comma) {
+			break
+		}
+		p.nextToken()
 	}
 
 	if !p.expectPeek(token.RParen) {
-		return nil
+		return nil, nil, nil, nil
 	}
 
-	return idents
+	return idents, defaults, patterns, nil
 }
 
 func (p *Parser) parseCallExpression(left ast.Expression) ast.Node {
 	if p.settings.Debug {
 		fmt.Println("parseCallExpression")
 	}
-	return &ast.CallExpression{
-		Token:     p.curToken,
-		Function:  left,
-		Arguments: p.parseExpressionList(token.RParen),
+	call := &ast.CallExpression{
+		Token:    p.curToken,
+		Function: left,
 	}
+	call.Arguments, call.Keywords = p.parseCallArguments()
+	if call.Arguments == nil {
+		return nil
+	}
+	return call
+}
+
+// parseCallArguments parses the arguments of a call. Keyword arguments are
+// written `name: value` and must come after all positional arguments.
+func (p *Parser) parseCallArguments() ([]ast.Expression, []*ast.KeywordArgument) {
+	if p.settings.Debug {
+		fmt.Println("parseCallArguments")
+	}
+	args := []ast.Expression{}
+	var keywords []*ast.KeywordArgument
+
+	if p.peekTokenIs(token.RParen) {
+		p.nextToken()
+		return args, keywords
+	}
+
+	for {
+		p.nextToken()
+		if p.curTokenIs(token.RParen) { // Trailing comma
+			return args, keywords
+		}
+
+		if p.curTokenIs(token.Identifier) && p.peekTokenIs(token.Colon) {
+			kw := &ast.KeywordArgument{Token: p.curToken, Name: p.curToken.Literal}
+			for _, other := range keywords {
+				if other.Name == kw.Name {
+					p.addErrorWithCPos(kw.Token.Pos, "Keyword argument %s given more than once", kw.Name)
+					return nil, nil
+				}
+			}
+
+			p.nextToken()
+			p.nextToken()
+			value, ok := p.parseExpression(priLowest).(ast.Expression)
+			if !ok {
+				return nil, nil
+			}
+			kw.Value = value
+			keywords = append(keywords, kw)
+		} else {
+			if keywords != nil {
+				p.addErrorWithCPos(p.curToken.Pos, "Positional argument follows keyword arguments")
+				return nil, nil
+			}
+
+			expr, ok := p.parseExpression(priLowest).(ast.Expression)
+			if !ok {
+				return nil, nil
+			}
+			args = append(args, expr)
+		}
+
+		if !p.peekTokenIs(token.Comma) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RParen) {
+		return nil, nil
+	}
+
+	return args, keywords
+}
+
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parseSpreadExpression")
+	}
+	expression := &ast.SpreadExpression{Token: p.curToken}
+
+	p.nextToken()
+	value, ok := p.parseExpression(priLowest).(ast.Expression)
+	if !ok {
+		return nil
+	}
+	expression.Value = value
+
+	return expression
 }
 
 func (p *Parser) parseDoExpression() ast.Expression {
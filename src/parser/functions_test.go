@@ -175,3 +175,203 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestAsyncFunctionParsing(t *testing.T) {
+	input := `let f = async fn(x) { await x; }`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.DefStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.DefStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T",
+			stmt.Value)
+	}
+
+	if !function.Async {
+		t.Fatal("function literal is not async")
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
+			function.Body.Statements[0])
+	}
+
+	await, ok := bodyStmt.Expression.(*ast.AwaitExpression)
+	if !ok {
+		t.Fatalf("function body expression is not ast.AwaitExpression. got=%T",
+			bodyStmt.Expression)
+	}
+
+	testLiteralExpression(t, await.Value, "x")
+}
+
+func TestDefaultParameterParsing(t *testing.T) {
+	input := `let f = fn(x, y = 2, z = x + 1) {};`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.DefStatement)
+	function := stmt.Value.(*ast.FunctionLiteral)
+
+	if len(function.Parameters) != 3 || len(function.Defaults) != 3 {
+		t.Fatalf("wrong number of parameters. want 3, got=%d (%d defaults)",
+			len(function.Parameters), len(function.Defaults))
+	}
+
+	if function.Defaults[0] != nil {
+		t.Errorf("parameter x has a default. got=%s", function.Defaults[0])
+	}
+	testLiteralExpression(t, function.Defaults[1], 2)
+	testInfixExpression(t, function.Defaults[2], "x", "+", 1)
+}
+
+func TestInvalidDefaultParameters(t *testing.T) {
+	input := `fn(x = 1, y) {};`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("No errors for required parameter after default")
+	}
+
+	if p.Errors()[0] != "line 1, col 11 Parameter y without a default follows parameters with defaults" {
+		t.Fatalf("Incorrect error message. Got %q", p.Errors()[0])
+	}
+}
+
+func TestKeywordArgumentParsing(t *testing.T) {
+	input := `add(1, y: 2 * 3, z: w);`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if len(exp.Arguments) != 1 {
+		t.Fatalf("wrong number of arguments. want=1, got=%d", len(exp.Arguments))
+	}
+	testLiteralExpression(t, exp.Arguments[0], 1)
+
+	if len(exp.Keywords) != 2 {
+		t.Fatalf("wrong number of keyword arguments. want=2, got=%d", len(exp.Keywords))
+	}
+	if exp.Keywords[0].Name != "y" || exp.Keywords[1].Name != "z" {
+		t.Fatalf("wrong keyword names. got=%s, %s", exp.Keywords[0].Name, exp.Keywords[1].Name)
+	}
+	testInfixExpression(t, exp.Keywords[0].Value, 2, "*", 3)
+	testLiteralExpression(t, exp.Keywords[1].Value, "w")
+}
+
+func TestInvalidKeywordArguments(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"add(x: 1, 2);", "line 1, col 11 Positional argument follows keyword arguments"},
+		{"add(x: 1, x: 2);", "line 1, col 11 Keyword argument x given more than once"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Fatalf("No errors for %q", tt.input)
+		}
+
+		if p.Errors()[0] != tt.err {
+			t.Fatalf("Incorrect error message. Got %q", p.Errors()[0])
+		}
+	}
+}
+
+func TestRestParameterParsing(t *testing.T) {
+	input := `let f = fn(x, ...rest) {};`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.DefStatement)
+	function := stmt.Value.(*ast.FunctionLiteral)
+
+	if len(function.Parameters) != 1 {
+		t.Fatalf("wrong number of parameters. want 1, got=%d", len(function.Parameters))
+	}
+	if function.Rest == nil {
+		t.Fatal("function has no rest parameter")
+	}
+	testLiteralExpression(t, function.Rest, "rest")
+}
+
+func TestSpreadArgumentParsing(t *testing.T) {
+	input := `add(1, ...args);`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp := stmt.Expression.(*ast.CallExpression)
+
+	if len(exp.Arguments) != 2 {
+		t.Fatalf("wrong number of arguments. want=2, got=%d", len(exp.Arguments))
+	}
+
+	spread, ok := exp.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("argument is not ast.SpreadExpression. got=%T", exp.Arguments[1])
+	}
+	testLiteralExpression(t, spread.Value, "args")
+}
+
+func TestDestructuredParameterParsing(t *testing.T) {
+	input := `let f = fn([a, b], {c} = d) {};`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.DefStatement)
+	function := stmt.Value.(*ast.FunctionLiteral)
+
+	if len(function.Patterns) != 2 {
+		t.Fatalf("wrong number of patterns. want 2, got=%d", len(function.Patterns))
+	}
+	if function.Patterns[0].String() != "[a, b]" {
+		t.Errorf("first pattern wrong. got=%q", function.Patterns[0].String())
+	}
+	if function.Patterns[1].String() != "{c}" {
+		t.Errorf("second pattern wrong. got=%q", function.Patterns[1].String())
+	}
+	testLiteralExpression(t, function.Defaults[1], "d")
+}
@@ -75,6 +75,50 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	}
 }
 
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	if p.settings.Debug {
+		fmt.Println("parseInterpolatedString")
+	}
+	str := &ast.InterpolatedString{Token: p.curToken}
+
+	for {
+		if p.curToken.Literal != "" {
+			str.Parts = append(str.Parts, &ast.StringLiteral{
+				Token: p.curToken,
+				Value: []rune(p.curToken.Literal),
+			})
+		}
+		if p.curTokenIs(token.InterpEnd) {
+			break
+		}
+
+		p.nextToken()
+		if p.curTokenIs(token.InterpMid, token.InterpEnd) {
+			p.addErrorWithPos("Empty expression in string interpolation")
+			return nil
+		}
+
+		exp := p.parseExpression(priLowest)
+		if exp == nil {
+			return nil
+		}
+		expr, ok := exp.(ast.Expression)
+		if !ok {
+			p.addErrorWithPos("Invalid expression in string interpolation")
+			return nil
+		}
+		str.Parts = append(str.Parts, expr)
+
+		p.nextToken()
+		if !p.curTokenIs(token.InterpMid, token.InterpEnd) {
+			p.addErrorWithPos("Expected } to end string interpolation, got %s", p.curToken.Type)
+			return nil
+		}
+	}
+
+	return str
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	if p.settings.Debug {
 		fmt.Println("parseBoolean")
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/nitrogen-lang/nitrogen/src/ast"
@@ -137,3 +138,280 @@ func TestNullLiteral(t *testing.T) {
 		t.Fatalf("Null value incorrect. Expected nil, got %s", null.String())
 	}
 }
+
+func TestInterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		parts    int
+	}{
+		{`"host={host}:{port + 1}"`, "host={host}:{(port + 1)}", 4},
+		{`"{a}"`, "{a}", 1},
+		{`"a {({"k": 1})["k"]} b"`, `a {({k: 1}[k])} b`, 3},
+		{`"outer {("inner {x}")} end"`, "outer {inner {x}} end", 3},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+
+		if len(str.Parts) != tt.parts {
+			t.Errorf("wrong number of parts. expected=%d, got=%d", tt.parts, len(str.Parts))
+		}
+		if str.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, str.String())
+		}
+	}
+}
+
+func TestUninterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"format {} string"`, "format {} string"},
+		{`"escaped \{brace\}"`, "escaped {brace}"},
+		{`"lone } brace"`, "lone } brace"},
+		{`"spaced { x } brace"`, "spaced { x } brace"},
+		{`"{\"k\": 1}"`, `{"k": 1}`},
+		{`'raw {string}'`, "raw {string}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, literal.String())
+		}
+	}
+}
+
+func TestInvalidInterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = "abc {1 +} def"`, "line 1, col 18"},
+		{`let a = "abc {x y} def"`, "line 1, col 17"},
+		{`let a = "abc {x def`, "line 1, col 17"},
+		{`let a = "abc {x` + "\n", "line 1, col 15"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+		if !strings.HasPrefix(errors[0], tt.expected) {
+			t.Errorf("expected error at %q, got %q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestClassMembers(t *testing.T) {
+	input := `class Counter {
+	static let created = 0
+	private let count
+	let _step = 1
+
+	static fn make() { new Counter() }
+	get value() { this.count }
+	set value(val) { this.count = val }
+	private fn reset() { this.count = 0 }
+	fn incr() { this.count += this._step }
+}`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	def, ok := program.Statements[0].(*ast.DefStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.DefStatement. got=%T", program.Statements[0])
+	}
+	class, ok := def.Value.(*ast.ClassLiteral)
+	if !ok {
+		t.Fatalf("def.Value is not ast.ClassLiteral. got=%T", def.Value)
+	}
+
+	if len(class.Statics) != 2 {
+		t.Errorf("class has wrong number of static members. want 2, got=%d", len(class.Statics))
+	}
+	if len(class.Fields) != 2 {
+		t.Errorf("class has wrong number of fields. want 2, got=%d", len(class.Fields))
+	}
+	if len(class.Methods) != 2 {
+		t.Errorf("class has wrong number of methods. want 2, got=%d", len(class.Methods))
+	}
+	if class.Getters["value"] == nil || class.Setters["value"] == nil {
+		t.Errorf("class is missing accessors for value")
+	}
+	if !class.Private["count"] || !class.Private["reset"] || class.Private["incr"] {
+		t.Errorf("class has wrong private members. got=%v", class.Private)
+	}
+}
+
+func TestInvalidClassMembers(t *testing.T) {
+	tests := []string{
+		`class A { get x(a) { a } }`,
+		`class A { set x() { 1 } }`,
+		`class A { static get x() { 1 } }`,
+		`class A { let x; get x() { 1 } }`,
+		`class A { static let x; static let x }`,
+	}
+
+	for _, input := range tests {
+		l := lexer.NewString(input)
+		p := New(l, nil)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestTraitParsing(t *testing.T) {
+	input := `trait Named {
+	let name
+	fn rename(name) { this.name = name }
+	fn describe() { this.name }
+}
+
+class Widget ^ Base use Named(describe as label), Other {}`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	trait, ok := program.Statements[0].(*ast.DefStatement).Value.(*ast.TraitLiteral)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not a trait. got=%T", program.Statements[0].(*ast.DefStatement).Value)
+	}
+	if trait.Name != "Named" || len(trait.Fields) != 1 || len(trait.Methods) != 2 {
+		t.Errorf("trait parsed incorrectly. got name=%s fields=%d methods=%d", trait.Name, len(trait.Fields), len(trait.Methods))
+	}
+
+	class := program.Statements[1].(*ast.DefStatement).Value.(*ast.ClassLiteral)
+	if class.Parent != "Base" || len(class.Traits) != 2 {
+		t.Fatalf("class parsed incorrectly. got parent=%s traits=%d", class.Parent, len(class.Traits))
+	}
+	if class.Traits[0].Name != "Named" || class.Traits[0].Aliases["describe"] != "label" {
+		t.Errorf("trait use parsed incorrectly. got=%v", class.Traits[0])
+	}
+	if class.Traits[1].Name != "Other" || len(class.Traits[1].Aliases) != 0 {
+		t.Errorf("trait use parsed incorrectly. got=%v", class.Traits[1])
+	}
+}
+
+func TestTraitConflicts(t *testing.T) {
+	tests := []struct {
+		input string
+		valid bool
+	}{
+		{`trait A { fn f() {} }; trait B { fn f() {} }; class C use A, B {}`, false},
+		{`trait A { fn f() {} }; trait B { fn f() {} }; class C use A(f as g), B {}`, true},
+		{`trait A { fn f() {} }; class C use A(g as h) {}`, false},
+		{`trait A { fn f() {} }; class C use A, B {}`, true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		p.ParseProgram()
+
+		if valid := len(p.Errors()) == 0; valid != tt.valid {
+			t.Errorf("wrong result for %q. expected valid=%t, errors=%v", tt.input, tt.valid, p.Errors())
+		}
+	}
+}
+
+func TestEnumParsing(t *testing.T) {
+	input := `enum Shape {
+	Circle(radius)
+	Rect(width, height),
+	Empty
+}`
+
+	l := lexer.NewString(input)
+	p := New(l, nil)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	def := program.Statements[0].(*ast.DefStatement)
+	if !def.Const {
+		t.Errorf("enum definition is not constant")
+	}
+	enum, ok := def.Value.(*ast.EnumLiteral)
+	if !ok {
+		t.Fatalf("def.Value is not ast.EnumLiteral. got=%T", def.Value)
+	}
+
+	expected := []struct {
+		name   string
+		fields []string
+	}{
+		{"Circle", []string{"radius"}},
+		{"Rect", []string{"width", "height"}},
+		{"Empty", nil},
+	}
+	if len(enum.Members) != len(expected) {
+		t.Fatalf("enum has wrong number of members. want %d, got=%d", len(expected), len(enum.Members))
+	}
+	for i, tt := range expected {
+		member := enum.Members[i]
+		if member.Name != tt.name || len(member.Fields) != len(tt.fields) || (tt.fields == nil) != (member.Fields == nil) {
+			t.Errorf("member %d wrong. want %s%v, got %s%v", i, tt.name, tt.fields, member.Name, member.Fields)
+		}
+	}
+}
+
+func TestEnumMatchExhaustive(t *testing.T) {
+	tests := []struct {
+		input string
+		valid bool
+	}{
+		{`enum C { A, B }; match x { C.A => 1, C.B => 2 }`, true},
+		{`enum C { A, B }; match x { C.A => 1 }`, false},
+		{`enum C { A, B }; match x { C.A => 1, C.B if y => 2 }`, false},
+		{`enum C { A, B }; match x { C.A => 1, _ => 2 }`, true},
+		{`enum C { A, B(v) }; match x { C.A => 1, C.B(v) => v }`, true},
+		{`fn f(x) { match x { C.A => 1 } }; enum C { A, B }`, false},
+		{`match x { D.A => 1 }`, true},
+		{`enum C { A, A }`, false},
+		{`enum C {}`, false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewString(tt.input)
+		p := New(l, nil)
+		p.ParseProgram()
+
+		if valid := len(p.Errors()) == 0; valid != tt.valid {
+			t.Errorf("wrong result for %q. expected valid=%t, errors=%v", tt.input, tt.valid, p.Errors())
+		}
+	}
+}
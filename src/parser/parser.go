@@ -13,44 +13,54 @@ const (
 	priCompare         // and, or
 	priEquals          // ==
 	priLessGreater     // > or <
+	priRange           // 0..10
 	priSum             // +, -
 	priProduct         // *, /
 	priPrefix          // -x or !x
+	priPower           // **
 	priCall            // myFunction(x)
 	priIndex           // array[index]
 	priAssign
 )
 
 var precedences = map[token.TokenType]int{
-	token.LAnd:          priCompare,
-	token.LOr:           priCompare,
-	token.Equal:         priEquals,
-	token.NotEqual:      priEquals,
-	token.LessThanEq:    priEquals,
-	token.GreaterThanEq: priEquals,
-	token.LessThan:      priLessGreater,
-	token.GreaterThan:   priLessGreater,
-	token.Plus:          priSum,
-	token.Dash:          priSum,
-	token.BitwiseOr:     priSum,
-	token.Carrot:        priSum,
-	token.Slash:         priProduct,
-	token.Asterisk:      priProduct,
-	token.Modulo:        priProduct,
-	token.ShiftLeft:     priProduct,
-	token.ShiftRight:    priProduct,
-	token.BitwiseAnd:    priProduct,
-	token.BitwiseAndNot: priProduct,
-	token.LParen:        priCall,
-	token.Implements:    priCall,
-	token.LSquare:       priIndex,
-	token.Dot:           priIndex,
-	token.Assign:        priAssign,
-	token.PlusAssign:    priAssign,
-	token.MinusAssign:   priAssign,
-	token.TimesAssign:   priAssign,
-	token.SlashAssign:   priAssign,
-	token.ModAssign:     priAssign,
+	token.LAnd:           priCompare,
+	token.LOr:            priCompare,
+	token.NullCoalesce:   priCompare,
+	token.Equal:          priEquals,
+	token.NotEqual:       priEquals,
+	token.LessThanEq:     priEquals,
+	token.GreaterThanEq:  priEquals,
+	token.In:             priEquals,
+	token.Not:            priEquals,
+	token.LessThan:       priLessGreater,
+	token.GreaterThan:    priLessGreater,
+	token.Range:          priRange,
+	token.RangeInclusive: priRange,
+	token.Plus:           priSum,
+	token.Dash:           priSum,
+	token.BitwiseOr:      priSum,
+	token.Carrot:         priSum,
+	token.Slash:          priProduct,
+	token.Asterisk:       priProduct,
+	token.Modulo:         priProduct,
+	token.ShiftLeft:      priProduct,
+	token.ShiftRight:     priProduct,
+	token.BitwiseAnd:     priProduct,
+	token.BitwiseAndNot:  priProduct,
+	token.Power:          priPower,
+	token.LParen:         priCall,
+	token.Implements:     priCall,
+	token.LSquare:        priIndex,
+	token.Dot:            priIndex,
+	token.OptionalDot:    priIndex,
+	token.Assign:         priAssign,
+	token.PlusAssign:     priAssign,
+	token.MinusAssign:    priAssign,
+	token.TimesAssign:    priAssign,
+	token.SlashAssign:    priAssign,
+	token.ModAssign:      priAssign,
+	token.PowerAssign:    priAssign,
 }
 
 type (
@@ -71,6 +81,9 @@ type Parser struct {
 	peekToken token.Token
 
 	insertedTokens []token.Token
+	traits         map[string]*ast.TraitLiteral // Traits declared so far, used to check for conflicts
+	enums          map[string]*ast.EnumLiteral
+	matches        []*ast.MatchExpression // Checked for unhandled enum members after parsing
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -86,6 +99,8 @@ func New(l *lexer.Lexer, settings *Settings) *Parser {
 		settings:       settings,
 		errors:         []string{},
 		insertedTokens: make([]token.Token, 0, 5),
+		traits:         make(map[string]*ast.TraitLiteral),
+		enums:          make(map[string]*ast.EnumLiteral),
 	}
 
 	// Prefix parsing functions
@@ -95,18 +110,25 @@ func New(l *lexer.Lexer, settings *Settings) *Parser {
 	p.registerPrefix(token.Float, p.parseFloatLiteral)
 	p.registerPrefix(token.Nil, p.parseNullLiteral)
 	p.registerPrefix(token.String, p.parseStringLiteral)
+	p.registerPrefix(token.InterpStart, p.parseInterpolatedString)
 	p.registerPrefix(token.True, p.parseBoolean)
 	p.registerPrefix(token.False, p.parseBoolean)
 	p.registerPrefix(token.LSquare, p.parseArrayLiteral)
 	p.registerPrefix(token.LBrace, p.parseHashLiteral)
 	p.registerPrefix(token.Function, p.parseFunctionLiteral)
+	p.registerPrefix(token.Async, p.parseAsyncFunctionLiteral)
+	p.registerPrefix(token.Await, p.parseAwaitExpression)
+	p.registerPrefix(token.Ellipsis, p.parseSpreadExpression)
 	p.registerPrefix(token.Bang, p.parsePrefixExpression)
 	p.registerPrefix(token.Dash, p.parsePrefixExpression)
 	p.registerPrefix(token.LParen, p.parseGroupedExpression)
 	p.registerPrefix(token.If, p.parseIfExpression)
+	p.registerPrefix(token.Match, p.parseMatchExpression)
 	p.registerPrefix(token.Try, p.parseTryCatch)
 	p.registerPrefix(token.Class, p.parseClassLiteral)
 	p.registerPrefix(token.Interface, p.parseInterfaceLiteral)
+	p.registerPrefix(token.Trait, p.parseTraitLiteral)
+	p.registerPrefix(token.Enum, p.parseEnumLiteral)
 	p.registerPrefix(token.New, p.parseMakeExpression)
 	p.registerPrefix(token.Do, p.parseDoExpression)
 
@@ -117,6 +139,7 @@ func New(l *lexer.Lexer, settings *Settings) *Parser {
 	p.registerInfix(token.Slash, p.parseInfixExpression)
 	p.registerInfix(token.Asterisk, p.parseInfixExpression)
 	p.registerInfix(token.Modulo, p.parseInfixExpression)
+	p.registerInfix(token.Power, p.parseInfixExpression)
 	p.registerInfix(token.Equal, p.parseInfixExpression)
 	p.registerInfix(token.NotEqual, p.parseInfixExpression)
 	p.registerInfix(token.LessThanEq, p.parseInfixExpression)
@@ -125,15 +148,18 @@ func New(l *lexer.Lexer, settings *Settings) *Parser {
 	p.registerInfix(token.GreaterThan, p.parseInfixExpression)
 	p.registerInfix(token.LAnd, p.parseCompareExpression)
 	p.registerInfix(token.LOr, p.parseCompareExpression)
+	p.registerInfix(token.NullCoalesce, p.parseCompareExpression)
 	p.registerInfix(token.LParen, p.parseCallExpression)
 	p.registerInfix(token.LSquare, p.parseIndexExpression)
 	p.registerInfix(token.Dot, p.parseAttributeExpression)
+	p.registerInfix(token.OptionalDot, p.parseOptionalChain)
 	p.registerInfix(token.Assign, p.parseAssignmentStatement)
 	p.registerInfix(token.PlusAssign, p.parseCompoundAssign)
 	p.registerInfix(token.MinusAssign, p.parseCompoundAssign)
 	p.registerInfix(token.TimesAssign, p.parseCompoundAssign)
 	p.registerInfix(token.SlashAssign, p.parseCompoundAssign)
 	p.registerInfix(token.ModAssign, p.parseCompoundAssign)
+	p.registerInfix(token.PowerAssign, p.parseCompoundAssign)
 	p.registerInfix(token.ShiftLeft, p.parseInfixExpression)
 	p.registerInfix(token.ShiftRight, p.parseInfixExpression)
 	p.registerInfix(token.BitwiseAnd, p.parseInfixExpression)
@@ -141,6 +167,10 @@ func New(l *lexer.Lexer, settings *Settings) *Parser {
 	p.registerInfix(token.BitwiseOr, p.parseInfixExpression)
 	p.registerInfix(token.Carrot, p.parseInfixExpression)
 	p.registerInfix(token.Implements, p.parseInfixExpression)
+	p.registerInfix(token.In, p.parseInfixExpression)
+	p.registerInfix(token.Range, p.parseRangeExpression)
+	p.registerInfix(token.RangeInclusive, p.parseRangeExpression)
+	p.registerInfix(token.Not, p.parseNotInExpression)
 
 	// Read the first two tokens to populate curToken and peekToken
 	p.nextToken()
@@ -248,6 +278,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	p.checkEnumMatches()
 	return program
 }
 
@@ -413,6 +444,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Node {
 	}
 
 	precedence := p.curPrecedence()
+	if p.curTokenIs(token.Power) {
+		precedence-- // Right associative
+	}
 	p.nextToken()
 	var ok bool
 	expression.Right, ok = p.parseExpression(precedence).(ast.Expression)
@@ -422,6 +456,23 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Node {
 	return expression
 }
 
+// parseNotInExpression parses the negated membership test `x not in coll`.
+func (p *Parser) parseNotInExpression(left ast.Expression) ast.Node {
+	if p.settings.Debug {
+		fmt.Println("parseNotInExpression")
+	}
+	if !p.expectPeek(token.In) {
+		return nil
+	}
+
+	exp, ok := p.parseInfixExpression(left).(*ast.InfixExpression)
+	if !ok {
+		return nil
+	}
+	exp.Operator = "not in"
+	return exp
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	return p.parseGroupedExpressionC(token.RParen)
 }
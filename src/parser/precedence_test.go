@@ -63,6 +63,7 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 - 5;", 5, "-", 5},
 		{"5 * 5;", 5, "*", 5},
 		{"5 / 5;", 5, "/", 5},
+		{"5 ** 5;", 5, "**", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
@@ -138,6 +139,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b / c",
 			"(a + (b / c))",
 		},
+		{
+			"a * b ** c",
+			"(a * (b ** c))",
+		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
 		{
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
@@ -230,6 +243,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"6 % 3 * 4",
 			"((6 % 3) * 4)",
 		},
+		{
+			"a + 1 in b",
+			"((a + 1) in b)",
+		},
+		{
+			"a not in b and c in d",
+			"((a not in b) and (c in d))",
+		},
+		{
+			"a in b == c",
+			"((a in b) == c)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -30,6 +30,9 @@ const (
 	Integer
 	Float
 	String
+	InterpStart // Start of a string up to the first interpolated expression
+	InterpMid   // String between two interpolated expressions
+	InterpEnd   // String after the last interpolated expression
 
 	// Operators
 	Assign
@@ -39,13 +42,21 @@ const (
 	Asterisk
 	Slash
 	Modulo
+	Power
 	Dot
+	Ellipsis
+	Range
+	RangeInclusive
+	Arrow
+	OptionalDot
+	NullCoalesce
 
 	PlusAssign
 	MinusAssign
 	TimesAssign
 	SlashAssign
 	ModAssign
+	PowerAssign
 
 	LessThan
 	GreaterThan
@@ -97,6 +108,7 @@ const (
 	Break
 	Try
 	Catch
+	Finally
 	Throw
 	Class
 	New
@@ -110,6 +122,18 @@ const (
 	In
 	Interface
 	Implements
+	Yield
+	Async
+	Await
+	Match
+	Static
+	Private
+	Trait
+	Enum
+	Not
+	By
+	Defer
+	With
 	keywordEnd
 )
 
@@ -125,6 +149,11 @@ var tokens = [...]string{
 	Float:      "FLOAT",
 	String:     "STRING",
 
+	// Shown in parse errors, the parts after an expression start at its }
+	InterpStart: "STRING",
+	InterpMid:   "}",
+	InterpEnd:   "}",
+
 	// Operators
 	Assign:   "=",
 	Plus:     "+",
@@ -133,12 +162,21 @@ var tokens = [...]string{
 	Asterisk: "*",
 	Slash:    "/",
 	Modulo:   "%",
+	Power:    "**",
+	Ellipsis: "...",
+	Arrow:    "=>",
+
+	Range:          "..",
+	RangeInclusive: "..=",
+	OptionalDot:    "?.",
+	NullCoalesce:   "??",
 
 	PlusAssign:  "+=",
 	MinusAssign: "-=",
 	TimesAssign: "*=",
 	SlashAssign: "/=",
 	ModAssign:   "%=",
+	PowerAssign: "**=",
 
 	LessThan:      "<",
 	GreaterThan:   ">",
@@ -188,6 +226,7 @@ var tokens = [...]string{
 	Break:      "break",
 	Try:        "try",
 	Catch:      "catch",
+	Finally:    "finally",
 	Throw:      "throw",
 	Class:      "class",
 	New:        "new",
@@ -201,6 +240,18 @@ var tokens = [...]string{
 	In:         "in",
 	Interface:  "interface",
 	Implements: "implements",
+	Yield:      "yield",
+	Async:      "async",
+	Await:      "await",
+	Match:      "match",
+	Static:     "static",
+	Private:    "private",
+	Trait:      "trait",
+	Enum:       "enum",
+	Not:        "not",
+	By:         "by",
+	Defer:      "defer",
+	With:       "with",
 }
 
 var keywords map[string]TokenType
@@ -6,11 +6,21 @@ func (vm *VirtualMachine) assignIndexedValue(indexed, index, val object.Object)
 
 	switch i := indexed.(type) {
 	case *object.Array:
+		if slice, ok := index.(*object.Slice); ok {
+			return vm.assignArraySlice(i, slice, val)
+		}
 		return vm.assignArrayIndex(i, index, val)
 	case *object.Hash:
 		return vm.assignHashMapIndex(i, index, val)
 	case *object.String:
+		if slice, ok := index.(*object.Slice); ok {
+			return vm.assignStringSlice(i, slice, val)
+		}
 		return vm.assignStringIndex(i, index, val)
+	case *VMInstance:
+		if res, ok := vm.callMagicMethod(i, "_setIndex", index, val); ok && object.ObjectIs(res, object.ExceptionObj) {
+			return res
+		}
 	}
 	return object.NullConst
 }
@@ -58,12 +68,12 @@ func (vm *VirtualMachine) assignHashMapIndex(
 	hashmap *object.Hash,
 	index, val object.Object) object.Object {
 
-	hashable, ok := index.(object.Hashable)
+	key, ok := vm.HashKey(index)
 	if !ok {
 		return object.NewException("Invalid index type %s", index.Type())
 	}
 
-	hashmap.Pairs[hashable.HashKey()] = object.HashPair{
+	hashmap.Pairs[key] = object.HashPair{
 		Key:   index,
 		Value: val,
 	}
@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"io"
+	"testing"
+
+	"github.com/nitrogen-lang/nitrogen/src/compiler"
+	"github.com/nitrogen-lang/nitrogen/src/lexer"
+	"github.com/nitrogen-lang/nitrogen/src/parser"
+)
+
+func compileBench(b *testing.B, src string) *compiler.CodeBlock {
+	p := parser.New(lexer.NewString(src), &parser.Settings{})
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		b.Fatalf("Parsing failed: %v", p.Errors())
+	}
+	return compiler.Compile(program, "bench")
+}
+
+func runBench(b *testing.B, src string) {
+	code := compileBench(b, src)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewVM(&Settings{Stdout: io.Discard}).Execute(code, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	runBench(b, `const fib = fn(n) {
+	if n < 2 { return n }
+	return fib(n-1) + fib(n-2)
+}
+fib(20)`)
+}
+
+func BenchmarkLocalsLoop(b *testing.B) {
+	runBench(b, `const f = fn() {
+	let total = 0
+	for i = 0; i < 10000; i += 1 {
+		let sq = i * i
+		total += sq
+	}
+	total
+}
+f()`)
+}
+
+func BenchmarkMethodCalls(b *testing.B) {
+	runBench(b, `class Counter {
+	let count = 0
+	fn incr() { this.count += 1 }
+}
+const c = new Counter()
+for i = 0; i < 10000; i += 1 {
+	c.incr()
+}`)
+}
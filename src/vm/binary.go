@@ -2,18 +2,23 @@ package vm
 
 import (
 	"math"
+	"math/big"
 
 	"github.com/nitrogen-lang/nitrogen/src/object"
 )
 
 func (vm *VirtualMachine) evalBinaryExpression(op string, left, right object.Object) object.Object {
+	if instance, ok := left.(*VMInstance); ok {
+		if res, ok := vm.callMagicMethod(instance, binaryMagicMethods[op], right); ok {
+			return res
+		}
+	}
+
 	switch {
+	case isNumber(left) && isNumber(right):
+		return vm.evalNumberBinaryExpression(op, left, right)
 	case left.Type() != right.Type():
-		panic(object.NewException("type mismatch: %s %s %s", left.Type(), op, right.Type()))
-	case object.ObjectsAre(object.IntergerObj, left, right):
-		return vm.evalIntegerBinaryExpression(op, left, right)
-	case object.ObjectsAre(object.FloatObj, left, right):
-		return vm.evalFloatBinaryExpression(op, left, right)
+		return object.NewException("type mismatch: %s %s %s", left.Type(), op, right.Type())
 	case object.ObjectsAre(object.StringObj, left, right):
 		return vm.evalStringBinaryExpression(op, left, right)
 	case object.ObjectsAre(object.ArrayObj, left, right):
@@ -23,29 +28,94 @@ func (vm *VirtualMachine) evalBinaryExpression(op string, left, right object.Obj
 	return object.NewException("unknown operator: %s %s %s", left.Type(), op, right.Type())
 }
 
-func (vm *VirtualMachine) evalIntegerBinaryExpression(op string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+func isNumber(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.Float, *object.BigInt:
+		return true
+	}
+	return false
+}
+
+// evalNumberBinaryExpression promotes both operands to the wider of their
+// types. Integers are widened to big integers, and any integer to a float.
+func (vm *VirtualMachine) evalNumberBinaryExpression(op string, left, right object.Object) object.Object {
+	switch {
+	case object.ObjectIs(left, object.FloatObj) || object.ObjectIs(right, object.FloatObj):
+		return vm.evalFloatBinaryExpression(op, numberToFloat(left), numberToFloat(right))
+	case object.ObjectIs(left, object.BigIntObj) || object.ObjectIs(right, object.BigIntObj):
+		return vm.evalBigIntBinaryExpression(op, numberToBigInt(left), numberToBigInt(right))
+	}
+	return vm.evalIntegerBinaryExpression(op, left.(*object.Integer).Value, right.(*object.Integer).Value)
+}
 
+func numberToFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	}
+	return obj.(*object.Float).Value
+}
+
+func numberToBigInt(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*object.BigInt).Value
+}
+
+// evalIntegerBinaryExpression calculates integer operations. Results that
+// overflow an int64 are recalculated as big integers.
+func (vm *VirtualMachine) evalIntegerBinaryExpression(op string, leftVal, rightVal int64) object.Object {
 	switch op {
 	case "+":
-		return object.MakeIntObj(leftVal + rightVal)
+		res := leftVal + rightVal
+		if (leftVal > 0 && rightVal > 0 && res < 0) || (leftVal < 0 && rightVal < 0 && res >= 0) {
+			break
+		}
+		return object.MakeIntObj(res)
 	case "-":
-		return object.MakeIntObj(leftVal - rightVal)
+		res := leftVal - rightVal
+		if (leftVal >= 0 && rightVal < 0 && res < 0) || (leftVal < 0 && rightVal > 0 && res >= 0) {
+			break
+		}
+		return object.MakeIntObj(res)
 	case "*":
-		return object.MakeIntObj(leftVal * rightVal)
+		if res, ok := mulInt64(leftVal, rightVal); ok {
+			return object.MakeIntObj(res)
+		}
 	case "/":
+		if rightVal == 0 {
+			return newArithmeticError("Division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			break
+		}
 		return object.MakeIntObj(leftVal / rightVal)
 	case "%":
+		if rightVal == 0 {
+			return newArithmeticError("Division by zero")
+		}
 		return object.MakeIntObj(leftVal % rightVal)
+	case "**":
+		if rightVal < 0 {
+			return object.MakeFloatObj(math.Pow(float64(leftVal), float64(rightVal)))
+		}
+		if res, ok := powInt64(leftVal, rightVal); ok {
+			return object.MakeIntObj(res)
+		}
 	case "<<":
 		if rightVal < 0 {
-			return object.NewException("Shift value must be non-negative")
+			return newArithmeticError("Shift value must be non-negative")
+		}
+		if rightVal < 63 && (leftVal<<uint64(rightVal))>>uint64(rightVal) == leftVal {
+			return object.MakeIntObj(leftVal << uint64(rightVal))
 		}
-		return object.MakeIntObj(leftVal << uint64(rightVal))
 	case ">>":
 		if rightVal < 0 {
-			return object.NewException("Shift value must be non-negative")
+			return newArithmeticError("Shift value must be non-negative")
 		}
 		return object.MakeIntObj(leftVal >> uint64(rightVal))
 	case "&":
@@ -56,15 +126,106 @@ func (vm *VirtualMachine) evalIntegerBinaryExpression(op string, left, right obj
 		return object.MakeIntObj(leftVal | rightVal)
 	case "^":
 		return object.MakeIntObj(leftVal ^ rightVal)
+	default:
+		return object.NewException("unknown operator: %s %s %s", object.IntergerObj, op, object.IntergerObj)
 	}
 
-	return object.NewException("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	return vm.evalBigIntBinaryExpression(op, big.NewInt(leftVal), big.NewInt(rightVal))
 }
 
-func (vm *VirtualMachine) evalFloatBinaryExpression(op string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Float).Value
-	rightVal := right.(*object.Float).Value
+// mulInt64 multiplies two integers, ok is false if the result overflows.
+func mulInt64(a, b int64) (res int64, ok bool) {
+	res = a * b
+	if a != 0 && (res/a != b || (a == -1 && b == math.MinInt64)) {
+		return 0, false
+	}
+	return res, true
+}
 
+// powInt64 raises base to a non-negative exp by squaring, ok is false if the
+// result overflows.
+func powInt64(base, exp int64) (int64, bool) {
+	res := int64(1)
+	for {
+		var ok bool
+		if exp&1 == 1 {
+			if res, ok = mulInt64(res, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp == 0 {
+			return res, true
+		}
+		if base, ok = mulInt64(base, base); !ok {
+			return 0, false
+		}
+	}
+}
+
+func (vm *VirtualMachine) evalBigIntBinaryExpression(op string, leftVal, rightVal *big.Int) object.Object {
+	res := new(big.Int)
+
+	switch op {
+	case "+":
+		res.Add(leftVal, rightVal)
+	case "-":
+		res.Sub(leftVal, rightVal)
+	case "*":
+		res.Mul(leftVal, rightVal)
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newArithmeticError("Division by zero")
+		}
+		res.Quo(leftVal, rightVal)
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newArithmeticError("Division by zero")
+		}
+		res.Rem(leftVal, rightVal)
+	case "**":
+		if rightVal.Sign() < 0 {
+			return object.MakeFloatObj(math.Pow(numberToFloat(&object.BigInt{Value: leftVal}), numberToFloat(&object.BigInt{Value: rightVal})))
+		}
+		// Powers of 0, 1 and -1 don't grow so any exponent can be used
+		if leftVal.CmpAbs(big.NewInt(1)) <= 0 {
+			if rightVal.Sign() == 0 || (leftVal.Sign() < 0 && rightVal.Bit(0) == 0) {
+				return object.MakeIntObj(1)
+			}
+			return object.MakeBigIntObj(leftVal)
+		}
+		if !rightVal.IsUint64() || rightVal.Uint64() > math.MaxUint32 {
+			return newArithmeticError("Exponent too large")
+		}
+		res.Exp(leftVal, rightVal, nil)
+	case "<<", ">>":
+		if rightVal.Sign() < 0 {
+			return newArithmeticError("Shift value must be non-negative")
+		}
+		if !rightVal.IsUint64() || rightVal.Uint64() > math.MaxUint32 {
+			return newArithmeticError("Shift value too large")
+		}
+		if op == "<<" {
+			res.Lsh(leftVal, uint(rightVal.Uint64()))
+		} else {
+			res.Rsh(leftVal, uint(rightVal.Uint64()))
+		}
+	case "&":
+		res.And(leftVal, rightVal)
+	case "&^":
+		res.AndNot(leftVal, rightVal)
+	case "|":
+		res.Or(leftVal, rightVal)
+	case "^":
+		res.Xor(leftVal, rightVal)
+	default:
+		return object.NewException("unknown operator: %s %s %s", object.BigIntObj, op, object.BigIntObj)
+	}
+
+	return object.MakeBigIntObj(res)
+}
+
+func (vm *VirtualMachine) evalFloatBinaryExpression(op string, leftVal, rightVal float64) object.Object {
 	switch op {
 	case "+":
 		return &object.Float{Value: leftVal + rightVal}
@@ -73,12 +234,36 @@ func (vm *VirtualMachine) evalFloatBinaryExpression(op string, left, right objec
 	case "*":
 		return &object.Float{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newArithmeticError("Division by zero")
+		}
 		return &object.Float{Value: leftVal / rightVal}
 	case "%":
+		if rightVal == 0 {
+			return newArithmeticError("Division by zero")
+		}
 		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
 	}
 
-	return object.NewException("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	return object.NewException("unknown operator: %s %s %s", object.FloatObj, op, object.FloatObj)
+}
+
+func (vm *VirtualMachine) evalNegation(val object.Object) object.Object {
+	switch val := val.(type) {
+	case *object.Integer:
+		if val.Value == math.MinInt64 {
+			return object.MakeBigIntObj(new(big.Int).Neg(big.NewInt(val.Value)))
+		}
+		return object.MakeIntObj(-val.Value)
+	case *object.Float:
+		return object.MakeFloatObj(-val.Value)
+	case *object.BigInt:
+		return object.MakeBigIntObj(new(big.Int).Neg(val.Value))
+	}
+
+	return object.NewException("unknown operator: -%s", val.Type())
 }
 
 func (vm *VirtualMachine) evalStringBinaryExpression(op string, left, right object.Object) object.Object {
@@ -86,7 +271,10 @@ func (vm *VirtualMachine) evalStringBinaryExpression(op string, left, right obje
 	rightVal := right.(*object.String).Value
 
 	if op == "+" {
-		return &object.String{Value: append(leftVal, rightVal...)}
+		// Copy into a new slice so strings sharing leftVal's backing array aren't changed
+		val := make([]rune, 0, len(leftVal)+len(rightVal))
+		val = append(val, leftVal...)
+		return &object.String{Value: append(val, rightVal...)}
 	}
 
 	return object.NewException("unknown operator: %s %s %s", left.Type(), op, right.Type())
@@ -11,11 +11,15 @@ import (
 )
 
 var (
-	builtins      = map[string]*object.Builtin{}
-	modules       = map[string]*object.Module{}
-	nativeFn      = map[string]*object.Builtin{}
-	nativeMethods = map[string]*BuiltinMethod{}
-	identRegex    = regexp.MustCompile(`[a-zA-Z_][a-zA-Z0-9_]*`)
+	builtins       = map[string]*object.Builtin{}
+	modules        = map[string]*object.Module{}
+	nativeFn       = map[string]*object.Builtin{}
+	nativeMethods  = map[string]*BuiltinMethod{}
+	builtinClasses = map[string]*VMClass{
+		exceptionClass.Name:       exceptionClass,
+		arithmeticErrorClass.Name: arithmeticErrorClass,
+	}
+	identRegex = regexp.MustCompile(`[a-zA-Z_][a-zA-Z0-9_]*`)
 )
 
 // RegisterBuiltin allows other packages to register functions for availability in user code
@@ -76,6 +80,9 @@ func getBuiltin(name string) object.Object {
 	if builtin, defined := builtins[name]; defined {
 		return builtin
 	}
+	if class, defined := builtinClasses[name]; defined {
+		return class
+	}
 	return nil
 }
 
@@ -90,9 +97,12 @@ func GetModule(name string) *object.Module {
 type VMFunction struct {
 	Name       string
 	Parameters []string
+	Defaults   []*compiler.CodeBlock // Default values of parameters, nil entries are required
+	Rest       string                // Name of the rest parameter, empty if there isn't one
 	Native     bool
 	Body       *compiler.CodeBlock
 	Env        *object.Environment
+	Upvalues   []*object.Cell // Captured variables, see compiler.Upvalue
 	Class      *VMClass
 }
 
@@ -104,6 +114,12 @@ func (f *VMFunction) Inspect() string {
 	out.WriteString(f.Name)
 	out.WriteByte('(')
 	out.WriteString(strings.Join(f.Parameters, ", "))
+	if f.Rest != "" {
+		if len(f.Parameters) > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString("..." + f.Rest)
+	}
 	out.WriteString(") {...}")
 
 	return out.String()
@@ -117,6 +133,14 @@ type VMClass struct {
 	Parent  *VMClass
 	Fields  *compiler.CodeBlock
 	Methods map[string]object.ClassMethod
+	Getters map[string]object.ClassMethod
+	Setters map[string]object.ClassMethod
+	Statics *object.Environment // Static fields and methods, nil if the class has none
+	Private map[string]bool
+	Traits  []*VMTrait
+
+	code    map[*compiler.CodeBlock]bool // Code of the class that can use its private members
+	version *uint64                      // Changes when a method is set, see SetMethod
 }
 
 func (c *VMClass) Inspect() string {
@@ -131,6 +155,36 @@ func (c *VMClass) GetMethod(name string) object.ClassMethod {
 	}
 	return c.Parent.GetMethod(name)
 }
+func (c *VMClass) GetGetter(name string) object.ClassMethod {
+	for ; c != nil; c = c.Parent {
+		if m, ok := c.Getters[name]; ok {
+			return m
+		}
+	}
+	return nil
+}
+func (c *VMClass) GetSetter(name string) object.ClassMethod {
+	for ; c != nil; c = c.Parent {
+		if m, ok := c.Setters[name]; ok {
+			return m
+		}
+	}
+	return nil
+}
+
+// GetStatic returns the value of a static member and the environment it's
+// defined in. Static members are inherited from parent classes.
+func (c *VMClass) GetStatic(name string) (object.Object, *object.Environment) {
+	for ; c != nil; c = c.Parent {
+		if c.Statics == nil {
+			continue
+		}
+		if val, ok := c.Statics.GetLocal(name); ok {
+			return val, c.Statics
+		}
+	}
+	return nil, nil
+}
 
 type BuiltinClass struct {
 	*VMClass
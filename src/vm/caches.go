@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"sync/atomic"
+
+	"github.com/nitrogen-lang/nitrogen/src/object"
+)
+
+type attrKind byte
+
+const (
+	attrField attrKind = iota
+	attrMethod
+	attrGetter
+	attrSetter
+)
+
+// builtinVersion is the version of classes made by Go code and their
+// subclasses, see VMClass.versionCounter.
+var builtinVersion uint64
+
+// attrCache is the inline cache of an attribute instruction. It remembers
+// which member the attribute was on the class of the last instance the
+// instruction was used with, so the class chain isn't searched again. The
+// caches of a code block are shared by every VM running it, a filled cache is
+// never changed and a new one replaces it instead.
+type attrCache struct {
+	class   *VMClass
+	counter *uint64 // Version counter of the class
+	version uint64  // Value of counter when the cache was filled
+	kind    attrKind
+	member  object.ClassMethod // Method or accessor, nil for fields
+}
+
+// lookupCache returns the cache in slot if it was filled for class and the
+// class hasn't changed since.
+func lookupCache(slot *atomic.Value, class *VMClass) *attrCache {
+	cache, _ := slot.Load().(*attrCache)
+	if cache != nil && cache.class == class && cache.version == *cache.counter {
+		return cache
+	}
+	return nil
+}
+
+func fillCache(slot *atomic.Value, class *VMClass, kind attrKind, member object.ClassMethod) *attrCache {
+	counter := class.versionCounter()
+	cache := &attrCache{
+		class:   class,
+		counter: counter,
+		version: *counter,
+		kind:    kind,
+		member:  member,
+	}
+	slot.Store(cache)
+	return cache
+}
+
+// SetMethod adds or replaces a method of the class. Inline caches filled
+// before the change, for the class or its children, aren't used again.
+func (c *VMClass) SetMethod(name string, method object.ClassMethod) {
+	c.Methods[name] = method
+	*c.versionCounter()++
+}
+
+// versionCounter returns the version of the class. A class shares it with its
+// parent so changing a class changes the version of its subclasses. Classes
+// made by Go code don't have their own.
+func (c *VMClass) versionCounter() *uint64 {
+	if c.version == nil {
+		return &builtinVersion
+	}
+	return c.version
+}
@@ -0,0 +1,87 @@
+package vm
+
+import "github.com/nitrogen-lang/nitrogen/src/object"
+
+// runDeferred calls the deferred functions of the current frame, the last one
+// deferred first. Every function is called even if an earlier one threw, the
+// last exception thrown is returned.
+func (vm *VirtualMachine) runDeferred() (exc *object.Exception) {
+	frame := vm.currentFrame
+	for len(frame.deferred) > 0 {
+		fn := frame.deferred[len(frame.deferred)-1]
+		frame.deferred = frame.deferred[:len(frame.deferred)-1]
+		if e := vm.callDeferred(frame, fn); e != nil {
+			exc = e
+		}
+	}
+	return exc
+}
+
+// callDeferred calls fn and returns the exception it threw, if any.
+func (vm *VirtualMachine) callDeferred(frame *Frame, fn object.Object) (exc *object.Exception) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		obj, ok := r.(object.Object)
+		if !ok {
+			panic(r)
+		}
+		exc = wrapException(obj)
+		if !exc.Catchable {
+			panic(r)
+		}
+		vm.currentFrame = frame
+	}()
+
+	vm.callFunction(nil, nil, fn, true, nil, false)
+	frame.popStack()
+	return nil
+}
+
+// throwDeferred runs the deferred functions of a returning frame. If one of
+// them threw, the exception is thrown to the frame's caller instead of
+// returning and true is returned.
+func (vm *VirtualMachine) throwDeferred() bool {
+	exc := vm.runDeferred()
+	if exc == nil {
+		return false
+	}
+
+	vm.currentFrame.bp = 0 // Try blocks of the returning function don't apply
+	vm.currentFrame.pushStack(exc)
+	vm.throw()
+	return true
+}
+
+// enterWith calls the _enter method of the value of a with statement. The
+// value itself is used if it doesn't have one. Values without an _exit method
+// can't be used.
+func (vm *VirtualMachine) enterWith(manager object.Object) object.Object {
+	instance, ok := manager.(*VMInstance)
+	if !ok || instance.GetBoundMethod("_exit") == nil {
+		return object.NewException("with expected an instance with an _exit method, got %s", manager.Type())
+	}
+
+	if res, ok := vm.callMagicMethod(instance, "_enter"); ok {
+		return res
+	}
+	return instance
+}
+
+// exitWith calls the _exit method of the value of a with statement. action is
+// what left the with block, _exit is given the exception if it was one or nil.
+func (vm *VirtualMachine) exitWith(manager, action object.Object) object.Object {
+	var exc object.Object = object.NullConst
+	if action, ok := action.(*object.Exception); ok {
+		exc = action
+	}
+
+	res, _ := vm.callMagicMethod(manager.(*VMInstance), "_exit", exc)
+	if object.ObjectIs(res, object.ExceptionObj) {
+		return res
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package vm
 
 import (
+	"strings"
+
 	"github.com/nitrogen-lang/nitrogen/src/object"
 	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
 )
@@ -49,8 +51,8 @@ func (vm *VirtualMachine) evalImplementsExpression(left, right object.Object) ob
 		}
 	case *VMClass:
 		for _, method := range iface.Methods {
-			m, exists := node.Methods[method.Name]
-			if !exists {
+			m := node.GetMethod(method.Name)
+			if m == nil {
 				return object.FalseConst
 			}
 
@@ -72,10 +74,9 @@ func (vm *VirtualMachine) evalImplementsExpression(left, right object.Object) ob
 			}
 		}
 	case *VMInstance:
-		class := node.Class
 		for _, method := range iface.Methods {
-			m, exists := class.Methods[method.Name]
-			if !exists {
+			m := node.GetMethod(method.Name)
+			if m == nil {
 				return object.FalseConst
 			}
 
@@ -126,28 +127,118 @@ func (vm *VirtualMachine) evalImplementsExpression(left, right object.Object) ob
 }
 
 func (vm *VirtualMachine) compareObjects(left, right object.Object, op byte) object.Object {
+	if op == opcode.CmpIn || op == opcode.CmpNotIn {
+		res := vm.evalInExpression(left, right)
+		if b, ok := res.(*object.Boolean); ok && op == opcode.CmpNotIn {
+			return object.NativeBoolToBooleanObj(!b.Value)
+		}
+		return res
+	}
+
+	if instance, ok := left.(*VMInstance); ok {
+		if res, ok := vm.compareInstance(instance, right, op); ok {
+			return res
+		}
+	}
+
 	switch {
+	case isNumber(left) && isNumber(right):
+		return vm.evalNumberInfixExpression(op, left, right)
 	case left.Type() != right.Type():
-		return object.FalseConst
-	case object.ObjectsAre(object.IntergerObj, left, right):
-		return vm.evalIntegerInfixExpression(op, left, right)
-	case object.ObjectsAre(object.FloatObj, left, right):
-		return vm.evalFloatInfixExpression(op, left, right)
+		// Values of different types are never equal or ordered
+		return object.NativeBoolToBooleanObj(op == opcode.CmpNotEq)
 	case object.ObjectsAre(object.StringObj, left, right):
 		return vm.evalStringInfixExpression(op, left, right)
 	case object.ObjectsAre(object.BooleanObj, left, right):
 		return vm.evalBoolInfixExpression(op, left, right)
 	case object.ObjectsAre(object.NullObj, left, right):
 		return vm.evalNullInfixExpression(op)
+	case object.ObjectsAre(object.EnumMemberObj, left, right):
+		return vm.compareEnumMembers(op, left.(*object.EnumMember), right.(*object.EnumMember))
 	}
 
 	return object.NewException("comparison not implemented for type %s", left.Type())
 }
 
-func (vm *VirtualMachine) evalIntegerInfixExpression(op byte, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+// evalInExpression checks if coll contains needle. Maps check for a key,
+// strings for a substring, arrays for an equal element, and instances call
+// their _contains method.
+func (vm *VirtualMachine) evalInExpression(needle, coll object.Object) object.Object {
+	switch coll := coll.(type) {
+	case *VMInstance:
+		if res, ok := vm.callCompareMethod(coll, "_contains", needle); ok {
+			return res
+		}
+		return object.NewException("Class %s doesn't define _contains", coll.Class.Name)
+
+	case *object.Hash:
+		key, ok := vm.HashKey(needle)
+		if !ok {
+			return object.NewException("Invalid map key: %s", needle.Type())
+		}
+		_, exists := coll.Pairs[key]
+		return object.NativeBoolToBooleanObj(exists)
+
+	case *object.String:
+		substr, ok := needle.(*object.String)
+		if !ok {
+			return object.NewException("Left side of in must be a string, got %s", needle.Type())
+		}
+		return object.NativeBoolToBooleanObj(strings.Contains(coll.String(), substr.String()))
+
+	case *object.Array:
+		for _, el := range coll.Elements {
+			res := vm.compareObjects(needle, el, opcode.CmpEq)
+			if res != object.FalseConst {
+				return res
+			}
+		}
+		return object.FalseConst
+
+	case *object.Range:
+		n, ok := needle.(*object.Integer)
+		return object.NativeBoolToBooleanObj(ok && coll.Contains(n.Value))
+
+	case *object.Enum:
+		member, ok := needle.(*object.EnumMember)
+		return object.NativeBoolToBooleanObj(ok && member.Enum == coll)
+	}
+
+	return object.NewException("Membership test not allowed on type %s", coll.Type())
+}
+
+// evalNumberInfixExpression compares numbers by value regardless of their type.
+func (vm *VirtualMachine) evalNumberInfixExpression(op byte, left, right object.Object) object.Object {
+	switch {
+	case object.ObjectIs(left, object.FloatObj) || object.ObjectIs(right, object.FloatObj):
+		return vm.evalFloatInfixExpression(op, numberToFloat(left), numberToFloat(right))
+	case object.ObjectIs(left, object.BigIntObj) || object.ObjectIs(right, object.BigIntObj):
+		return compareResult(op, numberToBigInt(left).Cmp(numberToBigInt(right)))
+	}
+	return vm.evalIntegerInfixExpression(op, left.(*object.Integer).Value, right.(*object.Integer).Value)
+}
+
+// compareResult converts the result of a three way comparison into a boolean for op.
+func compareResult(op byte, cmp int) object.Object {
+	switch op {
+	case opcode.CmpLT:
+		return object.NativeBoolToBooleanObj(cmp < 0)
+	case opcode.CmpGT:
+		return object.NativeBoolToBooleanObj(cmp > 0)
+	case opcode.CmpEq:
+		return object.NativeBoolToBooleanObj(cmp == 0)
+	case opcode.CmpNotEq:
+		return object.NativeBoolToBooleanObj(cmp != 0)
+	case opcode.CmpLTEq:
+		return object.NativeBoolToBooleanObj(cmp <= 0)
+	case opcode.CmpGTEq:
+		return object.NativeBoolToBooleanObj(cmp >= 0)
+	}
 
+	return object.NewException("unknown operator: %s %s %s", object.BigIntObj, opcode.CmpOps[op], object.BigIntObj)
+}
+
+func (vm *VirtualMachine) evalIntegerInfixExpression(op byte, leftVal, rightVal int64) object.Object {
 	switch op {
 	case opcode.CmpLT:
 		return object.NativeBoolToBooleanObj(leftVal < rightVal)
@@ -163,13 +254,10 @@ func (vm *VirtualMachine) evalIntegerInfixExpression(op byte, left, right object
 		return object.NativeBoolToBooleanObj(leftVal >= rightVal)
 	}
 
-	return object.NewException("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	return object.NewException("unknown operator: %s %s %s", object.IntergerObj, opcode.CmpOps[op], object.IntergerObj)
 }
 
-func (vm *VirtualMachine) evalFloatInfixExpression(op byte, left, right object.Object) object.Object {
-	leftVal := left.(*object.Float).Value
-	rightVal := right.(*object.Float).Value
-
+func (vm *VirtualMachine) evalFloatInfixExpression(op byte, leftVal, rightVal float64) object.Object {
 	switch op {
 	case opcode.CmpLT:
 		return object.NativeBoolToBooleanObj(leftVal < rightVal)
@@ -185,7 +273,7 @@ func (vm *VirtualMachine) evalFloatInfixExpression(op byte, left, right object.O
 		return object.NativeBoolToBooleanObj(leftVal >= rightVal)
 	}
 
-	return object.NewException("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	return object.NewException("unknown operator: %s %s %s", object.FloatObj, opcode.CmpOps[op], object.FloatObj)
 }
 
 func (vm *VirtualMachine) evalStringInfixExpression(op byte, left, right object.Object) object.Object {
@@ -207,7 +295,7 @@ func (vm *VirtualMachine) evalStringInfixExpression(op byte, left, right object.
 		return object.NativeBoolToBooleanObj(leftVal <= rightVal)
 	}
 
-	return object.NewException("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	return object.NewException("unknown operator: %s %s %s", left.Type(), opcode.CmpOps[op], right.Type())
 }
 
 func (vm *VirtualMachine) evalBoolInfixExpression(op byte, left, right object.Object) object.Object {
@@ -221,7 +309,7 @@ func (vm *VirtualMachine) evalBoolInfixExpression(op byte, left, right object.Ob
 		return object.NativeBoolToBooleanObj(leftVal != rightVal)
 	}
 
-	return object.NewException("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	return object.NewException("unknown operator: %s %s %s", left.Type(), opcode.CmpOps[op], right.Type())
 }
 
 func (vm *VirtualMachine) evalNullInfixExpression(op byte) object.Object {
@@ -232,5 +320,5 @@ func (vm *VirtualMachine) evalNullInfixExpression(op byte) object.Object {
 		return object.FalseConst
 	}
 
-	return object.NewException("unknown operator: nil %s nil", op)
+	return object.NewException("unknown operator: nil %s nil", opcode.CmpOps[op])
 }
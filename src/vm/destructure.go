@@ -0,0 +1,46 @@
+package vm
+
+import "github.com/nitrogen-lang/nitrogen/src/object"
+
+// checkLength makes sure a destructured value is an array of exactly n elements.
+func checkLength(val object.Object, n int) object.Object {
+	arr, ok := val.(*object.Array)
+	if !ok {
+		return object.NewException("Destructuring expected an array, got %s", val.Type())
+	}
+	if len(arr.Elements) != n {
+		return object.NewException("Destructuring expected %d elements, got %d", n, len(arr.Elements))
+	}
+	return arr
+}
+
+// loadRest returns the elements of a destructured array after the first n
+// which must exist.
+func loadRest(val object.Object, n int) object.Object {
+	arr, ok := val.(*object.Array)
+	if !ok {
+		return object.NewException("Destructuring expected an array, got %s", val.Type())
+	}
+	if len(arr.Elements) < n {
+		return object.NewException("Destructuring expected at least %d elements, got %d", n, len(arr.Elements))
+	}
+
+	rest := make([]object.Object, len(arr.Elements)-n)
+	copy(rest, arr.Elements[n:])
+	return &object.Array{Elements: rest}
+}
+
+// checkKeys makes sure a destructured value is a map with all the given keys.
+func checkKeys(val object.Object, keys []object.Object) object.Object {
+	hash, ok := val.(*object.Hash)
+	if !ok {
+		return object.NewException("Destructuring expected a map, got %s", val.Type())
+	}
+
+	for _, key := range keys {
+		if _, exists := hash.Pairs[key.(object.Hashable).HashKey()]; !exists {
+			return object.NewException("Destructuring missing key %s", key.Inspect())
+		}
+	}
+	return hash
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"github.com/nitrogen-lang/nitrogen/src/object"
+	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
+)
+
+// lookupEnumAttr returns a member of an enum, or the name or an associated
+// value of an enum member.
+func lookupEnumAttr(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Enum:
+		if member := obj.Member(name); member != nil {
+			return member
+		}
+		return object.NewException("Enum %s has no member %s", obj.Name, name)
+	case *object.EnumMember:
+		if val, ok := obj.Value(name); ok {
+			return val
+		}
+		if name == "name" {
+			return object.MakeStringObj(obj.Name)
+		}
+		return object.NewException("%s has no field %s", obj.Inspect(), name)
+	}
+	return object.NullConst
+}
+
+// enumMembers returns the members of an enum in declaration order.
+func enumMembers(enum *object.Enum) *object.Array {
+	members := make([]object.Object, len(enum.Members))
+	for i, member := range enum.Members {
+		members[i] = member
+	}
+	return &object.Array{Elements: members}
+}
+
+// makeEnumValue creates a value of an enum member from its associated values.
+// Values can be given by position or by field name.
+func makeEnumValue(member *object.EnumMember, args []object.Object, kwargs *object.Hash) object.Object {
+	if member.Fields == nil {
+		return object.NewException("%s doesn't carry any values", member.Inspect())
+	}
+	if len(args) > len(member.Fields) {
+		return object.NewException("%s takes %d values, got %d", member.Inspect(), len(member.Fields), len(args))
+	}
+
+	values := make([]object.Object, len(member.Fields))
+	copy(values, args)
+
+	if kwargs != nil {
+		for _, pair := range kwargs.Pairs {
+			name := pair.Key.(*object.String).String()
+			found := false
+			for i, field := range member.Fields {
+				if field == name {
+					values[i] = pair.Value
+					found = true
+					break
+				}
+			}
+			if !found {
+				return object.NewException("%s has no field %s", member.Inspect(), name)
+			}
+		}
+	}
+
+	for i, val := range values {
+		if val == nil {
+			return object.NewException("%s is missing the value for %s", member.Inspect(), member.Fields[i])
+		}
+	}
+	return member.WithValues(values)
+}
+
+// compareEnumMembers compares members of the same enum by their declaration
+// order. Members are equal if they're the same member with equal values.
+func (vm *VirtualMachine) compareEnumMembers(op byte, left, right *object.EnumMember) object.Object {
+	if op != opcode.CmpEq && op != opcode.CmpNotEq {
+		if left.Enum != right.Enum {
+			return object.NewException("Can't compare members of enums %s and %s", left.Enum.Name, right.Enum.Name)
+		}
+		return compareResult(op, left.Index-right.Index)
+	}
+
+	equal := left.Is(right) && len(left.Values) == len(right.Values)
+	for i := 0; equal && i < len(left.Values); i++ {
+		res := vm.compareObjects(left.Values[i], right.Values[i], opcode.CmpEq)
+		if object.ObjectIs(res, object.ExceptionObj) {
+			return res
+		}
+		equal = res == object.TrueConst
+	}
+	return object.NativeBoolToBooleanObj(equal == (op == opcode.CmpEq))
+}
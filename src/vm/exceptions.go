@@ -0,0 +1,171 @@
+package vm
+
+import (
+	"github.com/nitrogen-lang/nitrogen/src/object"
+)
+
+// exceptionClass is the base class for user defined exceptions. Throwing an
+// instance of a class uses its message and cause fields to build the exception.
+var exceptionClass = &VMClass{
+	Name: object.DefaultExceptionKind,
+	Methods: map[string]object.ClassMethod{
+		"init": MakeBuiltinMethod(exceptionInit, 2),
+	},
+}
+
+// arithmeticErrorClass is the kind of exceptions thrown by invalid arithmetic
+// such as dividing by zero.
+var arithmeticErrorClass = &VMClass{
+	Name:    "ArithmeticError",
+	Parent:  exceptionClass,
+	Methods: map[string]object.ClassMethod{},
+}
+
+func newArithmeticError(format string, a ...interface{}) *object.Exception {
+	exc := object.NewException(format, a...)
+	exc.Kind = arithmeticErrorClass.Name
+	return exc
+}
+
+func exceptionInit(interpreter *VirtualMachine, self *VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	message, cause := object.Object(object.MakeStringObj("")), object.Object(object.NullConst)
+	if len(args) > 0 {
+		message = args[0]
+	}
+	if len(args) > 1 {
+		cause = args[1]
+	}
+
+	env.SetForce("message", message, false)
+	env.SetForce("cause", cause, false)
+	return object.NullConst
+}
+
+// wrapException converts a thrown value into an exception object. Exceptions
+// are returned as is, instances use their class name as the kind.
+func wrapException(val object.Object) *object.Exception {
+	switch val := val.(type) {
+	case *object.Exception:
+		return val
+	case *VMInstance:
+		exc := object.NewException("%s", val.Inspect())
+		exc.Kind = val.Class.Name
+		exc.Value = val
+
+		if message, ok := val.Fields.Get("message"); ok && message != object.NullConst {
+			exc.Message = message.Inspect()
+		}
+		if cause, ok := val.Fields.Get("cause"); ok && cause != object.NullConst {
+			exc.Cause = wrapException(cause)
+		}
+		return exc
+	}
+
+	exc := object.NewException("%s", val.Inspect())
+	exc.Value = val
+	return exc
+}
+
+// captureStackTrace records the location and call frames of where an exception
+// was first thrown. Rethrown exceptions keep their original trace.
+func (vm *VirtualMachine) captureStackTrace(exc *object.Exception) {
+	if exc.HasStackTrace || vm.currentFrame == nil {
+		return
+	}
+
+	exc.Filename = vm.currentFrame.code.Filename
+	exc.Line, exc.Col = vm.currentFrame.position()
+
+	for frame := vm.currentFrame; frame != nil; frame = frame.lastFrame {
+		line, col := frame.position()
+		exc.Frames = append(exc.Frames, object.StackFrame{
+			Filename: frame.code.Filename,
+			Name:     frame.code.Name,
+			Line:     line,
+			Col:      col,
+		})
+	}
+	exc.HasStackTrace = true
+}
+
+func (vm *VirtualMachine) lookupExceptionAttr(exc *object.Exception, name string) object.Object {
+	switch name {
+	case "kind":
+		return object.MakeStringObj(exc.Kind)
+	case "message":
+		return object.MakeStringObj(exc.Message)
+	case "file":
+		return object.MakeStringObj(exc.Filename)
+	case "line":
+		return object.MakeIntObj(int64(exc.Line))
+	case "column":
+		return object.MakeIntObj(int64(exc.Col))
+	case "frames":
+		frames := &object.Array{Elements: make([]object.Object, len(exc.Frames))}
+		for i, frame := range exc.Frames {
+			hash := object.MakeEmptyHash()
+			hash.SetKey("file", object.MakeStringObj(frame.Filename))
+			hash.SetKey("name", object.MakeStringObj(frame.Name))
+			hash.SetKey("line", object.MakeIntObj(int64(frame.Line)))
+			hash.SetKey("column", object.MakeIntObj(int64(frame.Col)))
+			frames.Elements[i] = hash
+		}
+		return frames
+	case "cause":
+		if exc.Cause == nil {
+			return object.NullConst
+		}
+		return exc.Cause
+	case "value":
+		if exc.Value == nil {
+			return object.NullConst
+		}
+		return exc.Value
+	}
+
+	// Other attributes come from the thrown instance
+	if instance, ok := exc.Value.(*VMInstance); ok {
+		if method := instance.GetBoundMethod(name); method != nil {
+			return method
+		}
+		if val, ok := instance.Fields.Get(name); ok {
+			return val
+		}
+	}
+	return object.NullConst
+}
+
+// matchException checks if an exception is caught by a typed catch clause.
+// Classes match the thrown instance or any of its parents, interfaces match
+// thrown instances that implement them.
+func (vm *VirtualMachine) matchException(val, class object.Object) object.Object {
+	exc := wrapException(val)
+
+	switch class := class.(type) {
+	case *VMClass:
+		return object.NativeBoolToBooleanObj(exceptionIsA(exc, class.Name))
+	case *BuiltinClass:
+		return object.NativeBoolToBooleanObj(exceptionIsA(exc, class.Name))
+	case *object.Interface:
+		if instance, ok := exc.Value.(*VMInstance); ok {
+			return vm.evalImplementsExpression(instance, class)
+		}
+		return object.FalseConst
+	}
+
+	return object.NewException("catch clause expected a class or interface, got %s", class.Type())
+}
+
+func exceptionIsA(exc *object.Exception, class string) bool {
+	if instance, ok := exc.Value.(*VMInstance); ok {
+		return InstanceOf(class, instance)
+	}
+
+	// Runtime exceptions match the builtin class of their kind and its parents
+	for c := builtinClasses[exc.Kind]; c != nil; c = c.Parent {
+		if c.Name == class {
+			return true
+		}
+	}
+	return exc.Kind == class
+}
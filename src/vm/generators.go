@@ -0,0 +1,132 @@
+package vm
+
+import (
+	"github.com/nitrogen-lang/nitrogen/src/object"
+	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
+)
+
+var generatorClass = &BuiltinClass{
+	Fields: map[string]object.Object{
+		"frame": object.NullConst,
+		"i":     object.MakeIntObj(0),
+	},
+	VMClass: &VMClass{
+		Name:   "Generator",
+		Parent: nil,
+		Methods: map[string]object.ClassMethod{
+			"_iter": MakeBuiltinMethod(generatorIter, 0),
+		},
+	},
+}
+
+func init() {
+	// Added here to break the initialization cycle through the VM's run loop
+	generatorClass.SetMethod("_next", MakeBuiltinMethod(generatorNext, 0))
+	generatorClass.SetMethod("_close", MakeBuiltinMethod(generatorClose, 0))
+}
+
+// generatorFrame holds the suspended frame of a generator function between calls to _next.
+type generatorFrame struct {
+	frame   *Frame
+	running bool
+	done    bool
+}
+
+func (g *generatorFrame) Inspect() string         { return "<generator frame>" }
+func (g *generatorFrame) Type() object.ObjectType { return object.ResourceObj }
+func (g *generatorFrame) Dup() object.Object      { return object.NullConst } // Generators can't be duplicated
+
+func makeGenerator(frame *Frame) *VMInstance {
+	env := object.NewEnvironment()
+	env.SetForce("frame", &generatorFrame{frame: frame}, true)
+	env.SetForce("i", object.MakeIntObj(0), false)
+
+	return &VMInstance{
+		Class:  generatorClass.VMClass,
+		Fields: env,
+	}
+}
+
+func generatorIter(interpreter *VirtualMachine, self *VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	return self
+}
+
+// generatorNext resumes the generator's frame until it yields or returns. Yielded
+// values are returned as a [key, value] pair, nil is returned once the function is done.
+func generatorNext(interpreter *VirtualMachine, self *VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	selfFrameObj, _ := self.Fields.Get("frame")
+	selfIndexObj, _ := self.Fields.Get("i")
+
+	gen := selfFrameObj.(*generatorFrame)
+	selfIndex := selfIndexObj.(*object.Integer)
+
+	if gen.done {
+		return object.NullConst
+	}
+	if gen.running {
+		return object.NewException("Generator is already running")
+	}
+
+	gen.running = true
+	gen.frame.suspended = false
+	defer func() {
+		// An exception thrown by the generator also finishes it
+		gen.running = false
+		gen.done = !gen.frame.suspended
+	}()
+
+	val := interpreter.RunFrame(gen.frame, true)
+	if !gen.frame.suspended {
+		return object.NullConst
+	}
+
+	self.Fields.Set("i", object.MakeIntObj(selfIndex.Value+1))
+
+	return &object.Array{
+		Elements: []object.Object{
+			object.MakeIntObj(selfIndex.Value),
+			val,
+		},
+	}
+}
+
+// generatorClose finishes the generator as if it returned where it last yielded.
+// The finally blocks and deferred functions waiting in its frame are run. Loops
+// call it when they stop iterating the generator before it's done.
+func generatorClose(interpreter *VirtualMachine, self *VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	selfFrameObj, _ := self.Fields.Get("frame")
+	gen := selfFrameObj.(*generatorFrame)
+
+	if gen.done {
+		return object.NullConst
+	}
+	if gen.running {
+		return object.NewException("Generator is already running")
+	}
+	gen.done = true
+
+	caller := interpreter.currentFrame
+	interpreter.currentFrame = gen.frame
+	if !interpreter.enterFinally(finallyAction{code: opcode.Return, value: object.NullConst}) {
+		gen.frame.sp = 0
+		exc := interpreter.runDeferred()
+		interpreter.currentFrame = caller
+		if exc != nil {
+			return exc
+		}
+		return object.NullConst
+	}
+	interpreter.currentFrame = caller
+
+	// The finally block continues the return, running any outer finally
+	// blocks and the deferred functions
+	gen.running = true
+	gen.frame.suspended = false
+	defer func() { gen.running = false }()
+
+	interpreter.RunFrame(gen.frame, true)
+	if gen.frame.suspended {
+		return object.NewException("Generator yielded while it was closed")
+	}
+	return object.NullConst
+}
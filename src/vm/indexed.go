@@ -3,13 +3,25 @@ package vm
 import "github.com/nitrogen-lang/nitrogen/src/object"
 
 func (vm *VirtualMachine) evalIndexExpression(left, index object.Object) object.Object {
+	if instance, ok := left.(*VMInstance); ok {
+		if res, ok := vm.callMagicMethod(instance, "_getIndex", index); ok {
+			return res
+		}
+	}
+
 	switch {
+	case index.Type() == object.SliceObj:
+		return vm.evalSliceExpression(left, index.(*object.Slice))
 	case left.Type() == object.ArrayObj && index.Type() == object.IntergerObj:
 		return vm.evalArrayIndexExpression(left.(*object.Array), index)
 	case left.Type() == object.HashObj:
 		return vm.lookupHashIndex(left.(*object.Hash), index)
 	case left.Type() == object.StringObj && index.Type() == object.IntergerObj:
 		return vm.evalStringIndexExpression(left.(*object.String), index)
+	case left.Type() == object.RangeObj && index.Type() == object.IntergerObj:
+		return evalRangeIndexExpression(left.(*object.Range), index.(*object.Integer))
+	case left.Type() == object.EnumMemberObj && index.Type() == object.IntergerObj:
+		return vm.evalArrayIndexExpression(&object.Array{Elements: left.(*object.EnumMember).Values}, index)
 	}
 	return object.NewException("Index operator not allowed on type %s", left.Type())
 }
@@ -35,12 +47,12 @@ func (vm *VirtualMachine) evalArrayIndexExpression(array *object.Array, index ob
 }
 
 func (vm *VirtualMachine) lookupHashIndex(hash *object.Hash, index object.Object) object.Object {
-	key, ok := index.(object.Hashable)
+	key, ok := vm.HashKey(index)
 	if !ok {
 		return object.NewException("Invalid map key: %s", index.Type())
 	}
 
-	pair, ok := hash.Pairs[key.HashKey()]
+	pair, ok := hash.Pairs[key]
 	if !ok {
 		return object.NullConst
 	}
@@ -59,14 +59,17 @@ var mapIterator = &BuiltinClass{
 		"i":    object.MakeIntObj(0),
 	},
 	VMClass: &VMClass{
-		Name:   "MapIterator",
-		Parent: nil,
-		Methods: map[string]object.ClassMethod{
-			"_next": MakeBuiltinMethod(mapIteratorNext, 0),
-		},
+		Name:    "MapIterator",
+		Parent:  nil,
+		Methods: map[string]object.ClassMethod{},
 	},
 }
 
+func init() {
+	// Added here to break the initialization cycle through the VM's run loop
+	mapIterator.SetMethod("_next", MakeBuiltinMethod(mapIteratorNext, 0))
+}
+
 func mapIteratorNext(interpreter *VirtualMachine, self *VMInstance, env *object.Environment, args ...object.Object) object.Object {
 	selfMapObj, _ := self.Fields.Get("map")
 	selfKeysObj, _ := self.Fields.Get("keys")
@@ -81,8 +84,8 @@ func mapIteratorNext(interpreter *VirtualMachine, self *VMInstance, env *object.
 	}
 
 	mapKey := selfKeys.Elements[selfIndex.Value]
-	hashKey := mapKey.(object.Hashable)
-	hashVal := selfMap.Pairs[hashKey.HashKey()]
+	hashKey, _ := interpreter.HashKey(mapKey)
+	hashVal := selfMap.Pairs[hashKey]
 
 	self.Fields.Set("i", object.MakeIntObj(selfIndex.Value+1))
 
@@ -0,0 +1,114 @@
+package vm
+
+import "github.com/nitrogen-lang/nitrogen/src/object"
+
+// Local variables are read and written through the slots the compiler gave
+// them. Locals that are looked up by name, like globals, captured variables or
+// names given to isDefined in a nested function, are also declared in the
+// frame's environment, see compiler.CodeBlock.EnvLocals.
+
+// defineLocal pops the value on the stack into a new local in slot. The name
+// can't already be defined in the current scope or be a constant. The compiler
+// only leaves that check to the environment for locals where it can fail.
+func (vm *VirtualMachine) defineLocal(slot uint32, readonly bool) object.Object {
+	frame := vm.currentFrame
+	name := frame.code.Locals[slot]
+
+	if !frame.code.EnvLocals[slot] {
+		// Nothing else has the cell of a local that isn't in the environment
+		if cell := frame.locals[slot]; cell != nil {
+			cell.Redefine(frame.popStack(), readonly, frame.env)
+		} else {
+			frame.locals[slot] = object.NewCell(name, frame.popStack(), readonly, frame.env)
+		}
+		return nil
+	}
+
+	// Ensure constant isn't redefined
+	if frame.env.IsConst(name) {
+		return object.NewException("Redefined constant %s", name)
+	}
+	if _, exists := frame.env.GetLocal(name); exists {
+		return object.NewException("Variable %s already defined", name)
+	}
+
+	frame.locals[slot] = frame.env.Declare(name, frame.popStack(), readonly)
+	return nil
+}
+
+// deleteLocal removes the local in slot. A slot that was never defined holds a
+// name the compiler didn't know, it's deleted from the current scope by name.
+func (vm *VirtualMachine) deleteLocal(slot uint32) object.Object {
+	frame := vm.currentFrame
+	cell := frame.locals[slot]
+	if cell == nil {
+		name := frame.code.Locals[slot]
+		if frame.env.IsConstLocal(name) {
+			return object.NewException("Cannot delete constant %s", name)
+		}
+		frame.env.UnsetLocal(name)
+		return nil
+	}
+
+	if cell.IsConst() {
+		return object.NewException("Cannot delete constant %s", cell.Name())
+	}
+	if frame.code.EnvLocals[slot] {
+		frame.env.UnsetCell(cell)
+	}
+	frame.locals[slot] = nil
+	return nil
+}
+
+// copyScope replaces the locals of the scope enclosing the current one with
+// copies. The slots of the copied locals are moved to the new cells so closures
+// made before the copy keep the old values. Only locals in the environment can
+// be captured, locals that only live in their slot aren't copied.
+func (vm *VirtualMachine) copyScope() {
+	frame := vm.currentFrame
+	frame.env.Parent().CopyCells(func(orig, copy *object.Cell) {
+		for i, cell := range frame.locals {
+			if cell == orig {
+				frame.locals[i] = copy
+				break
+			}
+		}
+	})
+	frame.env = object.NewEnclosedEnv(frame.env.Parent())
+}
+
+// IsDefined checks if name is defined in env, or is a local of the running
+// function that's visible in env. Locals that only live in their slot aren't in
+// the environment.
+func (vm *VirtualMachine) IsDefined(env *object.Environment, name string) bool {
+	if _, ok := env.Get(name); ok {
+		return true
+	}
+
+	frame := vm.currentFrame
+	if frame == nil {
+		return false
+	}
+	for slot, cell := range frame.locals {
+		if cell != nil && !frame.code.EnvLocals[slot] && cell.Name() == name && cell.VisibleIn(env) {
+			return true
+		}
+	}
+	return false
+}
+
+// bindLocal sets a local of a new frame, used for arguments and `this`. The
+// slot is only set if it belongs to name, functions that aren't methods don't
+// have a slot for `this` and only have it in their environment.
+func (f *Frame) bindLocal(slot int, name string, val object.Object, readonly bool) {
+	if slot >= len(f.locals) || f.code.Locals[slot] != name {
+		f.env.Declare(name, val, readonly)
+		return
+	}
+
+	if f.code.EnvLocals[slot] {
+		f.locals[slot] = f.env.Declare(name, val, readonly)
+	} else {
+		f.locals[slot] = object.NewCell(name, val, readonly, f.env)
+	}
+}
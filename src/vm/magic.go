@@ -0,0 +1,130 @@
+package vm
+
+import (
+	"github.com/nitrogen-lang/nitrogen/src/object"
+	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
+)
+
+// binaryMagicMethods maps binary operators to the instance methods that implement them.
+var binaryMagicMethods = map[string]string{
+	"+":  "_add",
+	"-":  "_sub",
+	"*":  "_mul",
+	"/":  "_div",
+	"%":  "_mod",
+	"**": "_pow",
+	"<<": "_shl",
+	">>": "_shr",
+	"&":  "_and",
+	"|":  "_or",
+	"^":  "_xor",
+	"&^": "_andNot",
+}
+
+// callMagicMethod calls the method name of instance with args and returns its
+// result. It returns false if the instance's class doesn't define the method.
+func (vm *VirtualMachine) callMagicMethod(instance *VMInstance, name string, args ...object.Object) (object.Object, bool) {
+	method := instance.GetBoundMethod(name)
+	if method == nil {
+		return nil, false
+	}
+
+	// Builtin methods are called directly so an exception is returned
+	// instead of being thrown in the current frame
+	if builtin, ok := method.Method.(*BuiltinMethod); ok {
+		res := builtin.Fn(vm, instance, instance.Fields, args...)
+		if res == nil {
+			res = object.NullConst
+		}
+		return res, true
+	}
+
+	vm.callFunction(args, nil, method, true, nil, false)
+	return vm.currentFrame.popStack(), true
+}
+
+// compareInstance compares an instance using its _eq and _lt methods. The
+// other comparisons are derived from those two. Instances are never equal to
+// nil, comparing with nil doesn't call any methods.
+func (vm *VirtualMachine) compareInstance(instance *VMInstance, other object.Object, op byte) (object.Object, bool) {
+	if other == object.NullConst {
+		return object.NativeBoolToBooleanObj(op == opcode.CmpNotEq), true
+	}
+
+	switch op {
+	case opcode.CmpEq:
+		return vm.callCompareMethod(instance, "_eq", other)
+	case opcode.CmpNotEq:
+		return negateResult(vm.callCompareMethod(instance, "_eq", other))
+	case opcode.CmpLT:
+		return vm.callCompareMethod(instance, "_lt", other)
+	case opcode.CmpGTEq:
+		return negateResult(vm.callCompareMethod(instance, "_lt", other))
+	case opcode.CmpLTEq:
+		if res, ok := vm.callCompareMethod(instance, "_lt", other); !ok || res != object.FalseConst {
+			return res, ok
+		}
+		return vm.callCompareMethod(instance, "_eq", other)
+	case opcode.CmpGT:
+		if res, ok := vm.callCompareMethod(instance, "_lt", other); !ok || res != object.FalseConst {
+			return negateResult(res, ok)
+		}
+		return negateResult(vm.callCompareMethod(instance, "_eq", other))
+	}
+	return nil, false
+}
+
+// callCompareMethod calls a comparison method which must return a bool.
+func (vm *VirtualMachine) callCompareMethod(instance *VMInstance, name string, other object.Object) (object.Object, bool) {
+	res, ok := vm.callMagicMethod(instance, name, other)
+	if !ok {
+		return nil, false
+	}
+
+	switch res.(type) {
+	case *object.Boolean, *object.Exception:
+		return res, true
+	}
+	return object.NewException("%s.%s must return a bool, got %s", instance.Class.Name, name, res.Type()), true
+}
+
+func negateResult(res object.Object, ok bool) (object.Object, bool) {
+	if b, isBool := res.(*object.Boolean); isBool {
+		return object.NativeBoolToBooleanObj(!b.Value), ok
+	}
+	return res, ok
+}
+
+// HashKey returns the key obj is stored under in a map. Instances are hashed
+// with the result of their _hash method. Enum members can only be a key if all
+// their associated values can.
+func (vm *VirtualMachine) HashKey(obj object.Object) (object.HashKey, bool) {
+	if member, ok := obj.(*object.EnumMember); ok {
+		values := make([]object.HashKey, len(member.Values))
+		for i, v := range member.Values {
+			if values[i], ok = vm.HashKey(v); !ok {
+				return object.HashKey{}, false
+			}
+		}
+		return member.HashKey(values), true
+	}
+
+	if instance, ok := obj.(*VMInstance); ok {
+		res, ok := vm.callMagicMethod(instance, "_hash")
+		if !ok {
+			return object.HashKey{}, false
+		}
+
+		hashable, ok := res.(object.Hashable)
+		if !ok {
+			return object.HashKey{}, false
+		}
+		return object.HashKey{Type: object.InstanceObj, Value: hashable.HashKey().Value}, true
+	}
+
+	hashable, ok := obj.(object.Hashable)
+	if !ok {
+		return object.HashKey{}, false
+	}
+	return hashable.HashKey(), true
+}
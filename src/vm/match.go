@@ -0,0 +1,66 @@
+package vm
+
+import "github.com/nitrogen-lang/nitrogen/src/object"
+
+// isType checks a value against a builtin type pattern. Any callable value is
+// a function and big integers are ints.
+func isType(val object.Object, t object.ObjectType) bool {
+	switch t {
+	case object.FunctionObj:
+		switch val.Type() {
+		case object.FunctionObj, object.BuiltinObj, object.BoundMethodObj, object.BuiltinMethodObj:
+			return true
+		}
+		return false
+	case object.IntergerObj:
+		return val.Type() == object.IntergerObj || val.Type() == object.BigIntObj
+	}
+	return val.Type() == t
+}
+
+// isInstance checks a value against a class, interface or enum pattern. Classes
+// match instances of the class or any of its children, interfaces match
+// instances that implement them. Enums match any of their members and members
+// match themselves regardless of their associated values.
+func (vm *VirtualMachine) isInstance(val, class object.Object) object.Object {
+	instance, isInstance := val.(*VMInstance)
+
+	switch class := class.(type) {
+	case *VMClass:
+		return object.NativeBoolToBooleanObj(isInstance && InstanceOf(class.Name, instance))
+	case *BuiltinClass:
+		return object.NativeBoolToBooleanObj(isInstance && InstanceOf(class.Name, instance))
+	case *object.Interface:
+		if !isInstance {
+			return object.FalseConst
+		}
+		return vm.evalImplementsExpression(instance, class)
+	case *object.Enum:
+		member, ok := val.(*object.EnumMember)
+		return object.NativeBoolToBooleanObj(ok && member.Enum == class)
+	case *object.EnumMember:
+		member, ok := val.(*object.EnumMember)
+		return object.NativeBoolToBooleanObj(ok && member.Is(class))
+	}
+
+	return object.NewException("Match pattern expected a type, class, interface or enum, got %s", class.Type())
+}
+
+// matchLength checks if a value is an array with n elements, or at least n
+// elements if exact is false.
+func matchLength(val object.Object, n int, exact bool) bool {
+	arr, ok := val.(*object.Array)
+	if !ok {
+		return false
+	}
+	if exact {
+		return len(arr.Elements) == n
+	}
+	return len(arr.Elements) >= n
+}
+
+// matchKeys checks if a value is a map with all the given keys.
+func matchKeys(val object.Object, keys []object.Object) bool {
+	_, ok := checkKeys(val, keys).(*object.Hash)
+	return ok
+}
@@ -0,0 +1,233 @@
+package vm
+
+import (
+	"sync/atomic"
+
+	"github.com/nitrogen-lang/nitrogen/src/compiler"
+	"github.com/nitrogen-lang/nitrogen/src/object"
+)
+
+// collectClassCode records code as belonging to class along with its
+// parameter defaults and the functions defined inside it. Only code of the
+// class can use the class's private members.
+func (c *VMClass) collectClassCode(code *compiler.CodeBlock) {
+	if code == nil || c.code[code] {
+		return
+	}
+	c.code[code] = true
+
+	for _, def := range code.Defaults {
+		c.collectClassCode(def)
+	}
+	for _, constant := range code.Constants {
+		if cb, ok := constant.(*compiler.CodeBlock); ok {
+			c.collectClassCode(cb)
+		}
+	}
+}
+
+func (c *VMClass) collectMethodCode(methods map[string]object.ClassMethod) {
+	for _, method := range methods {
+		if fn, ok := method.(*VMFunction); ok {
+			c.collectClassCode(fn.Body)
+			for _, def := range fn.Defaults {
+				c.collectClassCode(def)
+			}
+		}
+	}
+}
+
+// checkAccess returns an exception if name is a private member of class, or
+// of the parent that declares it, and the running code doesn't belong to
+// that class.
+func (vm *VirtualMachine) checkAccess(class *VMClass, name string) object.Object {
+	for c := class; c != nil; c = c.Parent {
+		if !c.Private[name] {
+			continue
+		}
+		if c.code[vm.currentFrame.code] {
+			return nil
+		}
+		return object.NewException("%s.%s is private", c.Name, name)
+	}
+	return nil
+}
+
+// loadAttr pushes the value of attribute name of obj. cache is the inline
+// cache of the instruction, it's only used for instances.
+func (vm *VirtualMachine) loadAttr(obj object.Object, name string, cache *atomic.Value) {
+	switch obj := obj.(type) {
+	case *VMInstance:
+		vm.loadInstanceAttr(obj, name, cache)
+	case *VMClass:
+		if exc := vm.checkAccess(obj, name); exc != nil {
+			vm.currentFrame.pushStack(exc)
+			vm.throw()
+			return
+		}
+		if val, _ := obj.GetStatic(name); val != nil {
+			vm.currentFrame.pushStack(val)
+			return
+		}
+
+		this, exists := vm.currentFrame.env.GetLocal("this")
+		if !exists {
+			vm.currentFrame.pushStack(object.NewException("Method call outside instance"))
+			vm.throw()
+			return
+		}
+
+		instance, ok := this.(*VMInstance)
+		if !ok {
+			vm.currentFrame.pushStack(object.NewException("Method call outside instance"))
+			vm.throw()
+			return
+		}
+
+		method := obj.GetMethod(name)
+		if method != nil {
+			vm.currentFrame.pushStack(&BoundMethod{
+				Method:   method,
+				Instance: instance,
+				Parent:   instance.Class.Parent,
+			})
+		} else {
+			vm.currentFrame.pushStack(object.NullConst)
+		}
+	case *object.Module:
+		vm.currentFrame.pushStack(vm.lookupModuleAttr(obj, name))
+	case *object.Hash:
+		vm.currentFrame.pushStack(vm.lookupHashIndex(obj, object.MakeStringObj(name)))
+	case *object.Exception:
+		vm.currentFrame.pushStack(vm.lookupExceptionAttr(obj, name))
+	case *object.Slice:
+		vm.currentFrame.pushStack(lookupSliceAttr(obj, name))
+	case *object.Enum, *object.EnumMember:
+		res := lookupEnumAttr(obj, name)
+		vm.currentFrame.pushStack(res)
+		if object.ObjectIs(res, object.ExceptionObj) {
+			vm.throw()
+		}
+	default:
+		vm.currentFrame.pushStack(object.NewPanic("Attribute lookup on non-object type %s", obj.Type()))
+		vm.throw()
+	}
+}
+
+// findLoadAttr returns the cache with the member name is on class when read,
+// filling it if needed. An exception is returned if the running code can't use
+// the member.
+func (vm *VirtualMachine) findLoadAttr(class *VMClass, name string, slot *atomic.Value) (*attrCache, object.Object) {
+	if cache := lookupCache(slot, class); cache != nil {
+		return cache, nil
+	}
+	if exc := vm.checkAccess(class, name); exc != nil {
+		return nil, exc
+	}
+
+	if method := class.GetMethod(name); method != nil {
+		return fillCache(slot, class, attrMethod, method), nil
+	} else if getter := class.GetGetter(name); getter != nil {
+		return fillCache(slot, class, attrGetter, getter), nil
+	}
+	return fillCache(slot, class, attrField, nil), nil
+}
+
+// loadInstanceAttr pushes the value of attribute name of instance. Methods
+// are bound to the instance and getters are called.
+func (vm *VirtualMachine) loadInstanceAttr(instance *VMInstance, name string, slot *atomic.Value) {
+	cache, exc := vm.findLoadAttr(instance.Class, name, slot)
+	if exc != nil {
+		vm.currentFrame.pushStack(exc)
+		vm.throw()
+		return
+	}
+
+	switch cache.kind {
+	case attrMethod:
+		vm.currentFrame.pushStack(&BoundMethod{
+			Method:   cache.member,
+			Instance: instance,
+			Parent:   instance.Class.Parent,
+		})
+	case attrGetter:
+		vm.callFunction(nil, nil, cache.member, true, instance, false)
+	default:
+		if cell := instance.Fields.Cell(name); cell != nil {
+			vm.currentFrame.pushStack(cell.Get())
+		} else {
+			vm.currentFrame.pushStack(object.NullConst)
+		}
+	}
+}
+
+// storeInstanceAttr assigns val to attribute name of instance, calling its
+// setter if the class defines one.
+func (vm *VirtualMachine) storeInstanceAttr(instance *VMInstance, name string, val object.Object, slot *atomic.Value) object.Object {
+	class := instance.Class
+	cache := lookupCache(slot, class)
+	if cache == nil {
+		if exc := vm.checkAccess(class, name); exc != nil {
+			return exc
+		}
+
+		if setter := class.GetSetter(name); setter != nil {
+			cache = fillCache(slot, class, attrSetter, setter)
+		} else if getter := class.GetGetter(name); getter != nil {
+			cache = fillCache(slot, class, attrGetter, getter)
+		} else {
+			cache = fillCache(slot, class, attrField, nil)
+		}
+	}
+
+	switch cache.kind {
+	case attrSetter:
+		vm.callFunction([]object.Object{val}, nil, cache.member, true, instance, false)
+		if ret := vm.currentFrame.popStack(); object.ObjectIs(ret, object.ExceptionObj) {
+			return ret
+		}
+		return nil
+	case attrGetter:
+		return object.NewException("Property %s is read-only", name)
+	}
+
+	cell := instance.Fields.Cell(name)
+	if cell == nil {
+		return object.NewException("Instance has no field %s", name)
+	}
+	if cell.IsConst() {
+		return object.NewException("Assignment to constant field %s", name)
+	}
+	cell.Set(val)
+	return nil
+}
+
+// storeStaticAttr assigns val to the static member name of class.
+func (vm *VirtualMachine) storeStaticAttr(class *VMClass, name string, val object.Object) object.Object {
+	if exc := vm.checkAccess(class, name); exc != nil {
+		return exc
+	}
+
+	_, env := class.GetStatic(name)
+	if env == nil {
+		return object.NewException("Class %s has no static member %s", class.Name, name)
+	}
+
+	if env.IsConstLocal(name) {
+		return object.NewException("Assignment to constant static member %s", name)
+	}
+	env.SetForce(name, val, false)
+	return nil
+}
+
+// classAccessors converts the map of property accessors made by BuildClass
+// into class methods.
+func classAccessors(accessors *object.Hash, class *VMClass) map[string]object.ClassMethod {
+	methods := make(map[string]object.ClassMethod, len(accessors.Pairs))
+	for _, pair := range accessors.Pairs {
+		fn := pair.Value.(*VMFunction)
+		fn.Class = class
+		methods[pair.Key.(*object.String).String()] = fn
+	}
+	return methods
+}
@@ -75,6 +75,44 @@ const (
 	Import
 	Dup
 	GetIter
+	StartFinally
+	EndFinally
+	MatchException
+	Yield
+	Await
+	CallKw
+	MakeInstanceKw
+	Extend
+	CallSpread
+	MakeInstanceSpread
+	CheckLength
+	LoadRest
+	CheckKeys
+	IsType
+	IsInstance
+	MatchLength
+	MatchKeys
+	NoMatch
+	BuildString
+	LoadUpvalue
+	StoreUpvalue
+	CopyScope
+	BinaryPow
+	BuildTrait
+	JumpIfNil
+	JumpIfNotNilOrPop
+	BuildSlice
+	MakeRange
+	IterNext
+	BreakOuter
+	ContinueOuter
+	Defer
+	EnterWith
+	ExitWith
+	LoadMethod
+	CallMethod
+	ExtendedArg
+	CloseIter
 
 	MaxOpcode // Not a real opcode, just used to denote the maximum value of a valid opcode
 	Label
@@ -87,133 +125,211 @@ const (
 	CmpGT
 	CmpLTEq
 	CmpGTEq
+	CmpIn
+	CmpNotIn
 	MaxCmpCodes
 )
 
 // 2 16-bit arguments
 var HasFourByteArg = map[Opcode]bool{
-	StartLoop: true,
+	StartLoop:      true,
+	MatchLength:    true,
+	LoadAttribute:  true,
+	StoreAttribute: true,
+	LoadMethod:     true,
+	ExtendedArg:    true,
 }
 
 // 1 16-bit argument
 var HasTwoByteArg = map[Opcode]bool{
-	LoadConst:        true,
-	StoreConst:       true,
-	LoadFast:         true,
-	StoreFast:        true,
-	DeleteFast:       true,
-	Define:           true,
-	LoadGlobal:       true,
-	StoreGlobal:      true,
-	LoadAttribute:    true,
-	StoreAttribute:   true,
-	Call:             true,
-	MakeArray:        true,
-	MakeMap:          true,
-	PopJumpIfTrue:    true,
-	PopJumpIfFalse:   true,
-	JumpIfTrueOrPop:  true,
-	JumpIfFalseOrPop: true,
-	JumpAbsolute:     true,
-	JumpForward:      true,
-	StartTry:         true,
-	BuildClass:       true,
-	MakeInstance:     true,
-	Import:           true,
+	LoadConst:         true,
+	StoreConst:        true,
+	LoadFast:          true,
+	StoreFast:         true,
+	DeleteFast:        true,
+	Define:            true,
+	LoadGlobal:        true,
+	StoreGlobal:       true,
+	Call:              true,
+	CallMethod:        true,
+	MakeArray:         true,
+	MakeMap:           true,
+	PopJumpIfTrue:     true,
+	PopJumpIfFalse:    true,
+	JumpIfTrueOrPop:   true,
+	JumpIfFalseOrPop:  true,
+	JumpAbsolute:      true,
+	JumpForward:       true,
+	StartTry:          true,
+	BuildClass:        true,
+	BuildTrait:        true,
+	JumpIfNil:         true,
+	JumpIfNotNilOrPop: true,
+	IterNext:          true,
+	EnterWith:         true,
+	MakeInstance:      true,
+	Import:            true,
+	StartFinally:      true,
+	CallKw:            true,
+	MakeInstanceKw:    true,
+	CheckLength:       true,
+	LoadRest:          true,
+	CheckKeys:         true,
+	MatchKeys:         true,
+	BuildString:       true,
+	LoadUpvalue:       true,
+	StoreUpvalue:      true,
 }
 
 // 1 8-bit argument
 var HasOneByteArg = map[Opcode]bool{
-	Compare: true,
+	Compare:       true,
+	IsType:        true,
+	MakeRange:     true,
+	BreakOuter:    true,
+	ContinueOuter: true,
 }
 
 var HasNoArg = map[Opcode]bool{
-	Noop:         true,
-	LoadIndex:    true,
-	StoreIndex:   true,
-	BinaryAdd:    true,
-	BinarySub:    true,
-	BinaryMul:    true,
-	BinaryDivide: true,
-	BinaryMod:    true,
-	BinaryShiftL: true,
-	BinaryShiftR: true,
-	BinaryAnd:    true,
-	BinaryOr:     true,
-	BinaryNot:    true,
-	BinaryAndNot: true,
-	Implements:   true,
-	UnaryNeg:     true,
-	UnaryNot:     true,
-	Return:       true,
-	Pop:          true,
-	MakeFunction: true,
-	EndBlock:     true,
-	Continue:     true,
-	NextIter:     true,
-	Break:        true,
-	Throw:        true,
-	OpenScope:    true,
-	CloseScope:   true,
-	Dup:          true,
-	GetIter:      true,
+	Noop:               true,
+	LoadIndex:          true,
+	StoreIndex:         true,
+	BinaryAdd:          true,
+	BinarySub:          true,
+	BinaryMul:          true,
+	BinaryDivide:       true,
+	BinaryMod:          true,
+	BinaryShiftL:       true,
+	BinaryShiftR:       true,
+	BinaryAnd:          true,
+	BinaryOr:           true,
+	BinaryNot:          true,
+	BinaryAndNot:       true,
+	Implements:         true,
+	UnaryNeg:           true,
+	UnaryNot:           true,
+	Return:             true,
+	Pop:                true,
+	MakeFunction:       true,
+	EndBlock:           true,
+	Continue:           true,
+	NextIter:           true,
+	Break:              true,
+	Throw:              true,
+	OpenScope:          true,
+	CloseScope:         true,
+	Dup:                true,
+	GetIter:            true,
+	EndFinally:         true,
+	MatchException:     true,
+	Yield:              true,
+	Await:              true,
+	Extend:             true,
+	CallSpread:         true,
+	MakeInstanceSpread: true,
+	IsInstance:         true,
+	NoMatch:            true,
+	CopyScope:          true,
+	BinaryPow:          true,
+	BuildSlice:         true,
+	Defer:              true,
+	ExitWith:           true,
+	CloseIter:          true,
 }
 
 var Names = map[Opcode]string{
-	Noop:             "NOOP",
-	LoadConst:        "LOAD_CONST",
-	StoreConst:       "STORE_CONST",
-	LoadFast:         "LOAD_FAST",
-	StoreFast:        "STORE_FAST",
-	DeleteFast:       "DELETE_FAST",
-	Define:           "DEFINE",
-	LoadGlobal:       "LOAD_GLOBAL",
-	StoreGlobal:      "STORE_GLOBAL",
-	LoadIndex:        "LOAD_INDEX",
-	StoreIndex:       "STORE_INDEX",
-	LoadAttribute:    "LOAD_ATTRIBUTE",
-	StoreAttribute:   "STORE_ATTRIBUTE",
-	BinaryAdd:        "BINARY_ADD",
-	BinarySub:        "BINARY_SUB",
-	BinaryMul:        "BINARY_MUL",
-	BinaryDivide:     "BINARY_DIVIDE",
-	BinaryMod:        "BINARY_MOD",
-	BinaryShiftL:     "BINARY_SHIFTL",
-	BinaryShiftR:     "BINARY_SHIFTR",
-	BinaryAnd:        "BINARY_AND",
-	BinaryOr:         "BINARY_OR",
-	BinaryNot:        "BINARY_NOT",
-	BinaryAndNot:     "BINARY_ANDNOT",
-	Implements:       "IMPLEMENTS",
-	UnaryNeg:         "UNARY_NEG",
-	UnaryNot:         "UNARY_NOT",
-	Compare:          "COMPARE",
-	Call:             "CALL",
-	Return:           "RETURN",
-	Pop:              "POP",
-	MakeArray:        "MAKE_ARRAY",
-	MakeMap:          "MAKE_MAP",
-	MakeFunction:     "MAKE_FUNCTION",
-	PopJumpIfTrue:    "POP_JUMP_IF_TRUE",
-	PopJumpIfFalse:   "POP_JUMP_IF_FALSE",
-	JumpIfTrueOrPop:  "JUMP_IF_TRUE_OR_POP",
-	JumpIfFalseOrPop: "JUMP_IF_FALSE_OR_POP",
-	JumpAbsolute:     "JUMP_ABSOLUTE",
-	JumpForward:      "JUMP_FORWARD",
-	EndBlock:         "END_BLOCK",
-	StartLoop:        "START_LOOP",
-	Continue:         "CONTINUE",
-	NextIter:         "NEXT_ITER",
-	Break:            "BREAK",
-	StartTry:         "START_TRY",
-	Throw:            "THROW",
-	BuildClass:       "BUILD_CLASS",
-	MakeInstance:     "MAKE_INSTANCE",
-	OpenScope:        "OPEN_SCOPE",
-	CloseScope:       "CLOSE_SCOPE",
-	Import:           "IMPORT",
-	Dup:              "DUP",
-	GetIter:          "GET_ITER",
+	Noop:               "NOOP",
+	LoadConst:          "LOAD_CONST",
+	StoreConst:         "STORE_CONST",
+	LoadFast:           "LOAD_FAST",
+	StoreFast:          "STORE_FAST",
+	DeleteFast:         "DELETE_FAST",
+	Define:             "DEFINE",
+	LoadGlobal:         "LOAD_GLOBAL",
+	StoreGlobal:        "STORE_GLOBAL",
+	LoadIndex:          "LOAD_INDEX",
+	StoreIndex:         "STORE_INDEX",
+	LoadAttribute:      "LOAD_ATTRIBUTE",
+	StoreAttribute:     "STORE_ATTRIBUTE",
+	BinaryAdd:          "BINARY_ADD",
+	BinarySub:          "BINARY_SUB",
+	BinaryMul:          "BINARY_MUL",
+	BinaryDivide:       "BINARY_DIVIDE",
+	BinaryMod:          "BINARY_MOD",
+	BinaryShiftL:       "BINARY_SHIFTL",
+	BinaryShiftR:       "BINARY_SHIFTR",
+	BinaryAnd:          "BINARY_AND",
+	BinaryOr:           "BINARY_OR",
+	BinaryNot:          "BINARY_NOT",
+	BinaryAndNot:       "BINARY_ANDNOT",
+	Implements:         "IMPLEMENTS",
+	UnaryNeg:           "UNARY_NEG",
+	UnaryNot:           "UNARY_NOT",
+	Compare:            "COMPARE",
+	Call:               "CALL",
+	Return:             "RETURN",
+	Pop:                "POP",
+	MakeArray:          "MAKE_ARRAY",
+	MakeMap:            "MAKE_MAP",
+	MakeFunction:       "MAKE_FUNCTION",
+	PopJumpIfTrue:      "POP_JUMP_IF_TRUE",
+	PopJumpIfFalse:     "POP_JUMP_IF_FALSE",
+	JumpIfTrueOrPop:    "JUMP_IF_TRUE_OR_POP",
+	JumpIfFalseOrPop:   "JUMP_IF_FALSE_OR_POP",
+	JumpAbsolute:       "JUMP_ABSOLUTE",
+	JumpForward:        "JUMP_FORWARD",
+	EndBlock:           "END_BLOCK",
+	StartLoop:          "START_LOOP",
+	Continue:           "CONTINUE",
+	NextIter:           "NEXT_ITER",
+	Break:              "BREAK",
+	StartTry:           "START_TRY",
+	Throw:              "THROW",
+	BuildClass:         "BUILD_CLASS",
+	MakeInstance:       "MAKE_INSTANCE",
+	OpenScope:          "OPEN_SCOPE",
+	CloseScope:         "CLOSE_SCOPE",
+	Import:             "IMPORT",
+	Dup:                "DUP",
+	GetIter:            "GET_ITER",
+	StartFinally:       "START_FINALLY",
+	EndFinally:         "END_FINALLY",
+	MatchException:     "MATCH_EXCEPTION",
+	Yield:              "YIELD",
+	Await:              "AWAIT",
+	CallKw:             "CALL_KW",
+	MakeInstanceKw:     "MAKE_INSTANCE_KW",
+	Extend:             "EXTEND",
+	CallSpread:         "CALL_SPREAD",
+	MakeInstanceSpread: "MAKE_INSTANCE_SPREAD",
+	CheckLength:        "CHECK_LENGTH",
+	LoadRest:           "LOAD_REST",
+	CheckKeys:          "CHECK_KEYS",
+	IsType:             "IS_TYPE",
+	IsInstance:         "IS_INSTANCE",
+	MatchLength:        "MATCH_LENGTH",
+	MatchKeys:          "MATCH_KEYS",
+	NoMatch:            "NO_MATCH",
+	BuildString:        "BUILD_STRING",
+	LoadUpvalue:        "LOAD_UPVALUE",
+	StoreUpvalue:       "STORE_UPVALUE",
+	CopyScope:          "COPY_SCOPE",
+	BinaryPow:          "BINARY_POW",
+	BuildTrait:         "BUILD_TRAIT",
+	JumpIfNil:          "JUMP_IF_NIL",
+	JumpIfNotNilOrPop:  "JUMP_IF_NOT_NIL_OR_POP",
+	BuildSlice:         "BUILD_SLICE",
+	MakeRange:          "MAKE_RANGE",
+	IterNext:           "ITER_NEXT",
+	BreakOuter:         "BREAK_OUTER",
+	ContinueOuter:      "CONTINUE_OUTER",
+	Defer:              "DEFER",
+	EnterWith:          "ENTER_WITH",
+	ExitWith:           "EXIT_WITH",
+	LoadMethod:         "LOAD_METHOD",
+	CallMethod:         "CALL_METHOD",
+	ExtendedArg:        "EXTENDED_ARG",
+	CloseIter:          "CLOSE_ITER",
 }
 
 var CmpOps = map[byte]string{
@@ -223,4 +339,6 @@ var CmpOps = map[byte]string{
 	CmpGT:    ">",
 	CmpLTEq:  "<=",
 	CmpGTEq:  ">=",
+	CmpIn:    "in",
+	CmpNotIn: "not in",
 }
@@ -0,0 +1,130 @@
+package vm
+
+import "github.com/nitrogen-lang/nitrogen/src/object"
+
+// makeRange creates a range from the operands of a range expression. The
+// step is nil if it was omitted.
+func makeRange(start, end, step object.Object, inclusive bool) object.Object {
+	r := &object.Range{Step: 1, Inclusive: inclusive}
+
+	startInt, ok := start.(*object.Integer)
+	if !ok {
+		return object.NewException("Range start must be an integer, got %s", start.Type())
+	}
+	r.Start = startInt.Value
+
+	endInt, ok := end.(*object.Integer)
+	if !ok {
+		return object.NewException("Range end must be an integer, got %s", end.Type())
+	}
+	r.End = endInt.Value
+
+	if step != object.NullConst {
+		stepInt, ok := step.(*object.Integer)
+		if !ok {
+			return object.NewException("Range step must be an integer, got %s", step.Type())
+		}
+		if stepInt.Value == 0 {
+			return object.NewException("Range step cannot be zero")
+		}
+		r.Step = stepInt.Value
+	}
+	return r
+}
+
+// evalRangeIndexExpression returns the integer at index of the range. Negative
+// indices count from the end.
+func evalRangeIndexExpression(r *object.Range, index *object.Integer) object.Object {
+	idx := index.Value
+	length, err := r.Len()
+	if err != nil {
+		return object.NewException("Range index: %s", err)
+	}
+
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 || idx >= length {
+		return object.NullConst
+	}
+	return object.MakeIntObj(r.At(idx))
+}
+
+// rangeIter iterates a range without the [key, value] pair an iterator
+// instance would allocate on each step.
+type rangeIter struct {
+	r   *object.Range
+	i   int64
+	len int64
+}
+
+func (r *rangeIter) Inspect() string         { return "<range iterator>" }
+func (r *rangeIter) Type() object.ObjectType { return object.ResourceObj }
+func (r *rangeIter) Dup() object.Object      { return r }
+
+// makeRangeIter returns an iterator over r or an exception if r is too long to
+// give each integer a key.
+func makeRangeIter(r *object.Range) object.Object {
+	length, err := r.Len()
+	if err != nil {
+		return object.NewException("Can't iterate: %s", err)
+	}
+	return &rangeIter{r: r, len: length}
+}
+
+// iterNext returns the next key and value of iter. Key is nil once the
+// iterator is done. Iterator instances are advanced with their _next method
+// which must return a [key, value] pair or nil.
+func (vm *VirtualMachine) iterNext(iter object.Object) (key, val, exc object.Object) {
+	switch iter := iter.(type) {
+	case *rangeIter:
+		if iter.i >= iter.len {
+			return nil, nil, nil
+		}
+		key = object.MakeIntObj(iter.i)
+		val = object.MakeIntObj(iter.r.At(iter.i))
+		iter.i++
+		return key, val, nil
+
+	case *VMInstance:
+		var res object.Object
+		switch method := iter.Class.GetMethod("_next").(type) {
+		case nil:
+			return nil, nil, object.NewException("Iterator %s does not implement _next()", iter.Class.Name)
+		case *BuiltinMethod:
+			res = method.Fn(vm, iter, iter.Fields)
+		default:
+			vm.callFunction(nil, nil, method, true, iter, false)
+			res = vm.currentFrame.popStack()
+		}
+
+		switch res := res.(type) {
+		case nil, *object.Null:
+			return nil, nil, nil
+		case *object.Exception:
+			return nil, nil, res
+		case *object.Array:
+			if len(res.Elements) == 2 {
+				return res.Elements[0], res.Elements[1], nil
+			}
+		}
+		return nil, nil, object.NewException("%s._next() must return a [key, value] pair or nil", iter.Class.Name)
+	}
+
+	return nil, nil, object.NewException("Value of type %s is not an iterator", iter.Type())
+}
+
+// closeIter calls the _close method of iter when a loop over it ends, if it has
+// one. The exception thrown by _close is returned.
+func (vm *VirtualMachine) closeIter(iter object.Object) object.Object {
+	instance, ok := iter.(*VMInstance)
+	if !ok {
+		return nil
+	}
+
+	res, ok := vm.callMagicMethod(instance, "_close")
+	if ok && object.ObjectIs(res, object.ExceptionObj) {
+		return res
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/nitrogen-lang/nitrogen/src/compiler"
 	"github.com/nitrogen-lang/nitrogen/src/object"
+	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
 )
 
 type blockType byte
@@ -12,6 +13,7 @@ type blockType byte
 const (
 	loopBlockT blockType = iota
 	tryBlockT
+	finallyBlockT
 )
 
 type block interface {
@@ -20,6 +22,8 @@ type block interface {
 
 type forLoopBlock struct {
 	start, iter, end int
+	sp               int
+	env              *object.Environment
 }
 
 func (b *forLoopBlock) blockType() blockType { return loopBlockT }
@@ -27,10 +31,30 @@ func (b *forLoopBlock) blockType() blockType { return loopBlockT }
 type tryBlock struct {
 	catch, sp int
 	caught    bool
+	env       *object.Environment
 }
 
 func (b *tryBlock) blockType() blockType { return tryBlockT }
 
+type finallyBlock struct {
+	handler, sp int
+	env         *object.Environment
+}
+
+func (b *finallyBlock) blockType() blockType { return finallyBlockT }
+
+// finallyAction is given to a finally block when it's entered by a return,
+// break or continue. EndFinally resumes the action once the block is done.
+type finallyAction struct {
+	code  opcode.Opcode
+	value object.Object
+	loops int // Outer loops left by a break or continue
+}
+
+func (a *finallyAction) Inspect() string         { return "<finallyaction>" }
+func (a *finallyAction) Type() object.ObjectType { return object.ResourceObj }
+func (a *finallyAction) Dup() object.Object      { return a }
+
 type Frame struct {
 	lastFrame  *Frame
 	code       *compiler.CodeBlock
@@ -39,25 +63,28 @@ type Frame struct {
 	blockStack []block
 	bp         int
 	env        *object.Environment
+	locals     []*object.Cell // Slots of the local variables, nil until they're defined
+	upvalues   []*object.Cell // Variables captured by the running function
 	pc         int
+	ext        []uint16  // High bits of the arguments of the instruction after an EXTENDED_ARG
+	extArgs    [2]uint16 // Backing array of ext
 	unwind     bool
+	suspended  bool            // Set when a generator frame yields
+	deferred   []object.Object // Functions called in reverse order when the frame is left
 }
 
-func (f *Frame) lineno() uint {
-	pc := uint16(f.pc)
-	var linenum uint16
+// position returns the line and column of the instruction being run.
+func (f *Frame) position() (uint, uint) {
+	pc := uint32(f.pc)
+	var pos compiler.LineOffset
 
-	for i := 0; i < len(f.code.LineOffsets); i += 2 {
-		addr := f.code.LineOffsets[i]
-		line := f.code.LineOffsets[i+1]
-
-		if addr >= pc {
-			return uint(linenum)
+	for _, entry := range f.code.LineOffsets {
+		if entry.Offset >= pc {
+			break
 		}
-
-		linenum = line
+		pos = entry
 	}
-	return uint(linenum)
+	return uint(pos.Line), uint(pos.Col)
 }
 
 func (f *Frame) pushStack(obj object.Object) {
@@ -106,12 +133,12 @@ func (f *Frame) popBlock() block {
 	return f.blockStack[f.bp]
 }
 
-func (f *Frame) popBlockUntil(bt blockType) block {
+func (f *Frame) popBlockUntil(bts ...blockType) block {
 	if f.bp == 0 {
 		return nil
 	}
 
-	for f.blockStack[f.bp-1].blockType() != bt {
+	for !isBlockType(f.blockStack[f.bp-1], bts) {
 		f.bp--
 		if f.bp == 0 {
 			return nil
@@ -120,6 +147,15 @@ func (f *Frame) popBlockUntil(bt blockType) block {
 	return f.blockStack[f.bp-1]
 }
 
+func isBlockType(b block, bts []blockType) bool {
+	for _, bt := range bts {
+		if b.blockType() == bt {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *Frame) getCurrentBlock() block {
 	return f.blockStack[f.bp-1]
 }
@@ -1,7 +1,15 @@
 package vm
 
 import (
+	"io"
+	"sync/atomic"
 	"testing"
+
+	"github.com/nitrogen-lang/nitrogen/src/compiler"
+	"github.com/nitrogen-lang/nitrogen/src/lexer"
+	"github.com/nitrogen-lang/nitrogen/src/object"
+	"github.com/nitrogen-lang/nitrogen/src/parser"
+	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
 )
 
 func TestBlockStack(t *testing.T) {
@@ -40,3 +48,107 @@ func TestBlockStack(t *testing.T) {
 		t.Fatalf("Block pointer isn't right. Got %d, wanted %d", f.bp, 1)
 	}
 }
+
+func TestAttrCacheInvalidation(t *testing.T) {
+	parent := &VMClass{Name: "Parent", Methods: map[string]object.ClassMethod{}, version: new(uint64)}
+	child := &VMClass{Name: "Child", Parent: parent, Methods: map[string]object.ClassMethod{}, version: parent.version}
+	vm := NewVM(nil)
+	vm.currentFrame = &Frame{}
+
+	other := &VMClass{Name: "Other", Methods: map[string]object.ClassMethod{}, version: new(uint64)}
+	otherSlot := &atomic.Value{}
+	vm.findLoadAttr(other, "speak", otherSlot)
+
+	slot := &atomic.Value{}
+	cache, _ := vm.findLoadAttr(child, "speak", slot)
+	if lookupCache(slot, child) != cache || cache.kind != attrField {
+		t.Fatal("Cache wasn't filled with a field")
+	}
+	if lookupCache(slot, parent) != nil {
+		t.Fatal("Cache matched a different class")
+	}
+
+	method := MakeBuiltinMethod(nil, 0)
+	parent.SetMethod("speak", method)
+	if lookupCache(slot, child) != nil {
+		t.Fatal("Cache wasn't invalidated by changing a parent class")
+	}
+	if lookupCache(otherSlot, other) == nil {
+		t.Fatal("Cache was invalidated by changing an unrelated class")
+	}
+
+	cache, _ = vm.findLoadAttr(child, "speak", slot)
+	if cache.kind != attrMethod || cache.member != method {
+		t.Fatal("Cache didn't find the new method")
+	}
+}
+
+func TestExtendedArg(t *testing.T) {
+	constants := make([]object.Object, 70001)
+	for i := range constants {
+		constants[i] = object.MakeIntObj(int64(i))
+	}
+
+	// Jump to 69000 (0x10D88) and load constant 70000 (0x11170)
+	bytecode := make([]byte, 69009)
+	copy(bytecode, []byte{byte(opcode.ExtendedArg), 0, 1, 0, 0, byte(opcode.JumpAbsolute), 0x0D, 0x88})
+	copy(bytecode[69000:], []byte{byte(opcode.ExtendedArg), 0, 1, 0, 0, byte(opcode.LoadConst), 0x11, 0x70, byte(opcode.Return)})
+
+	code := &compiler.CodeBlock{
+		Name:         "test",
+		Code:         bytecode,
+		Constants:    constants,
+		MaxStackSize: 1,
+	}
+	res, err := NewVM(nil).Execute(code, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, ok := res.(*object.Integer); !ok || i.Value != 70000 {
+		t.Fatalf("Wrong result. Expected 70000, got %s", res.Inspect())
+	}
+}
+
+func TestInternalError(t *testing.T) {
+	// The constant doesn't exist so the VM itself panics
+	code := &compiler.CodeBlock{
+		Name:         "test",
+		Code:         []byte{byte(opcode.LoadConst), 0, 0, byte(opcode.Return)},
+		MaxStackSize: 1,
+	}
+	vm := NewVM(&Settings{Stdout: io.Discard, Stderr: io.Discard})
+	if _, err := vm.Execute(code, nil); err != ErrInternal {
+		t.Fatalf("Wrong error. Expected %q, got %v", ErrInternal, err)
+	}
+}
+
+func TestNegatedConditionsAtEachLevel(t *testing.T) {
+	tests := []string{
+		`let x = 5; if !x { "then" } else { "else" }`,
+		`let x = nil; if !x { "then" } else { "else" }`,
+		`let x = "a"; let r = ""; while !x { r = "loop"; x = true }; r`,
+		`let x = false; if !x { "then" } else { "else" }`,
+		`let x = 1; if !(x == 1) { "then" } else { "else" }`,
+	}
+
+	level := compiler.OptimizationLevel
+	defer func() { compiler.OptimizationLevel = level }()
+
+	run := func(src string, level int) string {
+		compiler.OptimizationLevel = level
+		p := parser.New(lexer.NewString(src), &parser.Settings{})
+		code := compiler.Compile(p.ParseProgram(), "test")
+		res, err := NewVM(&Settings{Stdout: io.Discard, Stderr: io.Discard}).Execute(code, nil)
+		if err != nil {
+			return err.Error()
+		}
+		return res.Inspect()
+	}
+
+	for _, src := range tests {
+		unoptimized := run(src, 0)
+		if optimized := run(src, 2); optimized != unoptimized {
+			t.Errorf("%q gives %q at level 2 but %q at level 0", src, optimized, unoptimized)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package vm
+
+import "github.com/nitrogen-lang/nitrogen/src/object"
+
+// evalSliceExpression returns a new array, string, or range with the elements
+// of left selected by slice.
+func (vm *VirtualMachine) evalSliceExpression(left object.Object, slice *object.Slice) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		start, _, step, count, err := slice.Indices(len(left.Elements))
+		if err != nil {
+			return object.NewException("Invalid slice: %s", err)
+		}
+
+		elements := make([]object.Object, count)
+		for i := range elements {
+			elements[i] = left.Elements[start+i*step]
+		}
+		return &object.Array{Elements: elements}
+
+	case *object.String:
+		start, _, step, count, err := slice.Indices(len(left.Value))
+		if err != nil {
+			return object.NewException("Invalid slice: %s", err)
+		}
+
+		runes := make([]rune, count)
+		for i := range runes {
+			runes[i] = left.Value[start+i*step]
+		}
+		return &object.String{Value: runes}
+
+	case *object.Range:
+		r, err := left.Slice(slice)
+		if err != nil {
+			return object.NewException("Invalid slice: %s", err)
+		}
+		return r
+	}
+	return object.NewException("Slice operator not allowed on type %s", left.Type())
+}
+
+// assignArraySlice replaces the elements of array selected by slice with the
+// elements of val. A slice with a step of 1 may be replaced with any number
+// of elements, other slices must be replaced with the same number.
+func (vm *VirtualMachine) assignArraySlice(array *object.Array, slice *object.Slice, val object.Object) object.Object {
+	replace, ok := val.(*object.Array)
+	if !ok {
+		return object.NewException("Can only assign an array to an array slice, got %s", val.Type())
+	}
+
+	start, end, step, count, err := slice.Indices(len(array.Elements))
+	if err != nil {
+		return object.NewException("Invalid slice: %s", err)
+	}
+
+	if step == 1 {
+		if end < start {
+			end = start
+		}
+		elements := make([]object.Object, 0, len(array.Elements)-(end-start)+len(replace.Elements))
+		elements = append(elements, array.Elements[:start]...)
+		elements = append(elements, replace.Elements...)
+		array.Elements = append(elements, array.Elements[end:]...)
+		return object.NullConst
+	}
+
+	if len(replace.Elements) != count {
+		return object.NewException("Can't assign %d elements to a slice of %d elements", len(replace.Elements), count)
+	}
+	for i, el := range replace.Elements {
+		array.Elements[start+i*step] = el
+	}
+	return object.NullConst
+}
+
+// assignStringSlice replaces the characters of str selected by slice with the
+// characters of val following the same rules as assignArraySlice.
+func (vm *VirtualMachine) assignStringSlice(str *object.String, slice *object.Slice, val object.Object) object.Object {
+	replace, ok := val.(*object.String)
+	if !ok {
+		return object.NewException("Can only assign a string to a string slice, got %s", val.Type())
+	}
+
+	start, end, step, count, err := slice.Indices(len(str.Value))
+	if err != nil {
+		return object.NewException("Invalid slice: %s", err)
+	}
+
+	if step == 1 {
+		if end < start {
+			end = start
+		}
+		runes := make([]rune, 0, len(str.Value)-(end-start)+len(replace.Value))
+		runes = append(runes, str.Value[:start]...)
+		runes = append(runes, replace.Value...)
+		str.Value = append(runes, str.Value[end:]...)
+		return object.NullConst
+	}
+
+	if len(replace.Value) != count {
+		return object.NewException("Can't assign %d characters to a slice of %d characters", len(replace.Value), count)
+	}
+	for i, r := range replace.Value {
+		str.Value[start+i*step] = r
+	}
+	return object.NullConst
+}
+
+// lookupSliceAttr returns the start, end, or step of a slice. Omitted parts are nil.
+func lookupSliceAttr(slice *object.Slice, name string) object.Object {
+	switch name {
+	case "start":
+		return slice.Start
+	case "end":
+		return slice.End
+	case "step":
+		return slice.Step
+	}
+	return object.NullConst
+}
@@ -0,0 +1,44 @@
+package vm
+
+import "github.com/nitrogen-lang/nitrogen/src/object"
+
+// extendCollection adds the elements of src to dst for a spread expression.
+// dst is always a new collection built by the current expression so it's
+// changed in place.
+func (vm *VirtualMachine) extendCollection(dst, src object.Object) object.Object {
+	switch dst := dst.(type) {
+	case *object.Array:
+		switch src := src.(type) {
+		case *object.Array:
+			dst.Elements = append(dst.Elements, src.Elements...)
+		case *object.Range:
+			length, err := src.Len()
+			if err != nil {
+				return object.NewException("Spread: %s", err)
+			}
+			for i := int64(0); i < length; i++ {
+				dst.Elements = append(dst.Elements, object.MakeIntObj(src.At(i)))
+			}
+		default:
+			return object.NewException("Spread expected an array, got %s", src.Type())
+		}
+		return dst
+
+	case *object.Hash:
+		srcHash, ok := src.(*object.Hash)
+		if !ok {
+			return object.NewException("Spread expected a map, got %s", src.Type())
+		}
+		for k, v := range srcHash.Pairs {
+			dst.Pairs[k] = v
+		}
+		return dst
+	}
+
+	return object.NewException("Spread not allowed on type %s", dst.Type())
+}
+
+// spreadArgs returns the arguments of a spread call built by extendCollection.
+func spreadArgs(args object.Object) []object.Object {
+	return args.(*object.Array).Elements
+}
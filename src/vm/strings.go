@@ -0,0 +1,19 @@
+package vm
+
+import "github.com/nitrogen-lang/nitrogen/src/object"
+
+// ObjectToString converts a value to a string for printing or embedding in
+// another string. Instances with a _str or toString method use its result,
+// everything else uses its Inspect form.
+func (vm *VirtualMachine) ObjectToString(obj object.Object) string {
+	if instance, ok := obj.(*VMInstance); ok {
+		if str, ok := vm.callMagicMethod(instance, "_str"); ok {
+			return vm.ObjectToString(str)
+		}
+		if str, ok := vm.callMagicMethod(instance, "toString"); ok {
+			return vm.ObjectToString(str)
+		}
+	}
+
+	return obj.Inspect()
+}
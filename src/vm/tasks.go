@@ -0,0 +1,235 @@
+package vm
+
+import (
+	"github.com/nitrogen-lang/nitrogen/src/object"
+)
+
+var taskClass = &BuiltinClass{
+	Fields: map[string]object.Object{
+		"task": object.NullConst,
+	},
+	VMClass: &VMClass{
+		Name:   "Task",
+		Parent: nil,
+		Methods: map[string]object.ClassMethod{
+			"done": MakeBuiltinMethod(taskDone, 0),
+		},
+	},
+}
+
+func init() {
+	// Added here to break the initialization cycle through the VM's run loop
+	taskClass.Methods["wait"] = MakeBuiltinMethod(taskWait, 0)
+}
+
+// taskState is a unit of work run by the VM's event loop. Tasks started by async
+// functions have a frame that's resumed each time the task is scheduled. Tasks
+// started with StartTask run a Go function on another goroutine.
+type taskState struct {
+	frame    *Frame
+	done     bool
+	observed bool // The result was awaited or waited on
+	result   object.Object
+	err      *object.Exception
+	waiters  []*taskState
+}
+
+func (t *taskState) Inspect() string         { return "<task>" }
+func (t *taskState) Type() object.ObjectType { return object.ResourceObj }
+func (t *taskState) Dup() object.Object      { return object.NullConst } // Tasks can't be duplicated
+
+type taskCompletion struct {
+	task   *taskState
+	result object.Object
+}
+
+func (vm *VirtualMachine) makeTask(t *taskState) *VMInstance {
+	env := object.NewEnvironment()
+	env.SetForce("task", t, true)
+
+	return &VMInstance{
+		Class:  taskClass.VMClass,
+		Fields: env,
+	}
+}
+
+func getTask(obj object.Object) *taskState {
+	instance, ok := obj.(*VMInstance)
+	if !ok {
+		return nil
+	}
+	t, _ := instance.Fields.Get("task")
+	task, _ := t.(*taskState)
+	return task
+}
+
+// startFrameTask schedules the frame of an async function call.
+func (vm *VirtualMachine) startFrameTask(frame *Frame) *VMInstance {
+	t := &taskState{frame: frame}
+	vm.readyTasks = append(vm.readyTasks, t)
+	return vm.makeTask(t)
+}
+
+// StartTask runs fn on a separate goroutine and returns a task that finishes
+// with its result. If fn returns an exception, the task fails with it. fn must
+// not use the VM or any environment, only the returned object is given back
+// to the event loop.
+func (vm *VirtualMachine) StartTask(fn func() object.Object) *VMInstance {
+	t := &taskState{}
+	vm.pendingTasks++
+
+	go func() {
+		vm.taskCompletions <- taskCompletion{task: t, result: fn()}
+	}()
+	return vm.makeTask(t)
+}
+
+// runTasks runs the event loop until the task until is done. If until is nil,
+// it runs until there's nothing left to do.
+func (vm *VirtualMachine) runTasks(until *taskState) {
+	for !vm.unwind {
+		if until != nil && until.done {
+			return
+		}
+
+		if len(vm.readyTasks) > 0 {
+			t := vm.readyTasks[0]
+			vm.readyTasks = vm.readyTasks[1:]
+			vm.stepTask(t)
+			continue
+		}
+
+		if vm.pendingTasks > 0 {
+			c := <-vm.taskCompletions
+			vm.pendingTasks--
+			if exc, ok := c.result.(*object.Exception); ok {
+				vm.finishTask(c.task, nil, exc)
+			} else {
+				vm.finishTask(c.task, c.result, nil)
+			}
+			continue
+		}
+
+		return
+	}
+}
+
+// stepTask runs a task's frame until it finishes or awaits another task.
+func (vm *VirtualMachine) stepTask(t *taskState) {
+	lastTask := vm.currentTask
+	vm.currentTask = t
+
+	defer func() {
+		vm.currentTask = lastTask
+
+		r := recover()
+		if r == nil {
+			return
+		}
+		exc, ok := r.(*object.Exception)
+		if !ok || !exc.Catchable {
+			panic(r)
+		}
+		vm.finishTask(t, nil, exc)
+	}()
+
+	t.frame.suspended = false
+	val := vm.RunFrame(t.frame, true)
+	if !t.frame.suspended {
+		vm.finishTask(t, val, nil)
+	}
+}
+
+func (vm *VirtualMachine) finishTask(t *taskState, result object.Object, err *object.Exception) {
+	t.done = true
+	t.result = result
+	t.err = err
+
+	if err != nil {
+		vm.failedTasks = append(vm.failedTasks, t)
+	}
+
+	vm.readyTasks = append(vm.readyTasks, t.waiters...)
+	t.waiters = nil
+}
+
+// await gives the result of a task to the current async function. If the task
+// isn't done, the current task is suspended and true is returned.
+func (vm *VirtualMachine) await(awaited object.Object) bool {
+	t := getTask(awaited)
+	if t == nil {
+		// Anything other than a task is already done, but other tasks get a turn to run
+		vm.currentFrame.pushStack(awaited)
+		vm.currentFrame.suspended = true
+		vm.readyTasks = append(vm.readyTasks, vm.currentTask)
+		return true
+	}
+	t.observed = true
+
+	if !t.done {
+		// Await runs again once the task is done
+		vm.currentFrame.pushStack(awaited)
+		vm.currentFrame.pc--
+		vm.currentFrame.suspended = true
+		t.waiters = append(t.waiters, vm.currentTask)
+		return true
+	}
+
+	if t.err != nil {
+		vm.currentFrame.pushStack(t.err)
+		vm.throw()
+		return false
+	}
+	vm.currentFrame.pushStack(t.result)
+	return false
+}
+
+// runPendingTasks finishes any tasks still running once the main script is done.
+// The first exception from a task that was never awaited is returned.
+func (vm *VirtualMachine) runPendingTasks(mainFrame *Frame) (ret object.Object) {
+	if len(vm.readyTasks) == 0 && vm.pendingTasks == 0 {
+		return nil
+	}
+
+	// Tasks run on top of the finished main frame so exceptions have somewhere to go
+	vm.currentFrame = mainFrame
+	defer func() {
+		vm.currentFrame = nil
+		if r := recover(); r != nil {
+			exc, ok := r.(*object.Exception)
+			if !ok {
+				panic(r)
+			}
+			ret = exc
+		}
+	}()
+
+	vm.runTasks(nil)
+
+	for _, t := range vm.failedTasks {
+		if !t.observed {
+			return t.err
+		}
+	}
+	return nil
+}
+
+func taskDone(interpreter *VirtualMachine, self *VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	return object.NativeBoolToBooleanObj(getTask(self).done)
+}
+
+// taskWait runs the event loop until the task is done and returns its result.
+// This allows code outside of an async function to use tasks.
+func taskWait(interpreter *VirtualMachine, self *VMInstance, env *object.Environment, args ...object.Object) object.Object {
+	t := getTask(self)
+	t.observed = true
+
+	interpreter.runTasks(t)
+	if !t.done {
+		return object.NewException("Task will never finish, it's waiting on itself")
+	}
+	if t.err != nil {
+		return t.err
+	}
+	return t.result
+}
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"github.com/nitrogen-lang/nitrogen/src/compiler"
+	"github.com/nitrogen-lang/nitrogen/src/object"
+)
+
+// VMTrait is a set of methods and fields that can be composed into classes.
+type VMTrait struct {
+	Name    string
+	Fields  *compiler.CodeBlock
+	Methods map[string]*VMFunction
+}
+
+func (t *VMTrait) Inspect() string         { return "trait " + t.Name }
+func (t *VMTrait) Type() object.ObjectType { return object.TraitObj }
+func (t *VMTrait) Dup() object.Object      { return object.NullConst }
+
+// composeTraits adds the methods of the traits used by class to its methods.
+// uses holds pairs of a trait and a map of its method aliases. Methods defined
+// by the class itself take precedence, a method provided by more than one trait
+// must be aliased.
+func composeTraits(class *VMClass, uses *object.Array) object.Object {
+	composed := make(map[string]string, len(uses.Elements))
+
+	for i := 0; i < len(uses.Elements); i += 2 {
+		trait, ok := uses.Elements[i].(*VMTrait)
+		if !ok {
+			return object.NewException("Class %s can only use traits, got %s", class.Name, uses.Elements[i].Type())
+		}
+
+		names := make(map[string]string, len(trait.Methods))
+		for name := range trait.Methods {
+			names[name] = name
+		}
+		for _, pair := range uses.Elements[i+1].(*object.Hash).Pairs {
+			method := pair.Key.(*object.String).String()
+			if _, exists := trait.Methods[method]; !exists {
+				return object.NewException("Trait %s has no method %s to alias", trait.Name, method)
+			}
+			names[method] = pair.Value.(*object.String).String()
+		}
+
+		for method, name := range names {
+			if other, exists := composed[name]; exists {
+				return object.NewException("Method %s is defined by traits %s and %s, alias one of them", name, other, trait.Name)
+			}
+			composed[name] = trait.Name
+
+			if _, exists := class.Methods[name]; exists {
+				continue
+			}
+			// The class is new so no cache can have it yet
+			fn := *trait.Methods[method]
+			fn.Name = name
+			fn.Class = class
+			class.Methods[name] = &fn
+		}
+
+		class.Traits = append(class.Traits, trait)
+	}
+	return nil
+}
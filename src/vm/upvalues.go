@@ -0,0 +1,87 @@
+package vm
+
+import (
+	"github.com/nitrogen-lang/nitrogen/src/compiler"
+	"github.com/nitrogen-lang/nitrogen/src/object"
+)
+
+// captureUpvalues gets the variables a new function captures from the current
+// frame. A variable that isn't defined yet is left nil and is looked up by
+// name when the function uses it.
+func (vm *VirtualMachine) captureUpvalues(code *compiler.CodeBlock) []*object.Cell {
+	if len(code.Upvalues) == 0 {
+		return nil
+	}
+
+	cells := make([]*object.Cell, len(code.Upvalues))
+	for i, up := range code.Upvalues {
+		if up.Local {
+			cells[i] = vm.currentFrame.locals[up.Index]
+		} else if int(up.Index) < len(vm.currentFrame.upvalues) {
+			cells[i] = vm.currentFrame.upvalues[up.Index]
+		}
+	}
+	return cells
+}
+
+func (vm *VirtualMachine) loadUpvalue(index uint32) {
+	cell := vm.currentFrame.upvalues[index]
+	if cell == nil {
+		vm.loadGlobal(vm.currentFrame.code.Upvalues[index].Name)
+		return
+	}
+	vm.currentFrame.pushStack(cell.Get())
+}
+
+func (vm *VirtualMachine) storeUpvalue(index uint32) {
+	cell := vm.currentFrame.upvalues[index]
+	if cell == nil {
+		vm.storeGlobal(vm.currentFrame.code.Upvalues[index].Name)
+		return
+	}
+
+	if cell.IsConst() {
+		vm.currentFrame.pushStack(object.NewException("Redefined constant %s", cell.Name()))
+		vm.throw()
+		return
+	}
+	cell.Set(vm.currentFrame.popStack())
+}
+
+// loadGlobal looks up a name in the enclosing scopes and then the builtins.
+func (vm *VirtualMachine) loadGlobal(name string) {
+	p := vm.currentFrame.env.Parent()
+	if p == nil {
+		p = vm.currentFrame.env
+	}
+	if val, ok := p.Get(name); ok {
+		vm.currentFrame.pushStack(val)
+		return
+	}
+	if fn := getBuiltin(name); fn != nil {
+		vm.currentFrame.pushStack(fn)
+		return
+	}
+
+	vm.currentFrame.pushStack(object.NewException("Global %s doesn't exist", name))
+	vm.throw()
+}
+
+func (vm *VirtualMachine) storeGlobal(name string) {
+	// Ensure constant isn't redefined
+	if vm.currentFrame.env.IsConst(name) {
+		vm.currentFrame.pushStack(object.NewException("Redefined constant %s", name))
+		vm.throw()
+		return
+	}
+	p := vm.currentFrame.env.Parent()
+	if p == nil {
+		p = vm.currentFrame.env
+	}
+	if _, exists := p.Get(name); !exists {
+		vm.currentFrame.pushStack(object.NewException("Global variable %s not defined", name))
+		vm.throw()
+		return
+	}
+	vm.currentFrame.env.Set(name, vm.currentFrame.popStack())
+}
@@ -1,12 +1,13 @@
 package vm
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
 	"strconv"
+	"strings"
 
 	"github.com/nitrogen-lang/nitrogen/src/ast"
 	"github.com/nitrogen-lang/nitrogen/src/compiler"
@@ -14,6 +15,10 @@ import (
 	"github.com/nitrogen-lang/nitrogen/src/vm/opcode"
 )
 
+// ErrInternal is returned by Execute when the VM itself panicked. The panic
+// and stack traces are written to stderr.
+var ErrInternal = errors.New("internal VM error")
+
 type ErrExitCode struct {
 	Code int
 }
@@ -23,8 +28,7 @@ func (e ErrExitCode) Error() string {
 }
 
 type Settings struct {
-	Debug            bool
-	ReturnExceptions bool
+	Debug bool
 
 	Stdin  io.Reader
 	Stdout io.Writer
@@ -48,6 +52,13 @@ type VirtualMachine struct {
 	globalEnv    *object.Environment
 	instanceVars map[string]interface{}
 
+	// Event loop for async tasks
+	currentTask     *taskState
+	readyTasks      []*taskState
+	failedTasks     []*taskState
+	pendingTasks    int
+	taskCompletions chan taskCompletion
+
 	unwind bool
 }
 
@@ -60,9 +71,10 @@ func NewVM(settings *Settings) *VirtualMachine {
 		}
 	}
 	return &VirtualMachine{
-		callStack:    newFrameStack(),
-		Settings:     settings,
-		instanceVars: make(map[string]interface{}),
+		callStack:       newFrameStack(),
+		Settings:        settings,
+		instanceVars:    make(map[string]interface{}),
+		taskCompletions: make(chan taskCompletion),
 	}
 }
 
@@ -105,7 +117,15 @@ func (vm *VirtualMachine) Execute(code *compiler.CodeBlock, env *object.Environm
 		env = object.NewEnvironment()
 	}
 	env.SetParent(vm.globalEnv)
-	return vm.RunFrame(vm.MakeFrame(code, env), false), vm.returnErr
+
+	mainFrame := vm.MakeFrame(code, env)
+	ret := vm.RunFrame(mainFrame, false)
+	if !vm.unwind && !object.ObjectIs(ret, object.ExceptionObj) {
+		if exc := vm.runPendingTasks(mainFrame); exc != nil {
+			ret = exc
+		}
+	}
+	return ret, vm.returnErr
 }
 
 func (vm *VirtualMachine) CurrentFrame() *Frame {
@@ -124,49 +144,73 @@ func (vm *VirtualMachine) MakeFrame(code *compiler.CodeBlock, env *object.Enviro
 		stack:      make([]object.Object, code.MaxStackSize+1), // +1 to make room for a runtime exception if thrown
 		blockStack: make([]block, code.MaxBlockSize),
 		env:        env,
+		locals:     make([]*object.Cell, code.LocalCount),
 		unwind:     true,
 	}
 }
 
-func (vm *VirtualMachine) RunFrame(f *Frame, immediateReturn bool) (ret object.Object) {
+func (vm *VirtualMachine) RunFrame(f *Frame, immediateReturn bool) object.Object {
+	f.lastFrame = vm.currentFrame
+	f.unwind = false // Exceptions leaving this frame are rethrown by the Go caller
+	vm.callStack.Push(f)
+	vm.currentFrame = f
+
+	rethrow := false
+	for {
+		if ret, done := vm.runFrame(f, immediateReturn, rethrow); done {
+			return ret
+		}
+		rethrow = true
+	}
+}
+
+// runFrame executes bytecode until f returns. An exception panicked by Go code
+// is recovered and pushed to the current frame's stack, done will be false and
+// runFrame should be called again with rethrow set to throw it in this frame.
+func (vm *VirtualMachine) runFrame(f *Frame, immediateReturn, rethrow bool) (ret object.Object, done bool) {
 	defer func() {
-		if r := recover(); r != nil {
-			if retObj, ok := r.(object.Object); ok {
-				if exc, ok := retObj.(*object.Exception); ok && exc.HasStackTrace {
-					ret = retObj
-					return
-				}
+		r := recover()
+		if r == nil {
+			return
+		}
 
-				stackBuf := bytes.Buffer{}
-				fmt.Fprintln(&stackBuf, retObj)
-				fmt.Fprintln(&stackBuf, "Stack Trace:")
-				frame := vm.currentFrame
-				for frame != nil {
-					fmt.Fprintf(&stackBuf, "\t%s: %s:%d\n", frame.code.Filename, frame.code.Name, frame.lineno())
-					frame = frame.lastFrame
-				}
-				vm.unwind = vm.currentFrame.unwind
-				exc := object.NewException(stackBuf.String())
-				exc.HasStackTrace = true
+		retObj, ok := r.(object.Object)
+		if !ok {
+			fmt.Fprintln(vm.GetStderr(), r)
+			fmt.Fprintln(vm.GetStderr(), string(debug.Stack()))
+
+			fmt.Fprintln(vm.GetStderr(), "VM Stack Trace:")
+			frame := vm.currentFrame
+			for frame != nil {
+				fmt.Fprintf(vm.GetStderr(), "\t%s: %s\n", frame.code.Filename, frame.code.Name)
+				frame = frame.lastFrame
+			}
+			vm.returnErr = ErrInternal
+			vm.unwind = true
+			done = true
+			return
+		}
+
+		exc := wrapException(retObj)
+		vm.captureStackTrace(exc)
+
+		if !exc.Catchable || vm.currentFrame == f.lastFrame {
+			// The exception escaped this frame, pass it on to the caller
+			if f.lastFrame == nil {
+				vm.currentFrame = nil
 				ret = exc
-				vm.currentFrame = vm.currentFrame.lastFrame
-			} else {
-				fmt.Fprintln(vm.GetStderr(), r)
-				fmt.Fprintln(vm.GetStderr(), string(debug.Stack()))
-
-				fmt.Fprintln(vm.GetStderr(), "VM Stack Trace:")
-				frame := vm.currentFrame
-				for frame != nil {
-					fmt.Fprintf(vm.GetStderr(), "\t%s: %s\n", frame.code.Filename, frame.code.Name)
-					frame = frame.lastFrame
-				}
-				vm.unwind = true
+				done = true
+				return
 			}
+			panic(exc)
 		}
+
+		vm.currentFrame.pushStack(exc)
 	}()
-	f.lastFrame = vm.currentFrame
-	vm.callStack.Push(f)
-	vm.currentFrame = f
+
+	if rethrow {
+		vm.throw()
+	}
 
 mainLoop:
 	for {
@@ -174,7 +218,7 @@ mainLoop:
 			if vm.returnValue == nil {
 				vm.returnValue = object.NullConst
 			}
-			return vm.returnValue
+			return vm.returnValue, true
 		}
 
 		if vm.currentFrame.pc >= len(vm.currentFrame.code.Code) {
@@ -239,6 +283,16 @@ mainLoop:
 				break
 			}
 
+		case opcode.BinaryPow:
+			r := vm.currentFrame.popStack()
+			l := vm.currentFrame.popStack()
+			res := vm.evalBinaryExpression("**", l, r)
+			vm.currentFrame.pushStack(res)
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.throw()
+				break
+			}
+
 		case opcode.BinaryShiftL:
 			r := vm.currentFrame.popStack()
 			l := vm.currentFrame.popStack()
@@ -300,11 +354,21 @@ mainLoop:
 			}
 
 		case opcode.UnaryNeg:
-			l := vm.currentFrame.popStack().(*object.Integer)
-			vm.currentFrame.pushStack(object.MakeIntObj(-l.Value))
+			res := vm.evalNegation(vm.currentFrame.popStack())
+			vm.currentFrame.pushStack(res)
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.throw()
+				break
+			}
 
 		case opcode.UnaryNot:
-			l := vm.currentFrame.popStack().(*object.Boolean)
+			val := vm.currentFrame.popStack()
+			l, ok := val.(*object.Boolean)
+			if !ok {
+				vm.currentFrame.pushStack(object.NewException("unknown operator: !%s", val.Type()))
+				vm.throw()
+				break
+			}
 			if l.Value {
 				vm.currentFrame.pushStack(object.FalseConst)
 			} else {
@@ -322,124 +386,112 @@ mainLoop:
 			}
 
 		case opcode.LoadConst:
-			vm.currentFrame.pushStack(vm.currentFrame.code.Constants[vm.getUint16()])
+			vm.currentFrame.pushStack(vm.currentFrame.code.Constants[vm.getArg()])
 
 		case opcode.StoreConst:
-			// Ensure constant isn't redefined
-			name := vm.currentFrame.code.Locals[vm.getUint16()]
-			if vm.currentFrame.env.IsConst(name) {
-				vm.currentFrame.pushStack(object.NewException("Redefined constant %s", name))
+			if exc := vm.defineLocal(vm.getArg(), true); exc != nil {
+				vm.currentFrame.pushStack(exc)
 				vm.throw()
+			}
+
+		case opcode.Return:
+			var val object.Object = object.NullConst
+			if vm.currentFrame.sp > 0 {
+				val = vm.currentFrame.popStack()
+			}
+
+			if vm.enterFinally(finallyAction{code: opcode.Return, value: val}) {
+				break
+			}
+			if vm.throwDeferred() {
 				break
 			}
-			if _, err := vm.currentFrame.env.CreateConst(name, vm.currentFrame.popStack()); err != nil {
-				fmt.Println(err)
+			if vm.returnFrame(f, immediateReturn, val) {
+				return vm.returnValue, true
 			}
 
-		case opcode.Return:
-			if vm.currentFrame.sp == 0 {
-				vm.returnValue = object.NullConst
-			} else {
-				vm.returnValue = vm.currentFrame.popStack()
+		case opcode.Await:
+			if vm.await(vm.currentFrame.popStack()) {
+				if vm.returnFrame(f, immediateReturn, object.NullConst) {
+					return vm.returnValue, true
+				}
 			}
 
-			vm.currentFrame = vm.currentFrame.lastFrame
-			vm.callStack.Pop()
-			if vm.currentFrame == nil || immediateReturn {
-				return vm.returnValue
+		case opcode.Yield:
+			vm.currentFrame.suspended = true
+			if vm.returnFrame(f, immediateReturn, vm.currentFrame.popStack()) {
+				return vm.returnValue, true
 			}
-			vm.currentFrame.pushStack(vm.returnValue)
 
 		case opcode.Pop:
 			vm.currentFrame.popStack()
 
 		case opcode.LoadFast:
-			name := vm.currentFrame.code.Locals[vm.getUint16()]
-			if val, ok := vm.currentFrame.env.GetLocal(name); ok {
-				vm.currentFrame.pushStack(val)
+			slot := vm.getArg()
+			if cell := vm.currentFrame.locals[slot]; cell != nil {
+				vm.currentFrame.pushStack(cell.Get())
 				break
 			}
 
-			vm.currentFrame.pushStack(object.NewException("Unknown variable/constant %s", name))
+			vm.currentFrame.pushStack(object.NewException("Unknown variable/constant %s", vm.currentFrame.code.Locals[slot]))
 			vm.throw()
-			break
 
 		case opcode.StoreFast:
-			// Ensure constant isn't redefined
-			name := vm.currentFrame.code.Locals[vm.getUint16()]
-			if vm.currentFrame.env.IsConstLocal(name) {
-				vm.currentFrame.pushStack(object.NewException("Redefined constant %s", name))
+			slot := vm.getArg()
+			cell := vm.currentFrame.locals[slot]
+			if cell == nil {
+				vm.currentFrame.pushStack(object.NewException("Variable %s undefined", vm.currentFrame.code.Locals[slot]))
 				vm.throw()
 				break
 			}
-			if _, exists := vm.currentFrame.env.GetLocal(name); !exists {
-				vm.currentFrame.pushStack(object.NewException("Variable %s undefined", name))
+			// Ensure constant isn't redefined
+			if cell.IsConst() {
+				vm.currentFrame.pushStack(object.NewException("Redefined constant %s", cell.Name()))
 				vm.throw()
 				break
 			}
-			vm.currentFrame.env.SetLocal(name, vm.currentFrame.popStack())
+			cell.Set(vm.currentFrame.popStack())
 
 		case opcode.DeleteFast:
-			name := vm.currentFrame.code.Locals[vm.getUint16()]
-			if vm.currentFrame.env.IsConstLocal(name) {
-				vm.currentFrame.pushStack(object.NewException("Cannot delete constant %s", name))
+			if exc := vm.deleteLocal(vm.getArg()); exc != nil {
+				vm.currentFrame.pushStack(exc)
 				vm.throw()
-				break
 			}
-			vm.currentFrame.env.UnsetLocal(name)
 
 		case opcode.Define:
-			// Ensure constant isn't redefined
-			name := vm.currentFrame.code.Locals[vm.getUint16()]
-			if vm.currentFrame.env.IsConst(name) {
-				vm.currentFrame.pushStack(object.NewException("Redefined constant %s", name))
-				vm.throw()
-				break
-			}
-			if _, exists := vm.currentFrame.env.GetLocal(name); exists {
-				vm.currentFrame.pushStack(object.NewException("Variable %s already defined", name))
+			if exc := vm.defineLocal(vm.getArg(), false); exc != nil {
+				vm.currentFrame.pushStack(exc)
 				vm.throw()
-				break
 			}
-			vm.currentFrame.env.Create(name, vm.currentFrame.popStack())
 
 		case opcode.LoadGlobal:
-			name := vm.currentFrame.code.Names[vm.getUint16()]
-			p := vm.currentFrame.env.Parent()
-			if p == nil {
-				p = vm.currentFrame.env
-			}
-			if val, ok := p.Get(name); ok {
-				vm.currentFrame.pushStack(val)
-				break
-			}
-			if fn := getBuiltin(name); fn != nil {
-				vm.currentFrame.pushStack(fn)
-				break
-			}
-
-			vm.currentFrame.pushStack(object.NewException("Global %s doesn't exist", name))
-			vm.throw()
-			break
+			vm.loadGlobal(vm.currentFrame.code.Names[vm.getArg()])
 
 		case opcode.StoreGlobal:
-			// Ensure constant isn't redefined
-			name := vm.currentFrame.code.Names[vm.getUint16()]
-			if vm.currentFrame.env.IsConst(name) {
-				vm.currentFrame.pushStack(object.NewException("Redefined constant %s", name))
-				vm.throw()
-				break
-			}
-			p := vm.currentFrame.env.Parent()
-			if p == nil {
-				p = vm.currentFrame.env
-			}
-			if _, exists := p.Get(name); !exists {
-				vm.currentFrame.pushStack(object.NewException("Global variable %s not defined", name))
+			vm.storeGlobal(vm.currentFrame.code.Names[vm.getArg()])
+
+		case opcode.LoadUpvalue:
+			vm.loadUpvalue(vm.getArg())
+
+		case opcode.StoreUpvalue:
+			vm.storeUpvalue(vm.getArg())
+
+		case opcode.MakeRange:
+			inclusive := vm.fetchByte() == 1
+			step := vm.currentFrame.popStack()
+			end := vm.currentFrame.popStack()
+			start := vm.currentFrame.popStack()
+			res := makeRange(start, end, step, inclusive)
+			vm.currentFrame.pushStack(res)
+			if object.ObjectIs(res, object.ExceptionObj) {
 				vm.throw()
-				break
 			}
-			vm.currentFrame.env.Set(name, vm.currentFrame.popStack())
+
+		case opcode.BuildSlice:
+			step := vm.currentFrame.popStack()
+			end := vm.currentFrame.popStack()
+			start := vm.currentFrame.popStack()
+			vm.currentFrame.pushStack(&object.Slice{Start: start, End: end, Step: step})
 
 		case opcode.LoadIndex:
 			index := vm.currentFrame.popStack()
@@ -462,20 +514,38 @@ mainLoop:
 				break
 			}
 
-		case opcode.Call:
-			numargs := vm.getUint16()
+		case opcode.Call, opcode.CallKw, opcode.CallSpread:
+			var numargs uint32
+			if code != opcode.CallSpread {
+				numargs = vm.getArg()
+			}
 			fn := vm.currentFrame.popStack()
-			this, exists := vm.currentFrame.env.GetLocal("this")
-			if !exists {
-				vm.CallFunction(numargs, fn, false, nil, !immediateReturn)
-				break
+			var kwargs *object.Hash
+			if code != opcode.Call {
+				kwargs = vm.currentFrame.popStack().(*object.Hash)
 			}
-			instance, ok := this.(*VMInstance)
-			if !ok {
-				vm.CallFunction(numargs, fn, false, nil, !immediateReturn)
+
+			var args []object.Object
+			if code == opcode.CallSpread {
+				args = spreadArgs(vm.currentFrame.popStack())
+			} else {
+				args = vm.popArgs(numargs)
+			}
+
+			vm.callFunction(args, kwargs, fn, false, vm.currentInstance(), true)
+
+		case opcode.CallMethod:
+			numargs := vm.getArg()
+			fn := vm.currentFrame.popStack()
+			self := vm.currentFrame.popStack()
+			args := vm.popArgs(numargs)
+
+			// LOAD_METHOD pushes nil instead of an instance when it didn't find a method
+			if instance, ok := self.(*VMInstance); ok {
+				vm.callFunction(args, nil, fn, false, instance, true)
 				break
 			}
-			vm.CallFunction(numargs, fn, false, instance, !immediateReturn)
+			vm.callFunction(args, nil, fn, false, vm.currentInstance(), true)
 
 		case opcode.Compare:
 			r := vm.currentFrame.popStack()
@@ -529,17 +599,23 @@ mainLoop:
 			fn := &VMFunction{
 				Name:       fnName.String(),
 				Parameters: make([]string, len(params.Elements)),
+				Defaults:   codeBlock.Defaults,
 				Body:       codeBlock,
 				Env:        object.NewEnclosedEnv(vm.currentFrame.env),
+				Upvalues:   vm.captureUpvalues(codeBlock),
 			}
 
 			for i, p := range params.Elements {
 				fn.Parameters[i] = p.(*object.String).String()
 			}
+			if last := len(fn.Parameters) - 1; last >= 0 && strings.HasPrefix(fn.Parameters[last], "...") {
+				fn.Rest = fn.Parameters[last][3:]
+				fn.Parameters = fn.Parameters[:last]
+			}
 			vm.currentFrame.pushStack(fn)
 
 		case opcode.MakeArray:
-			l := vm.getUint16()
+			l := vm.getArg()
 			array := &object.Array{
 				Elements: make([]object.Object, l),
 			}
@@ -549,8 +625,17 @@ mainLoop:
 			}
 			vm.currentFrame.pushStack(array)
 
+		case opcode.BuildString:
+			l := vm.getArg()
+			parts := make([]string, l)
+
+			for i := l; i > 0; i-- {
+				parts[i-1] = vm.ObjectToString(vm.currentFrame.popStack())
+			}
+			vm.currentFrame.pushStack(object.MakeStringObj(strings.Join(parts, "")))
+
 		case opcode.MakeMap:
-			l := vm.getUint16()
+			l := vm.getArg()
 			hash := &object.Hash{
 				Pairs: make(map[object.HashKey]object.HashPair, l),
 			}
@@ -558,14 +643,14 @@ mainLoop:
 			for i := l; i > 0; i-- {
 				key := vm.currentFrame.popStack()
 				val := vm.currentFrame.popStack()
-				hashKey, ok := key.(object.Hashable)
+				hashKey, ok := vm.HashKey(key)
 				if !ok {
 					ex := object.NewPanic("Map key %s not valid", key.Inspect())
 					vm.currentFrame.pushStack(ex)
 					vm.throw()
 					break
 				}
-				hash.Pairs[hashKey.HashKey()] = object.HashPair{
+				hash.Pairs[hashKey] = object.HashPair{
 					Key:   key,
 					Value: val,
 				}
@@ -573,28 +658,28 @@ mainLoop:
 			vm.currentFrame.pushStack(hash)
 
 		case opcode.PopJumpIfFalse:
-			target := vm.getUint16()
+			target := vm.getArg()
 			tos := vm.currentFrame.popStack()
 			if tos == object.FalseConst {
 				vm.currentFrame.pc = int(target)
 			}
 
 		case opcode.JumpAbsolute:
-			vm.currentFrame.pc = int(vm.getUint16())
+			vm.currentFrame.pc = int(vm.getArg())
 
 		case opcode.PopJumpIfTrue:
-			target := vm.getUint16()
+			target := vm.getArg()
 			tos := vm.currentFrame.popStack()
 			if tos == object.TrueConst {
 				vm.currentFrame.pc = int(target)
 			}
 
 		case opcode.JumpForward:
-			jump := vm.getUint16()
+			jump := vm.getArg()
 			vm.currentFrame.pc += int(jump)
 
 		case opcode.JumpIfTrueOrPop:
-			target := vm.getUint16()
+			target := vm.getArg()
 			tos := vm.currentFrame.getFrontStack()
 			if tos == object.TrueConst {
 				vm.currentFrame.pc = int(target)
@@ -603,7 +688,7 @@ mainLoop:
 			}
 
 		case opcode.JumpIfFalseOrPop:
-			target := vm.getUint16()
+			target := vm.getArg()
 			tos := vm.currentFrame.getFrontStack()
 			if tos == object.FalseConst {
 				vm.currentFrame.pc = int(target)
@@ -611,12 +696,30 @@ mainLoop:
 				vm.currentFrame.popStack()
 			}
 
+		case opcode.JumpIfNil:
+			target := vm.getArg()
+			if vm.currentFrame.getFrontStack() == object.NullConst {
+				vm.currentFrame.pc = int(target)
+			}
+
+		case opcode.JumpIfNotNilOrPop:
+			target := vm.getArg()
+			tos := vm.currentFrame.getFrontStack()
+			if tos != object.NullConst {
+				vm.currentFrame.pc = int(target)
+			} else {
+				vm.currentFrame.popStack()
+			}
+
 		case opcode.OpenScope:
 			vm.currentFrame.env = object.NewEnclosedEnv(vm.currentFrame.env)
 
 		case opcode.CloseScope:
 			vm.currentFrame.env = vm.currentFrame.env.Parent()
 
+		case opcode.CopyScope:
+			vm.copyScope()
+
 		case opcode.EndBlock:
 			vm.currentFrame.popBlock()
 			if vm.currentFrame.sp == 0 {
@@ -624,53 +727,162 @@ mainLoop:
 			}
 
 		case opcode.StartLoop:
-			loopEnd := vm.getUint16()
-			iter := vm.getUint16()
+			loopEnd := vm.getArg()
+			iter := vm.getArg()
 			lb := &forLoopBlock{
 				start: vm.currentFrame.pc,
 				iter:  int(iter),
 				end:   int(loopEnd),
+				sp:    vm.currentFrame.sp,
 			}
 			vm.currentFrame.pushBlock(lb)
 			vm.currentFrame.env = object.NewEnclosedEnv(vm.currentFrame.env)
+			lb.env = vm.currentFrame.env
+
+		case opcode.Continue, opcode.Break:
+			vm.jumpLoop(code, 0)
+
+		case opcode.BreakOuter:
+			vm.jumpLoop(opcode.Break, int(vm.fetchByte()))
+
+		case opcode.ContinueOuter:
+			vm.jumpLoop(opcode.Continue, int(vm.fetchByte()))
 
-		case opcode.Continue:
-			vm.currentFrame.pc = vm.currentFrame.popBlockUntil(loopBlockT).(*forLoopBlock).iter
+		case opcode.IterNext:
+			target := vm.getArg()
+			key, val, exc := vm.iterNext(vm.currentFrame.getFrontStack())
+			if exc != nil {
+				vm.currentFrame.pushStack(exc)
+				vm.throw()
+				break
+			}
+			if key == nil {
+				vm.currentFrame.pc = int(target)
+				break
+			}
+			vm.currentFrame.pushStack(key)
+			vm.currentFrame.pushStack(val)
 
 		case opcode.NextIter:
-			vm.currentFrame.pc = vm.currentFrame.popBlockUntil(loopBlockT).(*forLoopBlock).start
+			lb := vm.currentFrame.popBlockUntil(loopBlockT).(*forLoopBlock)
+			vm.currentFrame.pc = lb.start
 			vm.currentFrame.env = object.NewEnclosedEnv(vm.currentFrame.env.Parent())
-
-		case opcode.Break:
-			vm.currentFrame.pc = vm.currentFrame.popBlockUntil(loopBlockT).(*forLoopBlock).end
+			lb.env = vm.currentFrame.env
 
 		case opcode.Import:
-			path := vm.currentFrame.code.Constants[vm.getUint16()].(*object.String)
+			path := vm.currentFrame.code.Constants[vm.getArg()].(*object.String)
 			vm.importPackage(path.String())
 
 		case opcode.StartTry:
-			catch := vm.getUint16()
+			catch := vm.getArg()
 			tcb := &tryBlock{
 				catch: int(catch),
 				sp:    vm.currentFrame.sp,
+				env:   vm.currentFrame.env,
 			}
 			vm.currentFrame.pushBlock(tcb)
 
-		case opcode.Throw:
-			exc := vm.throw()
-			if exc != nil {
-				return exc
+		case opcode.StartFinally:
+			handler := vm.getArg()
+			fb := &finallyBlock{
+				handler: int(handler),
+				sp:      vm.currentFrame.sp,
+				env:     vm.currentFrame.env,
 			}
+			vm.currentFrame.pushBlock(fb)
+
+		case opcode.EnterWith:
+			handler := vm.getArg()
+			res := vm.enterWith(vm.currentFrame.getFrontStack())
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.currentFrame.pushStack(res)
+				vm.throw()
+				break
+			}
+			vm.currentFrame.pushBlock(&finallyBlock{
+				handler: int(handler),
+				sp:      vm.currentFrame.sp,
+				env:     vm.currentFrame.env,
+			})
+			vm.currentFrame.pushStack(res)
+
+		case opcode.ExitWith:
+			action := vm.currentFrame.popStack()
+			manager := vm.currentFrame.popStack()
+			if exc := vm.exitWith(manager, action); exc != nil {
+				vm.currentFrame.pushStack(exc)
+				vm.throw()
+				break
+			}
+			vm.currentFrame.pushStack(action)
+
+		case opcode.CloseIter:
+			action := vm.currentFrame.popStack()
+			if exc := vm.closeIter(vm.currentFrame.popStack()); exc != nil {
+				vm.currentFrame.pushStack(exc)
+				vm.throw()
+				break
+			}
+			vm.currentFrame.pushStack(action)
+
+		case opcode.Defer:
+			vm.currentFrame.deferred = append(vm.currentFrame.deferred, vm.currentFrame.popStack())
+
+		case opcode.EndFinally:
+			switch action := vm.currentFrame.popStack().(type) {
+			case *object.Exception:
+				vm.currentFrame.pushStack(action)
+				vm.throw()
+			case *finallyAction:
+				if action.code != opcode.Return {
+					vm.jumpLoop(action.code, action.loops)
+					break
+				}
+				if vm.enterFinally(*action) {
+					break
+				}
+				if vm.throwDeferred() {
+					break
+				}
+				if vm.returnFrame(f, immediateReturn, action.value) {
+					return vm.returnValue, true
+				}
+			}
+
+		case opcode.MatchException:
+			class := vm.currentFrame.popStack()
+			exc := vm.currentFrame.popStack()
+			res := vm.matchException(exc, class)
+			vm.currentFrame.pushStack(res)
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.throw()
+				break
+			}
+
+		case opcode.Throw:
+			vm.throw()
 
 		case opcode.BuildClass:
-			methodNum := vm.getUint16()
+			methodNum := vm.getArg()
 			class := &VMClass{}
 			class.Name = vm.currentFrame.popStack().(*object.String).String()
+			traits := vm.currentFrame.popStack().(*object.Array)
 			parent := vm.currentFrame.popStack()
 			if parent != object.NullConst {
 				class.Parent = parent.(*VMClass)
+				class.version = class.Parent.versionCounter()
+			} else {
+				class.version = new(uint64)
 			}
 			class.Fields = vm.currentFrame.popStack().(*compiler.CodeBlock)
+			private := vm.currentFrame.popStack().(*object.Array)
+			class.Private = make(map[string]bool, len(private.Elements))
+			for _, name := range private.Elements {
+				class.Private[name.(*object.String).String()] = true
+			}
+			statics := vm.currentFrame.popStack()
+			class.Setters = classAccessors(vm.currentFrame.popStack().(*object.Hash), class)
+			class.Getters = classAccessors(vm.currentFrame.popStack().(*object.Hash), class)
 			class.Methods = make(map[string]object.ClassMethod, methodNum)
 			for i := methodNum; i > 0; i-- {
 				method := vm.currentFrame.popStack()
@@ -682,82 +894,166 @@ mainLoop:
 					class.Methods[method.Name] = method
 				}
 			}
+
+			if exc := composeTraits(class, traits); exc != nil {
+				vm.currentFrame.pushStack(exc)
+				vm.throw()
+				break
+			}
+
+			class.code = make(map[*compiler.CodeBlock]bool)
+			class.collectClassCode(class.Fields)
+			class.collectMethodCode(class.Methods)
+			class.collectMethodCode(class.Getters)
+			class.collectMethodCode(class.Setters)
+
+			if statics, ok := statics.(*compiler.CodeBlock); ok {
+				class.collectClassCode(statics)
+				class.Statics = object.NewEnclosedEnv(vm.currentFrame.env)
+				vm.RunFrame(vm.MakeFrame(statics, class.Statics), true)
+			}
 			vm.currentFrame.pushStack(class)
 
+		case opcode.BuildTrait:
+			methodNum := vm.getArg()
+			trait := &VMTrait{}
+			trait.Name = vm.currentFrame.popStack().(*object.String).String()
+			trait.Fields = vm.currentFrame.popStack().(*compiler.CodeBlock)
+			trait.Methods = make(map[string]*VMFunction, methodNum)
+			for i := methodNum; i > 0; i-- {
+				method := vm.currentFrame.popStack().(*VMFunction)
+				trait.Methods[method.Name] = method
+			}
+			vm.currentFrame.pushStack(trait)
+
 		case opcode.MakeInstance:
-			argLen := vm.getUint16()
+			argLen := vm.getArg()
+			class := vm.currentFrame.popStack()
+			vm.makeInstance(vm.popArgs(argLen), nil, class)
+
+		case opcode.MakeInstanceKw:
+			argLen := vm.getArg()
+			class := vm.currentFrame.popStack()
+			kwargs := vm.currentFrame.popStack().(*object.Hash)
+			vm.makeInstance(vm.popArgs(argLen), kwargs, class)
+
+		case opcode.MakeInstanceSpread:
 			class := vm.currentFrame.popStack()
-			vm.makeInstance(argLen, class)
+			kwargs := vm.currentFrame.popStack().(*object.Hash)
+			vm.makeInstance(spreadArgs(vm.currentFrame.popStack()), kwargs, class)
+
+		case opcode.Extend:
+			src := vm.currentFrame.popStack()
+			dst := vm.currentFrame.popStack()
+			res := vm.extendCollection(dst, src)
+			vm.currentFrame.pushStack(res)
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.throw()
+			}
+
+		case opcode.CheckLength:
+			n := int(vm.getArg())
+			res := checkLength(vm.currentFrame.popStack(), n)
+			vm.currentFrame.pushStack(res)
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.throw()
+			}
+
+		case opcode.LoadRest:
+			n := int(vm.getArg())
+			val := vm.currentFrame.popStack()
+			res := loadRest(val, n)
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.currentFrame.pushStack(res)
+				vm.throw()
+				break
+			}
+			vm.currentFrame.pushStack(val)
+			vm.currentFrame.pushStack(res)
+
+		case opcode.CheckKeys:
+			keys := vm.popArgs(vm.getArg())
+			res := checkKeys(vm.currentFrame.popStack(), keys)
+			vm.currentFrame.pushStack(res)
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.throw()
+			}
+
+		case opcode.IsType:
+			t := object.ObjectType(vm.fetchByte())
+			val := vm.currentFrame.popStack()
+			vm.currentFrame.pushStack(object.NativeBoolToBooleanObj(isType(val, t)))
+
+		case opcode.IsInstance:
+			class := vm.currentFrame.popStack()
+			val := vm.currentFrame.popStack()
+			res := vm.isInstance(val, class)
+			vm.currentFrame.pushStack(res)
+			if object.ObjectIs(res, object.ExceptionObj) {
+				vm.throw()
+			}
+
+		case opcode.MatchLength:
+			n := int(vm.getArg())
+			exact := vm.getArg() == 1
+			val := vm.currentFrame.popStack()
+			vm.currentFrame.pushStack(object.NativeBoolToBooleanObj(matchLength(val, n, exact)))
+
+		case opcode.MatchKeys:
+			keys := vm.popArgs(vm.getArg())
+			val := vm.currentFrame.popStack()
+			vm.currentFrame.pushStack(object.NativeBoolToBooleanObj(matchKeys(val, keys)))
+
+		case opcode.NoMatch:
+			val := vm.currentFrame.popStack()
+			vm.currentFrame.pushStack(object.NewException("No match arm for value %s", val.Inspect()))
+			vm.throw()
 
 		case opcode.LoadAttribute:
-			name := vm.currentFrame.code.Names[vm.getUint16()]
+			name := vm.currentFrame.code.Names[vm.getArg()]
+			cache := &vm.currentFrame.code.Caches[vm.getArg()]
+			vm.loadAttr(vm.currentFrame.popStack(), name, cache)
+
+		case opcode.LoadMethod:
+			name := vm.currentFrame.code.Names[vm.getArg()]
+			cache := &vm.currentFrame.code.Caches[vm.getArg()]
 			obj := vm.currentFrame.popStack()
 
-			switch obj := obj.(type) {
-			case *VMInstance:
-				if method := obj.GetBoundMethod(name); method != nil {
-					vm.currentFrame.pushStack(method)
-				} else {
-					val, ok := obj.Fields.Get(name)
-					if ok {
-						vm.currentFrame.pushStack(val)
-					} else {
-						vm.currentFrame.pushStack(object.NullConst)
-					}
-				}
-			case *VMClass:
-				this, exists := vm.currentFrame.env.GetLocal("this")
-				if !exists {
-					vm.currentFrame.pushStack(object.NewException("Method call outside instance"))
+			// Methods are pushed with their instance instead of a bound method
+			if instance, ok := obj.(*VMInstance); ok {
+				found, exc := vm.findLoadAttr(instance.Class, name, cache)
+				if exc != nil {
+					vm.currentFrame.pushStack(exc)
 					vm.throw()
 					break
 				}
-
-				instance, ok := this.(*VMInstance)
-				if !ok {
-					vm.currentFrame.pushStack(object.NewException("Method call outside instance"))
-					vm.throw()
+				if found.kind == attrMethod {
+					vm.currentFrame.pushStack(instance)
+					vm.currentFrame.pushStack(found.member)
 					break
 				}
-
-				method := obj.GetMethod(name)
-				if method != nil {
-					vm.currentFrame.pushStack(&BoundMethod{
-						Method:   method,
-						Instance: instance,
-						Parent:   instance.Class.Parent,
-					})
-				} else {
-					vm.currentFrame.pushStack(object.NullConst)
-				}
-			case *object.Module:
-				vm.currentFrame.pushStack(vm.lookupModuleAttr(obj, name))
-			case *object.Hash:
-				vm.currentFrame.pushStack(vm.lookupHashIndex(obj, object.MakeStringObj(name)))
-			default:
-				vm.currentFrame.pushStack(object.NewPanic("Attribute lookup on non-object type %s", obj.Type()))
-				vm.throw()
 			}
 
+			vm.currentFrame.pushStack(object.NullConst)
+			vm.loadAttr(obj, name, cache)
+
 		case opcode.StoreAttribute:
-			name := vm.currentFrame.code.Names[vm.getUint16()]
+			name := vm.currentFrame.code.Names[vm.getArg()]
+			cache := &vm.currentFrame.code.Caches[vm.getArg()]
 			instance := vm.currentFrame.popStack()
 			val := vm.currentFrame.popStack()
 
 			switch instance := instance.(type) {
 			case *VMInstance:
-				if _, ok := instance.Fields.Get(name); !ok {
-					vm.currentFrame.pushStack(object.NewException("Instance has no field %s", name))
+				if exc := vm.storeInstanceAttr(instance, name, val, cache); exc != nil {
+					vm.currentFrame.pushStack(exc)
 					vm.throw()
-					break
 				}
-
-				if instance.Fields.IsConst(name) {
-					vm.currentFrame.pushStack(object.NewException("Assignment to constant field %s", name))
+			case *VMClass:
+				if exc := vm.storeStaticAttr(instance, name, val); exc != nil {
+					vm.currentFrame.pushStack(exc)
 					vm.throw()
-					break
 				}
-				instance.Fields.SetForce(name, val, false)
 			case *object.Module:
 				ret := vm.assignModuleAttr(instance, name, val)
 				if ret != object.NullConst {
@@ -774,6 +1070,15 @@ mainLoop:
 		case opcode.Dup:
 			vm.currentFrame.pushStack(vm.currentFrame.getFrontStack())
 
+		case opcode.ExtendedArg:
+			f := vm.currentFrame
+			f.extArgs[0] = uint16(vm.fetchByte())<<8 | uint16(vm.fetchByte())
+			f.extArgs[1] = uint16(vm.fetchByte())<<8 | uint16(vm.fetchByte())
+			f.ext = f.extArgs[:]
+			if opcode.HasTwoByteArg[opcode.Opcode(f.code.Code[f.pc])] {
+				f.ext = f.ext[:1]
+			}
+
 		case opcode.GetIter:
 			obj := vm.currentFrame.popStack()
 
@@ -785,13 +1090,21 @@ mainLoop:
 					vm.throw()
 					break
 				}
-				vm.CallFunction(0, method, true, obj, !immediateReturn)
+				vm.CallFunction(0, method, true, obj, false)
 			case *object.Hash:
 				vm.currentFrame.pushStack(makeMapIter(obj))
 			case *object.Array:
 				vm.currentFrame.pushStack(makeArrayIter(obj))
 			case *object.String:
 				vm.currentFrame.pushStack(makeStringIter(obj))
+			case *object.Enum:
+				vm.currentFrame.pushStack(makeArrayIter(enumMembers(obj)))
+			case *object.Range:
+				iter := makeRangeIter(obj)
+				vm.currentFrame.pushStack(iter)
+				if object.ObjectIs(iter, object.ExceptionObj) {
+					vm.throw()
+				}
 			default:
 				vm.currentFrame.pushStack(object.NewPanic("Attribute lookup on non-object type %s", obj.Type()))
 				vm.throw()
@@ -820,8 +1133,15 @@ func (vm *VirtualMachine) fetchByte() byte {
 	return b
 }
 
-func (vm *VirtualMachine) getUint16() uint16 {
-	return (uint16(vm.fetchByte()) << 8) + uint16(vm.fetchByte())
+// getArg reads a 16-bit argument of the current instruction. After an
+// EXTENDED_ARG the high 16 bits of the argument are taken from the prefix.
+func (vm *VirtualMachine) getArg() uint32 {
+	arg := uint32(vm.fetchByte())<<8 | uint32(vm.fetchByte())
+	if f := vm.currentFrame; len(f.ext) > 0 {
+		arg |= uint32(f.ext[0]) << 16
+		f.ext = f.ext[1:]
+	}
+	return arg
 }
 
 func (vm *VirtualMachine) PopStack() object.Object {
@@ -830,56 +1150,119 @@ func (vm *VirtualMachine) PopStack() object.Object {
 
 // throw takes the top of stack item as an exception object
 // it will then progressivly unwind the block stack and call stack until
-// a try block is found. If none is found, it will panic with an uncaught
-// exception and the VM will print a stack trace.
-func (vm *VirtualMachine) throw() object.Object {
-	exception := vm.currentFrame.popStack()
-	if exception.Type() != object.ExceptionObj {
-		exception = object.NewException(exception.Inspect())
-	}
-
-	if ex := exception.(*object.Exception); !ex.Catchable {
-		panic(object.NewException("Runtime Exception: %s", exception.Inspect()))
+// a try block is found. If none is found before reaching the first frame
+// of the current run loop, it will panic with the exception so the Go
+// caller of RunFrame can rethrow it or report it as uncaught.
+func (vm *VirtualMachine) throw() {
+	exception := wrapException(vm.currentFrame.popStack())
+	vm.captureStackTrace(exception)
+
+	if !exception.Catchable {
+		exception.Message = "Runtime Exception: " + exception.Message
+		panic(exception)
 	}
 
-	cframe := vm.currentFrame
 	for {
-		// Unwind block stack until there's a try block
-		catchBlock := vm.currentFrame.popBlockUntil(tryBlockT)
+		// Unwind block stack until there's a try or finally block
+		catchBlock := vm.currentFrame.popBlockUntil(tryBlockT, finallyBlockT)
+		if fb, ok := catchBlock.(*finallyBlock); ok {
+			vm.currentFrame.popBlock()
+			vm.currentFrame.sp = fb.sp
+			vm.currentFrame.env = fb.env
+			vm.currentFrame.pc = fb.handler
+			break
+		}
 		if catchBlock != nil { // Try block found
 			tryBlockS := catchBlock.(*tryBlock)
 			if !tryBlockS.caught {
 				tryBlockS.caught = true
 				vm.currentFrame.sp = tryBlockS.sp    // Unwind data stack
+				vm.currentFrame.env = tryBlockS.env  // Leave any scopes opened in the try block
 				vm.currentFrame.pc = tryBlockS.catch // Set program counter to catch block
 				break
 			}
+
+			// Thrown from within the catch block, look for an outer try block
+			vm.currentFrame.popBlock()
+			continue
 		}
-		if !vm.currentFrame.unwind {
-			exc := object.NewException(exception.Inspect())
-			exc.HasStackTrace = exception.(*object.Exception).HasStackTrace
-			panic(exc)
-		}
-		vm.currentFrame = vm.currentFrame.lastFrame // This frame doesn't have a try block, unwind call stack
-		if vm.currentFrame == nil {                 // Call stack exhausted
-			// exc := object.NewException("Uncaught Exception: %s", exception.Inspect())
-			exc := object.NewException(exception.Inspect())
-			exc.HasStackTrace = exception.(*object.Exception).HasStackTrace
 
-			if vm.Settings.ReturnExceptions {
-				return exc
+		if len(vm.currentFrame.deferred) > 0 {
+			vm.currentFrame.sp = 0
+			if exc := vm.runDeferred(); exc != nil {
+				exception = exc
 			}
+		}
 
-			vm.currentFrame = cframe // Reset frame for stack trace
-			panic(exc)
+		unwind := vm.currentFrame.unwind
+		vm.currentFrame = vm.currentFrame.lastFrame // This frame doesn't have a try block, unwind call stack
+		if !unwind || vm.currentFrame == nil {
+			panic(exception)
 		}
 	}
 
 	vm.currentFrame.pushStack(exception)
-	return nil
 }
 
-func (vm *VirtualMachine) makeInstance(argLen uint16, class object.Object) {
+// returnFrame pops the current frame and gives val to the caller. It returns true
+// when the run loop that started with frame f is done.
+func (vm *VirtualMachine) returnFrame(f *Frame, immediateReturn bool, val object.Object) bool {
+	vm.returnValue = val
+
+	returning := vm.currentFrame
+	vm.currentFrame = returning.lastFrame
+	vm.callStack.Pop()
+	if vm.currentFrame == nil || (immediateReturn && returning == f) {
+		return true
+	}
+	vm.currentFrame.pushStack(vm.returnValue)
+	return false
+}
+
+// enterFinally runs the closest finally block of the current frame before the
+// action is done. It returns false if there's no finally block.
+func (vm *VirtualMachine) enterFinally(action finallyAction) bool {
+	fb, ok := vm.currentFrame.popBlockUntil(finallyBlockT).(*finallyBlock)
+	if !ok {
+		return false
+	}
+	pending := action // Only allocated when there's a finally block to run
+
+	vm.currentFrame.popBlock()
+	vm.currentFrame.sp = fb.sp
+	vm.currentFrame.env = fb.env
+	vm.currentFrame.pushStack(&pending)
+	vm.currentFrame.pc = fb.handler
+	return true
+}
+
+// jumpLoop does a break or continue, going through any finally blocks inside the loop.
+// loops is the number of loops nested inside the loop the jump is for.
+func (vm *VirtualMachine) jumpLoop(code opcode.Opcode, loops int) {
+	for {
+		switch block := vm.currentFrame.popBlockUntil(loopBlockT, finallyBlockT).(type) {
+		case *finallyBlock:
+			vm.enterFinally(finallyAction{code: code, loops: loops})
+		case *forLoopBlock:
+			if loops > 0 {
+				vm.currentFrame.popBlock()
+				loops--
+				continue
+			}
+
+			vm.currentFrame.env = block.env
+			vm.currentFrame.sp = block.sp
+			if code == opcode.Break {
+				vm.currentFrame.pc = block.end
+			} else {
+				vm.currentFrame.pc = block.iter
+			}
+		}
+		return
+	}
+}
+
+func (vm *VirtualMachine) makeInstance(args []object.Object, kwargs *object.Hash, class object.Object) {
 	var instance *VMInstance
 
 	if class, ok := class.(*VMClass); ok {
@@ -895,6 +1278,12 @@ func (vm *VirtualMachine) makeInstance(argLen uint16, class object.Object) {
 		iFields.SetParent(vm.currentFrame.env)
 
 		for _, c := range classChain {
+			for _, trait := range c.Traits {
+				vm.RunFrame(vm.MakeFrame(trait.Fields, iFields), true)
+			}
+			if c.Fields == nil {
+				continue
+			}
 			frame := vm.MakeFrame(c.Fields, iFields)
 			vm.RunFrame(frame, true)
 		}
@@ -921,14 +1310,11 @@ func (vm *VirtualMachine) makeInstance(argLen uint16, class object.Object) {
 
 	init := instance.GetBoundMethod("init")
 	if init == nil {
-		for i := argLen; i > 0; i-- {
-			vm.currentFrame.popStack()
-		}
 		vm.currentFrame.pushStack(instance)
 		return
 	}
 
-	vm.CallFunction(argLen, init, true, nil, false)
+	vm.callFunction(args, kwargs, init, true, nil, false)
 	ret := vm.currentFrame.popStack() // Pop return value of init function
 	if ret.Type() == object.ExceptionObj {
 		vm.currentFrame.pushStack(ret)
@@ -939,18 +1325,45 @@ func (vm *VirtualMachine) makeInstance(argLen uint16, class object.Object) {
 	return
 }
 
+// currentInstance returns the instance the running method was called on, nil
+// outside of methods.
+func (vm *VirtualMachine) currentInstance() *VMInstance {
+	this, _ := vm.currentFrame.env.GetLocal("this")
+	instance, _ := this.(*VMInstance)
+	return instance
+}
+
 func (vm *VirtualMachine) CallFunction(argc uint16, fn object.Object, now bool, this *VMInstance, unwind bool) {
+	vm.callFunction(vm.popArgs(uint32(argc)), nil, fn, now, this, unwind)
+}
+
+// popArgs pops argc call arguments off the stack. The first argument is on top.
+func (vm *VirtualMachine) popArgs(argc uint32) []object.Object {
+	args := make([]object.Object, argc)
+	for i := range args {
+		args[i] = vm.currentFrame.popStack()
+	}
+	return args
+}
+
+// callFunction calls fn with the given arguments. kwargs holds any keyword
+// arguments, they're only accepted by functions defined in Nitrogen.
+func (vm *VirtualMachine) callFunction(args []object.Object, kwargs *object.Hash, fn object.Object, now bool, this *VMInstance, unwind bool) {
+	if kwargs != nil && len(kwargs.Pairs) > 0 {
+		switch fn.(type) {
+		case *object.Builtin, *BuiltinMethod:
+			vm.currentFrame.pushStack(object.NewException("Native functions don't accept keyword arguments"))
+			vm.throw()
+			return
+		}
+	}
+
 	switch fn := fn.(type) {
 	case *object.Builtin:
 		if vm.Settings.Debug {
 			fmt.Fprintf(vm.GetStdout(), "Calling builtin\n")
 		}
 
-		args := make([]object.Object, argc)
-		for i := uint16(0); i < argc; i++ {
-			args[i] = vm.currentFrame.popStack()
-		}
-
 		env := vm.currentFrame.env
 		if this != nil {
 			env = object.NewEnclosedEnv(env)
@@ -973,11 +1386,6 @@ func (vm *VirtualMachine) CallFunction(argc uint16, fn object.Object, now bool,
 			fmt.Fprintf(vm.GetStdout(), "Calling builtin method %s\n", fn.Name)
 		}
 
-		args := make([]object.Object, argc)
-		for i := uint16(0); i < argc; i++ {
-			args[i] = vm.currentFrame.popStack()
-		}
-
 		result := fn.Fn(vm, this, this.Fields, args...)
 		if result == nil {
 			result = object.NullConst
@@ -994,40 +1402,29 @@ func (vm *VirtualMachine) CallFunction(argc uint16, fn object.Object, now bool,
 			fmt.Fprintf(vm.GetStdout(), "Calling function %s\n", fn.Name)
 		}
 
-		var env *object.Environment
-		env = object.NewEnclosedEnv(fn.Env)
+		newFrame := vm.MakeFrame(fn.Body, object.NewEnclosedEnv(fn.Env))
 		if this != nil {
-			env.SetForce("this", this, true)
+			slot := len(fn.Parameters) + 1 // After the rest parameter or `arguments`
+			newFrame.bindLocal(slot, "this", this, true)
 			if fn.Class != nil && fn.Class.Parent != nil {
-				env.SetForce("parent", fn.Class.Parent, true)
+				newFrame.bindLocal(slot+1, "parent", fn.Class.Parent, true)
 			}
 		}
-
-		paramLen := len(fn.Parameters)
-
-		if int(argc) < paramLen {
-			vm.currentFrame.pushStack(object.NewException("Func expected %d args but was given %d", paramLen, argc))
-			vm.throw()
-			return
-		}
-
-		newFrame := vm.MakeFrame(fn.Body, env)
+		newFrame.upvalues = fn.Upvalues
 		newFrame.unwind = unwind
 		newFrame.lastFrame = vm.currentFrame
 
-		for i := 0; i < paramLen; i++ {
-			newFrame.env.SetForce(fn.Parameters[i], vm.currentFrame.popStack(), false)
+		if !vm.bindArguments(fn, newFrame, args, kwargs) {
+			return
 		}
 
-		if int(argc) > paramLen {
-			remaining := int(argc) - paramLen
-			rest := make([]object.Object, remaining)
-			for i := 0; i < remaining; i++ {
-				rest[i] = vm.currentFrame.popStack()
-			}
-			newFrame.env.SetForce("arguments", &object.Array{Elements: rest}, false)
-		} else {
-			newFrame.env.SetForce("arguments", &object.Array{Elements: []object.Object{}}, false)
+		if fn.Body.Generator {
+			vm.currentFrame.pushStack(makeGenerator(newFrame))
+			break
+		}
+		if fn.Body.Async {
+			vm.currentFrame.pushStack(vm.startFrameTask(newFrame))
+			break
 		}
 
 		if now {
@@ -1038,7 +1435,7 @@ func (vm *VirtualMachine) CallFunction(argc uint16, fn object.Object, now bool,
 			vm.callStack.Push(newFrame)
 		}
 	case *BoundMethod:
-		vm.CallFunction(argc, fn.Method, true, fn.Instance, unwind)
+		vm.callFunction(args, kwargs, fn.Method, now, fn.Instance, unwind)
 	case *VMClass:
 		if this == nil {
 			vm.currentFrame.pushStack(object.NewPanic("Can't call class method outside of object"))
@@ -1054,17 +1451,103 @@ func (vm *VirtualMachine) CallFunction(argc uint16, fn object.Object, now bool,
 
 		init := fn.GetMethod("init")
 		if init == nil {
-			for i := argc; i > 0; i-- {
-				vm.currentFrame.popStack()
-			}
 			return
 		}
-		vm.CallFunction(argc, init, true, this, unwind)
-	default:
-		for i := 0; i < int(argc); i++ {
-			vm.currentFrame.popStack()
+		vm.callFunction(args, kwargs, init, true, this, unwind)
+	case *object.EnumMember:
+		result := makeEnumValue(fn, args, kwargs)
+		vm.currentFrame.pushStack(result)
+		if object.ObjectIs(result, object.ExceptionObj) {
+			vm.throw()
 		}
+	default:
 		vm.currentFrame.pushStack(object.NewPanic("%s is not a function", fn.Type()))
 		vm.throw()
 	}
 }
+
+// bindArguments sets the parameters of fn in frame from the arguments and any
+// keyword arguments. Parameters that weren't given are set to their default
+// value which is evaluated in the new frame's environment. Extra arguments are
+// given to the rest parameter, or `arguments` if the function uses it.
+func (vm *VirtualMachine) bindArguments(fn *VMFunction, frame *Frame, args []object.Object, kwargs *object.Hash) bool {
+	paramLen := len(fn.Parameters)
+	given := make([]bool, paramLen)
+
+	for i := 0; i < paramLen && i < len(args); i++ {
+		frame.bindLocal(i, fn.Parameters[i], args[i], false)
+		given[i] = true
+	}
+
+	extra := []object.Object{}
+	if len(args) > paramLen {
+		extra = args[paramLen:]
+	}
+	if fn.Rest != "" {
+		frame.bindLocal(paramLen, fn.Rest, &object.Array{Elements: extra}, false)
+	} else if fn.Body.UsesArguments {
+		frame.bindLocal(paramLen, "arguments", &object.Array{Elements: extra}, false)
+	}
+
+	if kwargs != nil {
+		for _, pair := range kwargs.Pairs {
+			name := pair.Key.(*object.String).String()
+
+			i := paramIndex(fn, name)
+			if i == -1 {
+				vm.currentFrame.pushStack(object.NewException("Func %s got an unexpected keyword argument %s", fn.Name, name))
+				vm.throw()
+				return false
+			}
+			if given[i] {
+				vm.currentFrame.pushStack(object.NewException("Func %s got multiple values for argument %s", fn.Name, name))
+				vm.throw()
+				return false
+			}
+
+			frame.bindLocal(i, name, pair.Value, false)
+			given[i] = true
+		}
+	}
+
+	for i, param := range fn.Parameters {
+		if given[i] {
+			continue
+		}
+
+		if i < len(fn.Defaults) && fn.Defaults[i] != nil {
+			val := vm.RunFrame(vm.MakeFrame(fn.Defaults[i], object.NewEnclosedEnv(frame.env)), true)
+			frame.bindLocal(i, param, val, false)
+			continue
+		}
+
+		if kwargs == nil {
+			vm.currentFrame.pushStack(object.NewException("Func expected %d args but was given %d", requiredParams(fn), len(args)))
+		} else {
+			vm.currentFrame.pushStack(object.NewException("Func %s missing argument %s", fn.Name, param))
+		}
+		vm.throw()
+		return false
+	}
+
+	return true
+}
+
+func paramIndex(fn *VMFunction, name string) int {
+	for i, param := range fn.Parameters {
+		if param == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func requiredParams(fn *VMFunction) int {
+	required := len(fn.Parameters)
+	for _, def := range fn.Defaults {
+		if def != nil {
+			required--
+		}
+	}
+	return required
+}